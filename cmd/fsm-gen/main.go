@@ -0,0 +1,56 @@
+// Command fsm-gen generates Go file with constants for states, events, conditions and actions
+// of a schema file, along with interfaces for conditions and actions. It's intended to be used
+// with go generate:
+//
+//	//go:generate go run github.com/estambakio/go-fsm/cmd/fsm-gen -schema order.yaml
+//
+// By default package name is taken from GOPACKAGE environment variable set by go generate
+// and output file is named after schema file, e.g. order_fsm.go.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/estambakio/go-fsm/pkg/codegen"
+	"github.com/estambakio/go-fsm/pkg/schemafile"
+)
+
+func main() {
+	schemaPath := flag.String("schema", "", "path to schema file (.json, .yaml or .yml)")
+	pkg := flag.String("package", os.Getenv("GOPACKAGE"), "package name of generated file")
+	output := flag.String("output", "", "path to generated file, defaults to <schema>_fsm.go next to schema")
+	flag.Parse()
+
+	if err := run(*schemaPath, *pkg, *output); err != nil {
+		fmt.Fprintf(os.Stderr, "fsm-gen: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(schemaPath, pkg, output string) error {
+	if schemaPath == "" {
+		return fmt.Errorf("-schema is required")
+	}
+	if pkg == "" {
+		return fmt.Errorf("-package is required outside of go generate")
+	}
+	if output == "" {
+		output = strings.TrimSuffix(schemaPath, filepath.Ext(schemaPath)) + "_fsm.go"
+	}
+
+	schema, err := schemafile.Load(schemaPath)
+	if err != nil {
+		return err
+	}
+
+	src, err := codegen.Generate(schema, codegen.Options{Package: pkg, Source: filepath.Base(schemaPath)})
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(output, src, 0644)
+}
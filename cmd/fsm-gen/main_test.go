@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	schemaPath := filepath.Join(dir, "order.yaml")
+
+	err := os.WriteFile(schemaPath, []byte(`
+name: order
+initialState: new
+states: [new, paid]
+transitions:
+  - {from: new, to: paid, event: pay}
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := run(schemaPath, "orders", ""); err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := os.ReadFile(filepath.Join(dir, "order_fsm.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(src), `EventPay core.Event = "pay"`) {
+		t.Errorf("expected event constant in generated file, got:\n%s", src)
+	}
+
+	if err := run("", "orders", ""); err == nil {
+		t.Error("expected error without schema")
+	}
+	if err := run(schemaPath, "", ""); err == nil {
+		t.Error("expected error without package")
+	}
+
+	// invalid schema fails generation and doesn't produce output
+	invalid := filepath.Join(dir, "invalid.yaml")
+	os.WriteFile(invalid, []byte("states: [new]\ntransitions: [{from: new, to: paid, event: pay}]"), 0644)
+	if err := run(invalid, "orders", ""); err == nil {
+		t.Error("expected error for invalid schema")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "invalid_fsm.go")); !os.IsNotExist(err) {
+		t.Error("expected no output for invalid schema")
+	}
+}
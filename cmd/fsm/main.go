@@ -0,0 +1,108 @@
+// Command fsm works with schema files (.json, .yaml or .yml):
+//
+//	fsm validate [-strict] <schema>                           validate schema and check its graph
+//	fsm render [-format dot|mermaid|svg] [-o file] <schema>   draw diagram of schema
+//	fsm paths [-max-length n] <schema>                        list event sequences leading to final states
+//	fsm simulate [-guards=true] [-guard name=bool] <schema>   send events to a dummy object interactively
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/estambakio/go-fsm/pkg/codegen"
+	"github.com/estambakio/go-fsm/pkg/core"
+	"github.com/estambakio/go-fsm/pkg/schemafile"
+)
+
+const usage = `usage: fsm <command> [flags] <schema>
+
+commands:
+  validate   validate schema and check its graph
+  render     draw diagram of schema
+  paths      list event sequences from initial state to final states
+  simulate   send events to a dummy object interactively
+
+Run "fsm <command> -h" for flags of command.
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintf(os.Stderr, "fsm: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		fmt.Fprint(stdout, usage)
+		return fmt.Errorf("command is required")
+	}
+
+	switch args[0] {
+	case "validate":
+		return validate(args[1:], stdout)
+	case "render":
+		return render(args[1:], stdout)
+	case "paths":
+		return paths(args[1:], stdout)
+	case "simulate":
+		return simulate(args[1:], stdin, stdout)
+	case "help", "-h", "--help":
+		fmt.Fprint(stdout, usage)
+		return nil
+	default:
+		fmt.Fprint(stdout, usage)
+		return fmt.Errorf("unknown command %q", args[0])
+	}
+}
+
+// load reads schema and validates it with core.NewMachineDefinition. Conditions and actions
+// don't exist outside of application, so they are replaced by provided stubs.
+func load(path string, guard func(name string) bool, action func(name string)) (core.Schema, *core.MachineDefinition, error) {
+	schema, err := schemafile.Load(path)
+	if err != nil {
+		return core.Schema{}, nil, err
+	}
+
+	_, _, conditionNames, actionNames := codegen.Names(schema)
+
+	conditions := make([]core.Condition, len(conditionNames))
+	for i, name := range conditionNames {
+		name := name
+		conditions[i] = core.Condition{
+			Name: name,
+			F: func(ctx context.Context, o core.Object, params []core.Param) bool {
+				return guard(name)
+			},
+		}
+	}
+
+	actions := make([]core.Action, len(actionNames))
+	for i, name := range actionNames {
+		name := name
+		actions[i] = core.Action{
+			Name: name,
+			F: func(ctx context.Context, o core.Object, params []core.Param, prev []core.ActionResult) core.ActionResult {
+				action(name)
+				return core.ActionResult{Name: name}
+			},
+		}
+	}
+
+	md, err := core.NewMachineDefinition(schema, conditions, actions)
+	if err != nil {
+		return core.Schema{}, nil, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+	return schema, md, nil
+}
+
+// schemaArg returns the only positional argument of command
+func schemaArg(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", fmt.Errorf("expected exactly one schema file, got %d arguments", len(args))
+	}
+	return args[0], nil
+}
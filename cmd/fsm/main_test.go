@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const orderSchema = `
+name: order
+initialState: new
+finalStates: [shipped, cancelled]
+states: [new, paid, shipped, cancelled]
+transitions:
+  - {from: new, to: paid, event: pay, guards: [{name: isValid}], actions: [{name: charge}]}
+  - {from: paid, to: shipped, event: ship}
+  - {from: new, to: cancelled, event: cancel}
+`
+
+func writeSchema(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "order.yaml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func runCommand(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+	var stdout bytes.Buffer
+	err := run(args, strings.NewReader(stdin), &stdout)
+	return stdout.String(), err
+}
+
+func TestRun(t *testing.T) {
+	if _, err := runCommand(t, ""); err == nil {
+		t.Error("expected error without command")
+	}
+	if _, err := runCommand(t, "", "unknown"); err == nil {
+		t.Error("expected error for unknown command")
+	}
+	if _, err := runCommand(t, "", "validate"); err == nil {
+		t.Error("expected error without schema")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	path := writeSchema(t, orderSchema)
+
+	out, err := runCommand(t, "", "validate", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != path+": ok\n" {
+		t.Errorf("unexpected output: %s", out)
+	}
+
+	invalid := writeSchema(t, "initialState: new\nstates: [new]\ntransitions: [{from: new, to: paid, event: pay}]")
+	if _, err := runCommand(t, "", "validate", invalid); err == nil {
+		t.Error("expected error for invalid schema")
+	}
+
+	// graph issues are warnings unless -strict is set
+	unreachable := writeSchema(t, "initialState: new\nfinalStates: [done]\nstates: [new, done, lost]\n"+
+		"transitions: [{from: new, to: done, event: finish}, {from: lost, to: done, event: finish}]")
+	out, err = runCommand(t, "", "validate", unreachable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "warning: state 'lost': not reachable from initial state") {
+		t.Errorf("expected warning, got: %s", out)
+	}
+	if _, err := runCommand(t, "", "validate", "-strict", unreachable); err == nil {
+		t.Error("expected error in strict mode")
+	}
+}
+
+func TestRender(t *testing.T) {
+	path := writeSchema(t, orderSchema)
+
+	out, err := runCommand(t, "", "render", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, `digraph "order"`) {
+		t.Errorf("expected DOT, got: %s", out)
+	}
+
+	output := filepath.Join(t.TempDir(), "order.mmd")
+	if _, err := runCommand(t, "", "render", "-format", "mermaid", "-o", output, path); err != nil {
+		t.Fatal(err)
+	}
+	diagram, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(diagram), "stateDiagram-v2") {
+		t.Errorf("expected Mermaid, got: %s", diagram)
+	}
+
+	if _, err := runCommand(t, "", "render", "-format", "png", path); err == nil {
+		t.Error("expected error for unknown format")
+	}
+}
+
+func TestPaths(t *testing.T) {
+	path := writeSchema(t, orderSchema)
+
+	out, err := runCommand(t, "", "paths", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "shipped: pay, ship (new -> paid -> shipped)\n" +
+		"cancelled: cancel (new -> cancelled)\n"
+	if out != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out)
+	}
+
+	if out, _ = runCommand(t, "", "paths", "-max-length", "1", path); out != "cancelled: cancel (new -> cancelled)\n" {
+		t.Errorf("unexpected output: %s", out)
+	}
+}
+
+func TestSimulate(t *testing.T) {
+	path := writeSchema(t, orderSchema)
+
+	out, err := runCommand(t, "guard isValid false\nevents\nsend pay\nguard isValid true\nsend pay\nstate\nsend ship\nquit\n",
+		"simulate", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, line := range []string{
+		"state: new\n",
+		"> > " + "  cancel\n",
+		"error: SendEvent: no transition",
+		"  action charge\nstate: paid\n",
+		"state: shipped (final)\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("expected output to contain %q, got:\n%s", line, out)
+		}
+	}
+
+	// guards can be stubbed by flags
+	out, err = runCommand(t, "events\n", "simulate", "-guards=false", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "pay") {
+		t.Errorf("expected pay to be unavailable, got:\n%s", out)
+	}
+	out, err = runCommand(t, "events\n", "simulate", "-guards=false", "-guard", "isValid=true", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "  pay\n") {
+		t.Errorf("expected pay to be available, got:\n%s", out)
+	}
+}
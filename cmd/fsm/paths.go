@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/estambakio/go-fsm/pkg/analysis"
+)
+
+func paths(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("paths", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	maxLength := fs.Int("max-length", 0, "maximum number of events in path, 0 means no limit")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := schemaArg(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	schema, _, err := load(path, func(string) bool { return true }, func(string) {})
+	if err != nil {
+		return err
+	}
+
+	found := analysis.Paths(schema, *maxLength)
+	if len(found) == 0 {
+		fmt.Fprintln(stdout, "no paths to final states found")
+		return nil
+	}
+
+	for _, p := range found {
+		events := make([]string, len(p.Events))
+		for i, e := range p.Events {
+			events[i] = string(e)
+		}
+		fmt.Fprintf(stdout, "%s: %s (%s)\n", p.Final, strings.Join(events, ", "), strings.Join(p.States, " -> "))
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	fsmrender "github.com/estambakio/go-fsm/pkg/render"
+)
+
+func render(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	format := fs.String("format", "dot", "diagram format: dot, mermaid or svg (requires Graphviz)")
+	output := fs.String("o", "", "output file, stdout by default")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := schemaArg(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	schema, _, err := load(path, func(string) bool { return true }, func(string) {})
+	if err != nil {
+		return err
+	}
+
+	var diagram []byte
+	switch *format {
+	case "dot":
+		diagram = []byte(fsmrender.DOT(schema))
+	case "mermaid":
+		diagram = []byte(fsmrender.Mermaid(schema))
+	case "svg":
+		if diagram, err = fsmrender.SVG(context.Background(), schema); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	if *output == "" {
+		_, err = stdout.Write(diagram)
+		return err
+	}
+	return os.WriteFile(*output, diagram, 0644)
+}
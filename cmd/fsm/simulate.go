@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+const simulateHelp = `commands:
+  send <event>            send event to object
+  events                  list events available in current state
+  state                   print current state
+  guard <name> true|false set result of guard
+  reset                   move object to initial state
+  help                    print this help
+  quit                    exit
+`
+
+// dummy is an object used by simulation
+type dummy struct {
+	status string
+}
+
+func (d *dummy) Status() string     { return d.status }
+func (d *dummy) SetStatus(s string) { d.status = s }
+
+// guardFlags collects -guard name=bool flags
+type guardFlags map[string]bool
+
+func (g guardFlags) String() string {
+	return fmt.Sprint(map[string]bool(g))
+}
+
+func (g guardFlags) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("expected name=bool, got %q", value)
+	}
+	b, err := strconv.ParseBool(parts[1])
+	if err != nil {
+		return err
+	}
+	g[parts[0]] = b
+	return nil
+}
+
+func simulate(args []string, stdin io.Reader, stdout io.Writer) error {
+	fs := flag.NewFlagSet("simulate", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	defaultGuard := fs.Bool("guards", true, "result of guards which are not set explicitly")
+	guards := guardFlags{}
+	fs.Var(guards, "guard", "result of particular guard as name=bool, can be repeated")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := schemaArg(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	guard := func(name string) bool {
+		if result, ok := guards[name]; ok {
+			return result
+		}
+		return *defaultGuard
+	}
+	action := func(name string) {
+		fmt.Fprintf(stdout, "  action %s\n", name)
+	}
+
+	_, md, err := load(path, guard, action)
+	if err != nil {
+		return err
+	}
+
+	machine := core.NewMachine(context.Background(), md)
+	object := &dummy{}
+	machine.Start(object)
+
+	fmt.Fprintf(stdout, "state: %s\n", object.Status())
+
+	scanner := bufio.NewScanner(stdin)
+	for {
+		fmt.Fprint(stdout, "> ")
+		if !scanner.Scan() {
+			fmt.Fprintln(stdout)
+			return scanner.Err()
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "send":
+			if len(fields) != 2 {
+				fmt.Fprintln(stdout, "usage: send <event>")
+				continue
+			}
+			if _, err := machine.SendEvent(object, core.Event(fields[1])); err != nil {
+				fmt.Fprintf(stdout, "error: %v\n", err)
+				continue
+			}
+			fmt.Fprintf(stdout, "state: %s", object.Status())
+			if machine.IsInFinalState(object) {
+				fmt.Fprint(stdout, " (final)")
+			}
+			fmt.Fprintln(stdout)
+		case "events":
+			trs, err := machine.AvailableTransitions(object)
+			if err != nil {
+				fmt.Fprintf(stdout, "error: %v\n", err)
+				continue
+			}
+			seen := map[core.Event]bool{}
+			for _, t := range trs {
+				if !seen[t.Event] {
+					seen[t.Event] = true
+					fmt.Fprintf(stdout, "  %s\n", t.Event)
+				}
+			}
+		case "state":
+			fmt.Fprintf(stdout, "state: %s\n", object.Status())
+		case "guard":
+			if len(fields) != 3 {
+				fmt.Fprintln(stdout, "usage: guard <name> true|false")
+				continue
+			}
+			if err := guards.Set(fields[1] + "=" + fields[2]); err != nil {
+				fmt.Fprintf(stdout, "error: %v\n", err)
+			}
+		case "reset":
+			machine.Start(object)
+			fmt.Fprintf(stdout, "state: %s\n", object.Status())
+		case "help":
+			fmt.Fprint(stdout, simulateHelp)
+		case "quit", "exit":
+			return nil
+		default:
+			fmt.Fprintf(stdout, "unknown command %q, type help for list of commands\n", fields[0])
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/estambakio/go-fsm/pkg/analysis"
+)
+
+func validate(args []string, stdout io.Writer) error {
+	fs := flag.NewFlagSet("validate", flag.ContinueOnError)
+	fs.SetOutput(stdout)
+	strict := fs.Bool("strict", false, "fail if graph check finds issues")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	path, err := schemaArg(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	schema, _, err := load(path, func(string) bool { return true }, func(string) {})
+	if err != nil {
+		return err
+	}
+
+	issues := analysis.Check(schema)
+	for _, issue := range issues {
+		fmt.Fprintf(stdout, "warning: %s\n", issue)
+	}
+
+	if *strict && len(issues) > 0 {
+		return fmt.Errorf("%s: %d issues found", path, len(issues))
+	}
+
+	fmt.Fprintf(stdout, "%s: ok\n", path)
+	return nil
+}
@@ -0,0 +1,163 @@
+// Package fakesql provides a minimal database/sql driver for tests of SQL stores.
+// Statements are executed by Handler of test; changes made in transaction are applied on commit
+// and dropped on rollback.
+package fakesql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// TB is a part of testing.TB used by Open, so that package doesn't import testing into non-test code
+type TB interface {
+	Helper()
+	Cleanup(func())
+	Fatal(args ...interface{})
+}
+
+// Handler executes statements against state of test. Calls are serialized by DB.
+type Handler interface {
+	// Exec returns change made by statement, it's applied immediately or on commit of transaction
+	Exec(query string, args []driver.Value) (change func(), err error)
+	// Query returns rows of result, all of them must have the same number of columns
+	Query(query string, args []driver.Value) ([][]driver.Value, error)
+}
+
+// DB is a fake database which records all statements
+type DB struct {
+	mu      sync.Mutex
+	handler Handler
+	queries []string
+}
+
+// Open returns database which executes statements with handler. It uses single connection,
+// which keeps transactions simple, and is closed when test is done.
+func Open(t TB, handler Handler) (*sql.DB, *DB) {
+	t.Helper()
+
+	fake := &DB{handler: handler}
+	db := sql.OpenDB(connector{fake})
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	return db, fake
+}
+
+// Queries returns statements executed so far
+func (d *DB) Queries() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.queries...)
+}
+
+type connector struct{ db *DB }
+
+func (c connector) Connect(ctx context.Context) (driver.Conn, error) { return &conn{db: c.db}, nil }
+func (c connector) Driver() driver.Driver                            { return fakeDriver{c.db} }
+
+type fakeDriver struct{ db *DB }
+
+func (d fakeDriver) Open(name string) (driver.Conn, error) { return &conn{db: d.db}, nil }
+
+type conn struct {
+	db *DB
+	// tx keeps changes of open transaction
+	tx []func()
+	// inTx is true while transaction is open
+	inTx bool
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) { return &stmt{c, query}, nil }
+func (c *conn) Close() error                              { return nil }
+
+func (c *conn) Begin() (driver.Tx, error) {
+	c.inTx = true
+	return c, nil
+}
+
+func (c *conn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	for _, change := range c.tx {
+		change()
+	}
+	c.tx, c.inTx = nil, false
+	return nil
+}
+
+func (c *conn) Rollback() error {
+	c.tx, c.inTx = nil, false
+	return nil
+}
+
+type stmt struct {
+	c     *conn
+	query string
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return -1 }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	db := s.c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries = append(db.queries, s.query)
+
+	change, err := db.handler.Exec(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	if change == nil {
+		return nil, fmt.Errorf("no change returned for statement %q", s.query)
+	}
+	if s.c.inTx {
+		s.c.tx = append(s.c.tx, change)
+	} else {
+		change()
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	db := s.c.db
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.queries = append(db.queries, s.query)
+
+	result, err := db.handler.Query(s.query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &rows{rows: result}, nil
+}
+
+type rows struct{ rows [][]driver.Value }
+
+func (r *rows) Columns() []string {
+	if len(r.rows) == 0 {
+		return nil
+	}
+	columns := make([]string, len(r.rows[0]))
+	for i := range columns {
+		columns[i] = fmt.Sprintf("column%d", i+1)
+	}
+	return columns
+}
+
+func (r *rows) Close() error { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if len(r.rows) == 0 {
+		return io.EOF
+	}
+	copy(dest, r.rows[0])
+	r.rows = r.rows[1:]
+	return nil
+}
@@ -0,0 +1,70 @@
+package fakesql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// kv is a table of key-value pairs
+type kv map[string]string
+
+func (t kv) Exec(query string, args []driver.Value) (func(), error) {
+	if query != "SET" {
+		return nil, errors.New("unexpected statement")
+	}
+	return func() { t[args[0].(string)] = args[1].(string) }, nil
+}
+
+func (t kv) Query(query string, args []driver.Value) ([][]driver.Value, error) {
+	if v, ok := t[args[0].(string)]; ok {
+		return [][]driver.Value{{v}}, nil
+	}
+	return nil, nil
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+	table := kv{}
+	db, fake := Open(t, table)
+
+	if _, err := db.ExecContext(ctx, "SET", "a", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "DROP"); err == nil {
+		t.Error("expected error of handler")
+	}
+
+	// changes of transaction are applied on commit only
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.ExecContext(ctx, "SET", "b", "2")
+	tx.Rollback()
+	tx, _ = db.BeginTx(ctx, nil)
+	tx.ExecContext(ctx, "SET", "c", "3")
+	if len(table) != 1 {
+		t.Errorf("expected changes to be applied on commit, got %v", table)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(table, kv{"a": "1", "c": "3"}) {
+		t.Errorf("unexpected state %v", table)
+	}
+
+	var v string
+	if err := db.QueryRowContext(ctx, "GET", "c").Scan(&v); err != nil || v != "3" {
+		t.Errorf("expected value of c, got %s, %v", v, err)
+	}
+	if err := db.QueryRowContext(ctx, "GET", "b").Scan(&v); err == nil {
+		t.Error("expected no rows")
+	}
+
+	if q := fake.Queries(); len(q) != 6 || q[0] != "SET" || q[5] != "GET" {
+		t.Errorf("unexpected queries %v", q)
+	}
+}
@@ -0,0 +1,29 @@
+// Package sqlquery renders SQL statements of stores for different database drivers.
+package sqlquery
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Placeholder returns bind parameter for n-th (starting from 1) argument of SQL statement
+type Placeholder func(n int) string
+
+// Question is used by MySQL and SQLite
+func Question(n int) string {
+	return "?"
+}
+
+// Dollar is used by PostgreSQL
+func Dollar(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+// Render substitutes table name and placeholders {1}, {2}... {args} in statement
+func Render(statement, table string, placeholder Placeholder, args int) string {
+	pairs := []string{"{table}", table}
+	for n := 1; n <= args; n++ {
+		pairs = append(pairs, fmt.Sprintf("{%d}", n), placeholder(n))
+	}
+	return strings.NewReplacer(pairs...).Replace(statement)
+}
@@ -0,0 +1,14 @@
+package sqlquery
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	q := Render("SELECT * FROM {table} WHERE a = {1} AND b = {2}", "events", Question, 2)
+	if q != "SELECT * FROM events WHERE a = ? AND b = ?" {
+		t.Errorf("unexpected query: %s", q)
+	}
+	q = Render("DELETE FROM {table} WHERE a = {1} AND b = {2}", "events", Dollar, 1)
+	if q != "DELETE FROM events WHERE a = $1 AND b = {2}" {
+		t.Errorf("unexpected query: %s", q)
+	}
+}
@@ -0,0 +1,56 @@
+package adapter
+
+import "fmt"
+
+// MapObject exposes a value of document as core.Object and core.Identifiable
+type MapObject struct {
+	Doc map[string]interface{}
+	// StatusKey is a key of status value, "status" by default
+	StatusKey string
+	// IDKey is a key of identity value, "id" by default
+	IDKey string
+}
+
+// Map wraps document using default keys "status" and "id"
+func Map(doc map[string]interface{}) *MapObject {
+	return &MapObject{Doc: doc}
+}
+
+// Status implements core.Object. It returns empty string if status is missing
+// and formats non-string values with fmt.Sprint.
+func (o *MapObject) Status() string {
+	return o.get(o.StatusKey, "status")
+}
+
+// SetStatus implements core.Object. Document is allocated if it's nil.
+func (o *MapObject) SetStatus(s string) {
+	key := o.StatusKey
+	if key == "" {
+		key = "status"
+	}
+	if o.Doc == nil {
+		o.Doc = map[string]interface{}{}
+	}
+	o.Doc[key] = s
+}
+
+// ID implements core.Identifiable. Non-string values, e.g. numbers decoded from JSON,
+// are formatted with fmt.Sprint. It returns empty string if identity is missing,
+// such document is rejected by components which track objects by ID.
+func (o *MapObject) ID() string {
+	return o.get(o.IDKey, "id")
+}
+
+func (o *MapObject) get(key, defaultKey string) string {
+	if key == "" {
+		key = defaultKey
+	}
+	switch v := o.Doc[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,61 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+func TestMap(t *testing.T) {
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"id": 7, "state": "new"}`), &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	object := &MapObject{Doc: doc, StatusKey: "state"}
+
+	md, err := core.NewMachineDefinition(core.Schema{
+		States:      []core.State{core.State{Name: "new"}, core.State{Name: "paid"}},
+		Transitions: []core.Transition{core.Transition{From: "new", To: "paid", Event: "pay"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := core.NewMachine(context.Background(), md)
+	if _, err := machine.SendEvent(object, "pay"); err != nil {
+		t.Fatal(err)
+	}
+	if doc["state"] != "paid" || object.ID() != "7" {
+		t.Errorf("expected status 'paid' and ID 7, got %v", doc)
+	}
+
+	// default keys
+	object = Map(map[string]interface{}{})
+	if object.Status() != "" || object.ID() != "" {
+		t.Errorf("expected empty status and ID, got %v", object)
+	}
+	object.SetStatus("new")
+	if object.Doc["status"] != "new" {
+		t.Errorf("expected status to be set with default key, got %v", object.Doc)
+	}
+
+	// nil document is allocated
+	object = Map(nil)
+	object.SetStatus("new")
+	if object.Status() != "new" {
+		t.Errorf("expected status to be set in allocated document, got %v", object.Doc)
+	}
+
+	// document without ID can't be tracked
+	d, err := core.NewDispatcher(machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	if _, err := d.Submit(context.Background(), object, "pay"); err == nil {
+		t.Error("expected error for document without ID")
+	}
+}
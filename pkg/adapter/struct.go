@@ -0,0 +1,166 @@
+// Package adapter provides implementations of core.Object for types which don't implement it themselves.
+package adapter
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// TagName is a name of struct tag which marks fields used by Struct:
+// `fsm:"status"` for status field and optional `fsm:"id"` for identity field.
+// Options after comma, e.g. `fsm:"status,omitempty"`, are ignored.
+const TagName = "fsm"
+
+// StructObject exposes field of a struct tagged `fsm:"status"` as core.Object
+type StructObject struct {
+	ptr    interface{}
+	status reflect.Value
+}
+
+// IdentifiableStructObject is a StructObject which also implements core.Identifiable
+// using field tagged `fsm:"id"`
+type IdentifiableStructObject struct {
+	*StructObject
+	id reflect.Value
+}
+
+// Struct wraps pointer to struct and returns core.Object which reads and writes status field of the struct.
+// Status field must be exported and have underlying type string, e.g. custom type `type Status string`.
+// Fields of embedded structs and pointers to structs are taken into account; it's an error if embedded pointer
+// to struct with tagged fields is nil. If struct has exported field tagged `fsm:"id"`
+// of string or integer type then returned object is *IdentifiableStructObject, otherwise *StructObject.
+func Struct(ptr interface{}) (core.Object, error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected non-nil pointer to struct, got %T", ptr)
+	}
+
+	fields := map[string]reflect.Value{}
+	if err := taggedFields(v.Elem(), fields); err != nil {
+		return nil, err
+	}
+
+	status, ok := fields["status"]
+	if !ok {
+		return nil, fmt.Errorf("%T doesn't have field tagged `%s:\"status\"`", ptr, TagName)
+	}
+	if status.Kind() != reflect.String {
+		return nil, fmt.Errorf("status field of %T must be of string kind, got %s", ptr, status.Type())
+	}
+
+	o := &StructObject{ptr: ptr, status: status}
+
+	id, ok := fields["id"]
+	if !ok {
+		return o, nil
+	}
+
+	switch id.Kind() {
+	case reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+	default:
+		return nil, fmt.Errorf("id field of %T must be of string or integer kind, got %s", ptr, id.Type())
+	}
+
+	return &IdentifiableStructObject{StructObject: o, id: id}, nil
+}
+
+// taggedFields collects fields tagged with TagName, descending into embedded structs
+func taggedFields(v reflect.Value, fields map[string]reflect.Value) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		if tag, ok := f.Tag.Lookup(TagName); ok {
+			name, _, _ := strings.Cut(tag, ",")
+			if !v.Field(i).CanSet() {
+				return fmt.Errorf("field %s of %s tagged `%s:\"%s\"` must be exported", f.Name, t, TagName, name)
+			}
+			if _, ok := fields[name]; ok {
+				return fmt.Errorf("more than one field of %s is tagged `%s:\"%s\"`", t, TagName, name)
+			}
+			fields[name] = v.Field(i)
+			continue
+		}
+
+		if !f.Anonymous {
+			continue
+		}
+		switch {
+		case f.Type.Kind() == reflect.Struct:
+			if err := taggedFields(v.Field(i), fields); err != nil {
+				return err
+			}
+		case f.Type.Kind() == reflect.Ptr && f.Type.Elem().Kind() == reflect.Struct:
+			// pointers without tagged fields are skipped, so that they can be nil or refer to each other
+			if !hasTaggedFields(f.Type.Elem(), map[reflect.Type]bool{}) {
+				continue
+			}
+			if v.Field(i).IsNil() {
+				return fmt.Errorf("embedded field %s of %s has tagged fields, but it's nil", f.Name, t)
+			}
+			if err := taggedFields(v.Field(i).Elem(), fields); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// hasTaggedFields returns true if struct type or structs embedded into it have fields tagged with TagName
+func hasTaggedFields(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if _, ok := f.Tag.Lookup(TagName); ok {
+			return true
+		}
+		if !f.Anonymous {
+			continue
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct && hasTaggedFields(ft, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// Status implements core.Object
+func (o *StructObject) Status() string {
+	return o.status.String()
+}
+
+// SetStatus implements core.Object
+func (o *StructObject) SetStatus(s string) {
+	o.status.SetString(s)
+}
+
+// Value returns wrapped pointer to struct
+func (o *StructObject) Value() interface{} {
+	return o.ptr
+}
+
+// ID implements core.Identifiable
+func (o *IdentifiableStructObject) ID() string {
+	switch o.id.Kind() {
+	case reflect.String:
+		return o.id.String()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(o.id.Uint(), 10)
+	default:
+		return strconv.FormatInt(o.id.Int(), 10)
+	}
+}
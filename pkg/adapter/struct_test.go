@@ -0,0 +1,114 @@
+package adapter
+
+import (
+	"context"
+	"testing"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+type OrderStatus string
+
+type Entity struct {
+	Key int64 `fsm:"id"`
+}
+
+type order struct {
+	Entity
+	State OrderStatus `fsm:"status"`
+	Total int
+}
+
+func TestStruct(t *testing.T) {
+	o := &order{Entity: Entity{Key: 42}, State: "new"}
+
+	object, err := Struct(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	md, err := core.NewMachineDefinition(core.Schema{
+		States:      []core.State{core.State{Name: "new"}, core.State{Name: "paid"}},
+		Transitions: []core.Transition{core.Transition{From: "new", To: "paid", Event: "pay"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := core.NewMachine(context.Background(), md)
+	if _, err := machine.SendEvent(object, "pay"); err != nil {
+		t.Fatal(err)
+	}
+	if o.State != "paid" || object.Status() != "paid" {
+		t.Errorf("expected status 'paid', got %s", o.State)
+	}
+
+	identifiable, ok := object.(core.Identifiable)
+	if !ok || identifiable.ID() != "42" {
+		t.Errorf("expected object to have ID 42, got %v", object)
+	}
+	if object.(*IdentifiableStructObject).Value() != o {
+		t.Error("expected Value to return wrapped pointer")
+	}
+
+	// struct without id
+	plain, err := Struct(&struct {
+		Status string `fsm:"status"`
+	}{Status: "new"})
+	if err != nil || plain.Status() != "new" {
+		t.Fatalf("expected status 'new', got %v, %v", plain, err)
+	}
+	if _, ok := plain.(core.Identifiable); ok {
+		t.Error("expected object without id field not to be Identifiable")
+	}
+
+	// tag options are ignored, embedded pointers are followed
+	type document struct {
+		*Entity
+		State string `fsm:"status,omitempty" json:"state"`
+	}
+	doc := &document{Entity: &Entity{Key: 7}, State: "new"}
+	object, err = Struct(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	object.SetStatus("paid")
+	if doc.State != "paid" || object.(core.Identifiable).ID() != "7" {
+		t.Errorf("expected status 'paid' and ID 7, got %+v", doc)
+	}
+}
+
+func TestStruct_errors(t *testing.T) {
+	var nilOrder *order
+
+	tests := []interface{}{
+		order{},
+		nilOrder,
+		new(string),
+		&struct{ Status string }{},
+		&struct {
+			Status int `fsm:"status"`
+		}{},
+		&struct {
+			status string `fsm:"status"`
+		}{},
+		&struct {
+			Status string `fsm:"status"`
+			Other  string `fsm:"status"`
+		}{},
+		&struct {
+			Status string  `fsm:"status"`
+			ID     float64 `fsm:"id"`
+		}{},
+		&struct {
+			*Entity
+			Status string `fsm:"status"`
+		}{},
+	}
+
+	for i, test := range tests {
+		if _, err := Struct(test); err == nil {
+			t.Errorf("test %d: expected error for %T", i, test)
+		}
+	}
+}
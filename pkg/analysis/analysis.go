@@ -0,0 +1,205 @@
+// Package analysis inspects graph of core.Schema: reachability of states and paths between them.
+package analysis
+
+import (
+	"fmt"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// Edge is a possible move of object from one state to another by event.
+// Transitions to choices produce an edge for every branch of choice.
+type Edge struct {
+	From  string
+	To    string
+	Event core.Event
+	// Choice is a name of choice which edge passes through, if any
+	Choice string
+	// Internal is true for internal transitions, From and To are the same for them
+	Internal bool
+}
+
+// Edges returns all edges of schema graph: wildcard and multiple sources are expanded
+// to separate edges and transitions to choices are expanded to every branch.
+func Edges(schema core.Schema) []Edge {
+	final := map[string]bool{}
+	for _, s := range schema.FinalStates {
+		final[s.Name] = true
+	}
+
+	choices := map[string]core.Choice{}
+	for _, c := range schema.Choices {
+		choices[c.Name] = c
+	}
+
+	var edges []Edge
+	for _, t := range schema.Transitions {
+		sources := t.Sources()
+		if t.From == core.AnyState {
+			sources = nil
+			for _, s := range schema.States {
+				if !final[s.Name] {
+					sources = append(sources, s.Name)
+				}
+			}
+		}
+
+		for _, from := range sources {
+			if t.Internal {
+				edges = append(edges, Edge{From: from, To: from, Event: t.Event, Internal: true})
+				continue
+			}
+
+			c, ok := choices[t.To]
+			if !ok {
+				edges = append(edges, Edge{From: from, To: t.To, Event: t.Event})
+				continue
+			}
+
+			targets := []string{}
+			for _, b := range c.Branches {
+				targets = append(targets, b.To)
+			}
+			if c.Else != "" {
+				targets = append(targets, c.Else)
+			}
+			seen := map[string]bool{}
+			for _, to := range targets {
+				if !seen[to] {
+					seen[to] = true
+					edges = append(edges, Edge{From: from, To: to, Event: t.Event, Choice: c.Name})
+				}
+			}
+		}
+	}
+	return edges
+}
+
+// Issue is a problem found in schema graph
+type Issue struct {
+	State   string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("state '%s': %s", i.State, i.Message)
+}
+
+// Check returns issues of schema graph: states which are not reachable from initial state,
+// non-final states without outgoing transitions, final states with outgoing transitions and
+// states from which no final state can be reached.
+func Check(schema core.Schema) []Issue {
+	edges := Edges(schema)
+
+	outgoing := map[string][]string{}
+	incoming := map[string][]string{}
+	for _, e := range edges {
+		if e.Internal {
+			continue
+		}
+		outgoing[e.From] = append(outgoing[e.From], e.To)
+		incoming[e.To] = append(incoming[e.To], e.From)
+	}
+
+	final := map[string]bool{}
+	for _, s := range schema.FinalStates {
+		final[s.Name] = true
+	}
+
+	reachable := reach([]string{schema.InitialState.Name}, outgoing)
+
+	var finals []string
+	for _, s := range schema.FinalStates {
+		finals = append(finals, s.Name)
+	}
+	// states from which any final state can be reached, i.e. reachable from final states backwards
+	canFinish := reach(finals, incoming)
+
+	var issues []Issue
+	for _, s := range schema.States {
+		switch {
+		case !reachable[s.Name]:
+			issues = append(issues, Issue{s.Name, "not reachable from initial state"})
+		case final[s.Name] && len(outgoing[s.Name]) > 0:
+			issues = append(issues, Issue{s.Name, "final state has outgoing transitions"})
+		case !final[s.Name] && len(outgoing[s.Name]) == 0:
+			issues = append(issues, Issue{s.Name, "non-final state without outgoing transitions"})
+		case len(finals) > 0 && !canFinish[s.Name]:
+			issues = append(issues, Issue{s.Name, "no final state can be reached"})
+		}
+	}
+	return issues
+}
+
+// reach returns states reachable from start states following adjacency lists
+func reach(start []string, adjacent map[string][]string) map[string]bool {
+	visited := map[string]bool{}
+	queue := append([]string(nil), start...)
+	for _, s := range start {
+		visited[s] = true
+	}
+	for len(queue) > 0 {
+		s := queue[0]
+		queue = queue[1:]
+		for _, next := range adjacent[s] {
+			if !visited[next] {
+				visited[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return visited
+}
+
+// Path is a sequence of events which leads from initial state to a final state
+type Path struct {
+	Final  string
+	Events []core.Event
+	States []string
+}
+
+// Paths returns all paths from initial state to final states which don't visit any state twice.
+// Paths longer than maxLength events are not followed; maxLength <= 0 means no limit.
+// Paths are returned in order of depth-first search following order of declaration of transitions.
+func Paths(schema core.Schema, maxLength int) []Path {
+	final := map[string]bool{}
+	for _, s := range schema.FinalStates {
+		final[s.Name] = true
+	}
+
+	outgoing := map[string][]Edge{}
+	for _, e := range Edges(schema) {
+		if !e.Internal {
+			outgoing[e.From] = append(outgoing[e.From], e)
+		}
+	}
+
+	var paths []Path
+	visited := map[string]bool{}
+
+	var walk func(state string, events []core.Event, states []string)
+	walk = func(state string, events []core.Event, states []string) {
+		if final[state] {
+			paths = append(paths, Path{
+				Final:  state,
+				Events: append([]core.Event(nil), events...),
+				States: append([]string(nil), states...),
+			})
+			return
+		}
+		if maxLength > 0 && len(events) >= maxLength {
+			return
+		}
+		visited[state] = true
+		for _, e := range outgoing[state] {
+			if !visited[e.To] {
+				walk(e.To, append(events, e.Event), append(states, e.To))
+			}
+		}
+		visited[state] = false
+	}
+
+	initial := schema.InitialState.Name
+	walk(initial, nil, []string{initial})
+	return paths
+}
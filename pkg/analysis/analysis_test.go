@@ -0,0 +1,97 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+var orderSchema = core.Schema{
+	Name:         "order",
+	InitialState: core.State{Name: "new"},
+	FinalStates:  []core.State{{Name: "shipped"}, {Name: "cancelled"}},
+	States: []core.State{
+		{Name: "new"}, {Name: "paid"}, {Name: "review"}, {Name: "shipped"}, {Name: "cancelled"},
+	},
+	Transitions: []core.Transition{
+		{From: "new", To: "check", Event: "pay"},
+		{From: "review", To: "paid", Event: "approve"},
+		{From: "paid", To: "shipped", Event: "ship"},
+		{From: "paid", Event: "note", Internal: true},
+		{From: core.AnyState, To: "cancelled", Event: "cancel"},
+	},
+	Choices: []core.Choice{
+		{Name: "check", Branches: []core.Branch{{To: "review", Guards: []core.Guard{{Name: "large"}}}}, Else: "paid"},
+	},
+}
+
+func TestEdges(t *testing.T) {
+	expected := []Edge{
+		{From: "new", To: "review", Event: "pay", Choice: "check"},
+		{From: "new", To: "paid", Event: "pay", Choice: "check"},
+		{From: "review", To: "paid", Event: "approve"},
+		{From: "paid", To: "shipped", Event: "ship"},
+		{From: "paid", To: "paid", Event: "note", Internal: true},
+		{From: "new", To: "cancelled", Event: "cancel"},
+		{From: "paid", To: "cancelled", Event: "cancel"},
+		{From: "review", To: "cancelled", Event: "cancel"},
+	}
+	if edges := Edges(orderSchema); !reflect.DeepEqual(edges, expected) {
+		t.Errorf("expected %+v, got %+v", expected, edges)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	if issues := Check(orderSchema); len(issues) != 0 {
+		t.Errorf("expected no issues, got %v", issues)
+	}
+
+	schema := core.Schema{
+		InitialState: core.State{Name: "a"},
+		FinalStates:  []core.State{{Name: "done"}},
+		States:       []core.State{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "loop"}, {Name: "done"}},
+		Transitions: []core.Transition{
+			{From: "a", To: "b", Event: "next"},
+			{From: "a", To: "loop", Event: "spin"},
+			{From: "loop", To: "loop", Event: "spin"},
+			{From: "a", To: "done", Event: "finish"},
+			{From: "done", To: "a", Event: "restart"},
+		},
+	}
+
+	expected := []Issue{
+		{"b", "non-final state without outgoing transitions"},
+		{"c", "not reachable from initial state"},
+		{"loop", "no final state can be reached"},
+		{"done", "final state has outgoing transitions"},
+	}
+	if issues := Check(schema); !reflect.DeepEqual(issues, expected) {
+		t.Errorf("expected %v, got %v", expected, issues)
+	}
+}
+
+func TestPaths(t *testing.T) {
+	expected := []Path{
+		{Final: "shipped", Events: []core.Event{"pay", "approve", "ship"}, States: []string{"new", "review", "paid", "shipped"}},
+		{Final: "cancelled", Events: []core.Event{"pay", "approve", "cancel"}, States: []string{"new", "review", "paid", "cancelled"}},
+		{Final: "cancelled", Events: []core.Event{"pay", "cancel"}, States: []string{"new", "review", "cancelled"}},
+		{Final: "shipped", Events: []core.Event{"pay", "ship"}, States: []string{"new", "paid", "shipped"}},
+		{Final: "cancelled", Events: []core.Event{"pay", "cancel"}, States: []string{"new", "paid", "cancelled"}},
+		{Final: "cancelled", Events: []core.Event{"cancel"}, States: []string{"new", "cancelled"}},
+	}
+	if paths := Paths(orderSchema, 0); !reflect.DeepEqual(paths, expected) {
+		t.Errorf("expected %+v, got %+v", expected, paths)
+	}
+
+	// paths longer than limit are skipped
+	paths := Paths(orderSchema, 2)
+	if len(paths) != 4 {
+		t.Errorf("expected 4 paths of max length 2, got %+v", paths)
+	}
+	for _, p := range paths {
+		if len(p.Events) > 2 {
+			t.Errorf("expected path not longer than 2 events, got %+v", p)
+		}
+	}
+}
@@ -0,0 +1,273 @@
+// Package codegen generates Go constants and registration helpers for names used in core.Schema.
+package codegen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// Options of generated file
+type Options struct {
+	// Package is a name of package of generated file
+	Package string
+	// Source is a name of schema file mentioned in header of generated file
+	Source string
+}
+
+// name is a name from schema along with its Go identifier
+type name struct {
+	Value string
+	Ident string
+}
+
+// Generate validates schema and returns source of Go file with type State, constants for every state, choice,
+// event, condition and action name of schema, interfaces Conditions and Actions with a method for every
+// condition and action, and functions which turn implementations of these interfaces into
+// []core.Condition and []core.Action.
+func Generate(schema core.Schema, opts Options) ([]byte, error) {
+	if !token.IsIdentifier(opts.Package) {
+		return nil, fmt.Errorf("invalid package name %q", opts.Package)
+	}
+
+	states, events, conditions, actions := Names(schema)
+
+	// validate schema with stub conditions, because real ones don't exist at generation time
+	stubs := make([]core.Condition, len(conditions))
+	for i, c := range conditions {
+		stubs[i] = core.Condition{Name: c, F: func(context.Context, core.Object, []core.Param) bool { return false }}
+	}
+	if _, err := core.NewMachineDefinition(schema, stubs); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+
+	data := struct {
+		Options
+		Schema     string
+		States     []name
+		Choices    []name
+		Events     []name
+		Conditions []name
+		Actions    []name
+	}{Options: opts, Schema: schema.Name}
+
+	var err error
+	if data.States, err = identifiers(states); err != nil {
+		return nil, err
+	}
+	choices := make([]string, len(schema.Choices))
+	for i, c := range schema.Choices {
+		choices[i] = c.Name
+	}
+	if data.Choices, err = identifiers(choices); err != nil {
+		return nil, err
+	}
+	if data.Events, err = identifiers(events); err != nil {
+		return nil, err
+	}
+	if data.Conditions, err = identifiers(conditions); err != nil {
+		return nil, err
+	}
+	if data.Actions, err = identifiers(actions); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := fileTemplate.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w", err)
+	}
+	return src, nil
+}
+
+// Names returns names of states, events, conditions and actions referenced in schema
+// without duplicates in order of first appearance
+func Names(schema core.Schema) (states, events, conditions, actions []string) {
+	add := func(list *[]string, seen map[string]bool, name string) {
+		if name != "" && !seen[name] {
+			seen[name] = true
+			*list = append(*list, name)
+		}
+	}
+
+	seenStates, seenEvents, seenConditions, seenActions := map[string]bool{}, map[string]bool{}, map[string]bool{}, map[string]bool{}
+
+	for _, s := range schema.States {
+		add(&states, seenStates, s.Name)
+	}
+
+	addGuards := func(guards []core.Guard) {
+		for _, g := range guards {
+			add(&conditions, seenConditions, g.Name)
+		}
+	}
+	addActions := func(defs []core.ActionDefinition) {
+		for _, a := range defs {
+			add(&actions, seenActions, a.Name)
+		}
+	}
+
+	for _, t := range schema.Transitions {
+		add(&events, seenEvents, string(t.Event))
+		addGuards(t.Guards)
+		addActions(t.Actions)
+	}
+	for _, tm := range schema.Timers {
+		add(&events, seenEvents, string(tm.Event))
+	}
+	for _, sa := range schema.StateActions {
+		addActions(sa.OnExit)
+		addActions(sa.OnEntry)
+	}
+	for _, c := range schema.Choices {
+		for _, b := range c.Branches {
+			addGuards(b.Guards)
+			addActions(b.Actions)
+		}
+	}
+
+	return states, events, conditions, actions
+}
+
+// identifiers converts names to exported Go identifiers and fails if two names produce the same one
+func identifiers(names []string) ([]name, error) {
+	result := make([]name, len(names))
+	seen := map[string]string{}
+	for i, n := range names {
+		ident := Identifier(n)
+		if other, ok := seen[ident]; ok {
+			return nil, fmt.Errorf("names %q and %q produce the same identifier %s", other, n, ident)
+		}
+		seen[ident] = n
+		result[i] = name{Value: n, Ident: ident}
+	}
+	return result, nil
+}
+
+// Identifier converts name to exported Go identifier: words separated by non-alphanumeric characters
+// are capitalized and joined, e.g. "awaiting_payment" becomes "AwaitingPayment". Names which don't start
+// with a letter get "X" prefix.
+func Identifier(s string) string {
+	var b strings.Builder
+	upper := true
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		b.WriteRune(r)
+	}
+
+	ident := b.String()
+	if ident == "" || !unicode.IsLetter([]rune(ident)[0]) {
+		ident = "X" + ident
+	}
+	return ident
+}
+
+var fileTemplate = template.Must(template.New("file").Parse(`// Code generated by fsm-gen{{if .Source}} from {{.Source}}{{end}}. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+{{- if or .Conditions .Actions}}
+	"context"
+{{end}}
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+{{if .States}}
+// State is a state of schema {{printf "%q" .Schema}}
+type State string
+
+// States of schema {{printf "%q" .Schema}}
+const (
+{{- range .States}}
+	State{{.Ident}} State = {{printf "%q" .Value}}
+{{- end}}
+)
+{{end}}
+
+{{if .Choices}}
+// Choices of schema {{printf "%q" .Schema}}, transitions to them pick target state by branches
+const (
+{{- range .Choices}}
+	Choice{{.Ident}} State = {{printf "%q" .Value}}
+{{- end}}
+)
+{{end}}
+
+{{if .Events}}
+// Events of schema {{printf "%q" .Schema}}
+const (
+{{- range .Events}}
+	Event{{.Ident}} core.Event = {{printf "%q" .Value}}
+{{- end}}
+)
+{{end}}
+
+{{if .Conditions}}
+// Names of conditions referenced in schema {{printf "%q" .Schema}}
+const (
+{{- range .Conditions}}
+	Condition{{.Ident}} = {{printf "%q" .Value}}
+{{- end}}
+)
+{{end}}
+
+{{if .Actions}}
+// Names of actions referenced in schema {{printf "%q" .Schema}}
+const (
+{{- range .Actions}}
+	Action{{.Ident}} = {{printf "%q" .Value}}
+{{- end}}
+)
+{{end}}
+
+// Conditions should be implemented to provide every condition referenced in schema {{printf "%q" .Schema}}
+type Conditions interface {
+{{- range .Conditions}}
+	{{.Ident}}(ctx context.Context, o core.Object, params []core.Param) bool
+{{- end}}
+}
+
+// NewConditions returns conditions for core.NewMachineDefinition
+func NewConditions(impl Conditions) []core.Condition {
+	return []core.Condition{
+{{- range .Conditions}}
+		{Name: Condition{{.Ident}}, F: impl.{{.Ident}}},
+{{- end}}
+	}
+}
+
+// Actions should be implemented to provide every action referenced in schema {{printf "%q" .Schema}}
+type Actions interface {
+{{- range .Actions}}
+	{{.Ident}}(ctx context.Context, o core.Object, params []core.Param, prev []core.ActionResult) core.ActionResult
+{{- end}}
+}
+
+// NewActions returns actions for core.NewMachineDefinition
+func NewActions(impl Actions) []core.Action {
+	return []core.Action{
+{{- range .Actions}}
+		{Name: Action{{.Ident}}, F: impl.{{.Ident}}},
+{{- end}}
+	}
+}
+`))
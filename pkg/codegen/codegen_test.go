@@ -0,0 +1,121 @@
+package codegen
+
+import (
+	"bytes"
+	"go/parser"
+	"go/token"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"github.com/estambakio/go-fsm/pkg/codegen/internal/example"
+	"github.com/estambakio/go-fsm/pkg/core"
+	"github.com/estambakio/go-fsm/pkg/schemafile"
+)
+
+// loadSchema returns schema of example package
+func loadSchema(t *testing.T) core.Schema {
+	t.Helper()
+	schema, err := schemafile.Load("internal/example/order.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return schema
+}
+
+// TestGenerate makes sure that code of example package, which is compiled along with the module,
+// is generated by current version of Generate
+func TestGenerate(t *testing.T) {
+	src, err := Generate(loadSchema(t), Options{Package: "example", Source: "order.yaml"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := os.ReadFile("internal/example/order_fsm.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(src, expected) {
+		t.Errorf("example package is outdated, run go generate ./...; generated code:\n%s", src)
+	}
+}
+
+func TestGenerate_example(t *testing.T) {
+	// constants have expected types, otherwise example package wouldn't compile
+	var (
+		states = []example.State{example.StateNew, example.StateAwaitingPayment, example.StatePaid, example.ChoiceCheck}
+		events = []core.Event{example.EventSubmit, example.EventPay, example.EventExpire}
+		names  = []string{example.ConditionHasItems, example.ConditionIsPaid, example.ActionCharge, example.ActionNotify}
+	)
+
+	if !reflect.DeepEqual(states, []example.State{"new", "awaiting_payment", "paid", "check"}) ||
+		!reflect.DeepEqual(events, []core.Event{"submit", "pay", "expire"}) ||
+		!reflect.DeepEqual(names, []string{"has-items", "isPaid", "charge", "notify"}) {
+		t.Errorf("unexpected values of constants: %v, %v, %v", states, events, names)
+	}
+
+	conditions := reflect.TypeOf((*example.Conditions)(nil)).Elem()
+	actions := reflect.TypeOf((*example.Actions)(nil)).Elem()
+	if conditions.NumMethod() != 2 || actions.NumMethod() != 2 {
+		t.Errorf("expected 2 conditions and 2 actions in interfaces, got %d and %d", conditions.NumMethod(), actions.NumMethod())
+	}
+}
+
+func TestGenerate_withoutConditionsAndActions(t *testing.T) {
+	src, err := Generate(core.Schema{
+		Name:        "ab",
+		States:      []core.State{{Name: "a"}, {Name: "b"}},
+		Transitions: []core.Transition{{From: "a", To: "b", Event: "go"}},
+	}, Options{Package: "ab"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := parser.ParseFile(token.NewFileSet(), "ab_fsm.go", src, parser.ImportsOnly)
+	if err != nil {
+		t.Fatalf("generated code doesn't parse: %v\n%s", err, src)
+	}
+	// unused import of context wouldn't compile
+	for _, spec := range file.Imports {
+		if path, _ := strconv.Unquote(spec.Path.Value); path != "github.com/estambakio/go-fsm/pkg/core" {
+			t.Errorf("expected only core to be imported, got %s", path)
+		}
+	}
+}
+
+func TestGenerate_errors(t *testing.T) {
+	schema := loadSchema(t)
+
+	invalid := schema
+	invalid.Transitions = append([]core.Transition{{From: "new", To: "unknown", Event: "e"}}, schema.Transitions...)
+	if _, err := Generate(invalid, Options{Package: "orders"}); err == nil {
+		t.Error("expected error for invalid schema")
+	}
+
+	colliding := schema
+	colliding.States = append([]core.State{{Name: "awaiting-payment"}}, schema.States...)
+	if _, err := Generate(colliding, Options{Package: "orders"}); err == nil {
+		t.Error("expected error for names producing the same identifier")
+	}
+
+	if _, err := Generate(schema, Options{Package: "my-orders"}); err == nil {
+		t.Error("expected error for invalid package name")
+	}
+}
+
+func TestIdentifier(t *testing.T) {
+	tests := map[string]string{
+		"new":              "New",
+		"awaiting_payment": "AwaitingPayment",
+		"a->b":             "AB",
+		"hasTotal":         "HasTotal",
+		"1st":              "X1st",
+		"":                 "X",
+	}
+	for in, expected := range tests {
+		if out := Identifier(in); out != expected {
+			t.Errorf("Identifier(%q): expected %s, got %s", in, expected, out)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+// Package example contains code generated by fsm-gen from order.yaml. It's compiled along with the module,
+// so that generated code is type checked, and codegen tests make sure it's up to date.
+package example
+
+//go:generate go run github.com/estambakio/go-fsm/cmd/fsm-gen -schema order.yaml
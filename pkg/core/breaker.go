@@ -0,0 +1,166 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is matched by errors of actions which are not called because their circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitBreaker makes action fail fast with ErrCircuitOpen after Threshold consecutive failures, so that
+// SendEvent doesn't wait for a broken dependency. After Cooldown one trial call is let through: breaker is
+// closed if it succeeds and opened again otherwise. Breakers are passed to NewMachine, one per action name,
+// and shared by all transitions which perform the action.
+type CircuitBreaker struct {
+	Action    string
+	Threshold int
+	Cooldown  time.Duration
+}
+
+// BreakerState is a state of circuit breaker
+type BreakerState int
+
+const (
+	// BreakerClosed lets all calls through
+	BreakerClosed BreakerState = iota
+	// BreakerOpen rejects all calls until cooldown passes
+	BreakerOpen
+	// BreakerHalfOpen lets a single trial call through. Breaker is reported open while trial call is in progress.
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+// BreakerStatus describes circuit breaker of action, see Machine.BreakerStatus
+type BreakerStatus struct {
+	State BreakerState
+	// Failures is a number of consecutive failures of action
+	Failures int
+	// OpenedAt is a time when breaker was opened last time, zero if it has never been opened
+	OpenedAt time.Time
+}
+
+// breaker is a state of CircuitBreaker shared by copies of machine
+type breaker struct {
+	config CircuitBreaker
+	clock  Clock
+
+	mu       sync.Mutex
+	failures int
+	open     bool
+	openedAt time.Time
+	// trial is true while trial call of half-open breaker is in progress
+	trial bool
+	// generation is incremented whenever breaker is opened or closed, results of calls
+	// allowed in previous generations are ignored
+	generation uint64
+}
+
+// permit is given by allow to a call and passed back to record with its result
+type permit struct {
+	generation uint64
+	trial      bool
+}
+
+func newBreaker(config CircuitBreaker, clock Clock) *breaker {
+	return &breaker{config: config, clock: clock}
+}
+
+// status returns status of breaker, open breaker is reported as half-open after cooldown
+// until trial call is allowed
+func (b *breaker) status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	s := BreakerStatus{State: BreakerClosed, Failures: b.failures, OpenedAt: b.openedAt}
+	if b.open {
+		s.State = BreakerOpen
+		if b.halfOpen() {
+			s.State = BreakerHalfOpen
+		}
+	}
+	return s
+}
+
+// halfOpen reports whether open breaker lets trial call through, mu must be held
+func (b *breaker) halfOpen() bool {
+	return !b.trial && b.clock.Now().Sub(b.openedAt) >= b.config.Cooldown
+}
+
+// allow reports whether action can be called and returns permit of the call
+func (b *breaker) allow() (permit, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.open {
+		return permit{generation: b.generation}, true
+	}
+	if !b.halfOpen() {
+		return permit{}, false
+	}
+	b.trial = true
+	return permit{generation: b.generation, trial: true}, true
+}
+
+// record updates breaker with result of call allowed by p
+func (b *breaker) record(p permit, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if p.generation != b.generation {
+		// call was allowed before breaker was opened or closed, its result is outdated
+		return
+	}
+	if p.trial {
+		b.trial = false
+	}
+	if err == nil {
+		b.failures = 0
+		if b.open {
+			b.open = false
+			b.generation++
+		}
+		return
+	}
+	b.failures++
+	if b.open || b.failures >= b.config.Threshold {
+		b.open = true
+		b.openedAt = b.clock.Now()
+		b.generation++
+	}
+}
+
+// call calls action if breaker allows it and records its result
+func (b *breaker) call(ctx context.Context, call func(context.Context) ActionResult) ActionResult {
+	p, ok := b.allow()
+	if !ok {
+		return ActionResult{Name: b.config.Action, Err: fmt.Errorf("action '%s': %w", b.config.Action, ErrCircuitOpen)}
+	}
+	result := call(ctx)
+	b.record(p, result.Err)
+	return result
+}
+
+// BreakerStatus returns status of circuit breaker of action, false if action doesn't have circuit breaker
+func (m *Machine) BreakerStatus(action string) (BreakerStatus, bool) {
+	b, ok := m.breakers[action]
+	if !ok {
+		return BreakerStatus{}, false
+	}
+	return b.status(), true
+}
@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newBreakerDefinition(t *testing.T, f func(ctx context.Context) error, def ActionDefinition) *MachineDefinition {
+	md, err := NewMachineDefinition(
+		Schema{
+			InitialState: State{Name: "a"},
+			States:       []State{{Name: "a"}, {Name: "b"}},
+			Transitions:  []Transition{{From: "a", To: "b", Event: "go", Actions: []ActionDefinition{def}}},
+		},
+		[]Action{{Name: "call", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+			return ActionResult{Name: "call", Err: f(ctx)}
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return md
+}
+
+func TestMachine_SendEvent_actionTimeout(t *testing.T) {
+	md := newBreakerDefinition(t, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}, ActionDefinition{Name: "call", Timeout: 10 * time.Millisecond})
+
+	object := &obj{status: "a"}
+	_, err := NewMachine(context.Background(), md).SendEvent(object, "go")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected action to be interrupted by timeout, got %v", err)
+	}
+	if object.status != "a" {
+		t.Errorf("expected status to stay the same, got %s", object.status)
+	}
+}
+
+func TestMachine_BreakerStatus(t *testing.T) {
+	var calls int
+	var fail bool
+	md := newBreakerDefinition(t, func(ctx context.Context) error {
+		calls++
+		if fail {
+			return errors.New("failed")
+		}
+		return nil
+	}, ActionDefinition{Name: "call", Retry: RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}})
+
+	clock := newFakeClock()
+	machine := NewMachine(context.Background(), md, clock, CircuitBreaker{Action: "call", Threshold: 2, Cooldown: time.Minute})
+
+	send := func() error {
+		_, err := machine.SendEvent(&obj{status: "a"}, "go")
+		return err
+	}
+	status := func() BreakerStatus {
+		s, ok := machine.BreakerStatus("call")
+		if !ok {
+			t.Fatal("expected circuit breaker of action")
+		}
+		return s
+	}
+
+	if _, ok := machine.BreakerStatus("unknown"); ok {
+		t.Error("expected no circuit breaker of unknown action")
+	}
+
+	// breaker opens after consecutive failures and open breaker isn't retried
+	fail = true
+	if err := send(); err == nil || !errors.Is(err, ErrCircuitOpen) {
+		t.Errorf("expected action to fail fast on the third attempt, got %v", err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls of action, got %d", calls)
+	}
+	if s := status(); s.State != BreakerOpen || s.Failures != 2 || !s.OpenedAt.Equal(clock.Now()) {
+		t.Errorf("expected open breaker, got %+v", s)
+	}
+
+	// breaker lets a trial call through after cooldown and opens again if it fails
+	clock.Advance(time.Minute)
+	if s := status(); s.State != BreakerHalfOpen {
+		t.Errorf("expected half-open breaker, got %+v", s)
+	}
+	calls = 0
+	if err := send(); !errors.Is(err, ErrCircuitOpen) || calls != 1 {
+		t.Errorf("expected a single trial call, got %d calls and %v", calls, err)
+	}
+	if s := status(); s.State != BreakerOpen || s.Failures != 3 || !s.OpenedAt.Equal(clock.Now()) {
+		t.Errorf("expected breaker to open again, got %+v", s)
+	}
+
+	// successful trial call closes breaker
+	clock.Advance(time.Minute)
+	fail = false
+	if err := send(); err != nil {
+		t.Fatal(err)
+	}
+	if s := status(); s.State != BreakerClosed || s.Failures != 0 {
+		t.Errorf("expected closed breaker, got %+v", s)
+	}
+	if s := status(); s.State.String() != "closed" {
+		t.Errorf("unexpected string of state %s", s.State)
+	}
+
+	// copy of machine shares breakers
+	if _, ok := machine.WithContext(context.Background()).BreakerStatus("call"); !ok {
+		t.Error("expected copy of machine to have circuit breaker")
+	}
+}
+
+func TestNewMachine_invalidCircuitBreaker(t *testing.T) {
+	md := newBreakerDefinition(t, func(ctx context.Context) error { return nil }, ActionDefinition{Name: "call"})
+
+	for _, breakers := range [][]interface{}{
+		{CircuitBreaker{Action: "unknown", Threshold: 1, Cooldown: time.Second}},
+		{CircuitBreaker{Action: "call", Cooldown: time.Second}},
+		{CircuitBreaker{Action: "call", Threshold: 1}},
+		{CircuitBreaker{Action: "call", Threshold: 1, Cooldown: time.Second}, CircuitBreaker{Action: "call", Threshold: 2, Cooldown: time.Second}},
+	} {
+		if _, err := NewMachineWithOptions(context.Background(), md, breakers...); err == nil {
+			t.Errorf("expected error for %v", breakers)
+		}
+	}
+}
+
+func TestBreaker_staleCall(t *testing.T) {
+	clock := newFakeClock()
+	b := newBreaker(CircuitBreaker{Action: "call", Threshold: 1, Cooldown: time.Minute}, clock)
+
+	// slow calls block until released, result is sent to done
+	slowCall := func(err error) (release chan struct{}, done chan ActionResult) {
+		started := make(chan struct{})
+		release, done = make(chan struct{}), make(chan ActionResult)
+		go func() {
+			done <- b.call(context.Background(), func(ctx context.Context) ActionResult {
+				close(started)
+				<-release
+				return ActionResult{Name: "call", Err: err}
+			})
+		}()
+		<-started
+		return release, done
+	}
+	failed := func(ctx context.Context) ActionResult {
+		return ActionResult{Name: "call", Err: errors.New("failed")}
+	}
+
+	// call started while breaker is closed straddles opening and cooldown
+	staleRelease, staleDone := slowCall(nil)
+	b.call(context.Background(), failed)
+	clock.Advance(time.Minute)
+	if s := b.status(); s.State != BreakerHalfOpen {
+		t.Errorf("expected half-open breaker, got %+v", s)
+	}
+
+	trialRelease, trialDone := slowCall(errors.New("failed"))
+	if s := b.status(); s.State != BreakerOpen {
+		t.Errorf("expected breaker to be reported open while trial call is in progress, got %+v", s)
+	}
+
+	// result of stale call neither closes breaker nor finishes trial
+	close(staleRelease)
+	if r := <-staleDone; r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if s := b.status(); s.State != BreakerOpen || s.Failures != 1 {
+		t.Errorf("expected stale call to be ignored, got %+v", s)
+	}
+	if r := b.call(context.Background(), failed); !errors.Is(r.Err, ErrCircuitOpen) {
+		t.Errorf("expected call to be rejected while trial call is in progress, got %v", r.Err)
+	}
+
+	// failed trial call opens breaker again
+	clock.Advance(time.Second)
+	close(trialRelease)
+	<-trialDone
+	if s := b.status(); s.State != BreakerOpen || s.Failures != 2 || !s.OpenedAt.Equal(clock.Now()) {
+		t.Errorf("expected breaker to open again, got %+v", s)
+	}
+}
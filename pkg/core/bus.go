@@ -0,0 +1,169 @@
+package core
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// TransitionEvent is a notification about transition performed by Machine.SendEvent
+type TransitionEvent struct {
+	// Machine is a name of machine's schema
+	Machine string
+	// ObjectID is set if object implements Identifiable
+	ObjectID string
+	From     string
+	To       string
+	Event    Event
+	// Actor is a value attached to context of machine by WithActor
+	Actor string
+	Time  time.Time
+	// Results of actions performed in transition
+	Results []ActionResult
+}
+
+// Filter narrows down notifications received by subscriber. Empty field matches everything,
+// otherwise notification should match one of its values.
+type Filter struct {
+	From   []string
+	To     []string
+	Events []Event
+}
+
+func (f Filter) match(e TransitionEvent) bool {
+	return matchString(f.From, e.From) && matchString(f.To, e.To) && matchEvent(f.Events, e.Event)
+}
+
+func matchString(values []string, v string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+func matchEvent(values []Event, v Event) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
+
+// Bus is an in-process publish/subscribe of transition notifications. Machine publishes to Bus
+// passed to NewMachine after each successful transition.
+//
+// Delivery doesn't block publisher: every subscriber has a buffer and notifications which don't fit
+// into it are dropped and counted.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription receives notifications from Bus through channel C until it's unsubscribed
+type Subscription struct {
+	// C is closed by Unsubscribe
+	C <-chan TransitionEvent
+
+	bus     *Bus
+	c       chan TransitionEvent
+	filter  Filter
+	dropped uint64
+	once    sync.Once
+	// overflow is closed on first dropped notification
+	overflow     chan struct{}
+	overflowOnce sync.Once
+}
+
+// NewBus returns bus without subscribers
+func NewBus() *Bus {
+	return &Bus{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe returns subscription which receives notifications matching filter.
+// Buffer is a number of notifications which can wait for receiver.
+func (b *Bus) Subscribe(filter Filter, buffer int) (*Subscription, error) {
+	if buffer <= 0 {
+		return nil, fmt.Errorf("buffer of subscription must be positive, got %d", buffer)
+	}
+
+	c := make(chan TransitionEvent, buffer)
+	s := &Subscription{C: c, bus: b, c: c, filter: filter, overflow: make(chan struct{})}
+
+	b.mu.Lock()
+	b.subs[s] = struct{}{}
+	b.mu.Unlock()
+
+	return s, nil
+}
+
+// Publish delivers notification to matching subscribers without blocking
+func (b *Bus) Publish(e TransitionEvent) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for s := range b.subs {
+		if !s.filter.match(e) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			atomic.AddUint64(&s.dropped, 1)
+			s.overflowOnce.Do(func() { close(s.overflow) })
+		}
+	}
+}
+
+// Unsubscribe stops delivery and closes C. It's safe to call it several times.
+func (s *Subscription) Unsubscribe() {
+	s.once.Do(func() {
+		s.bus.mu.Lock()
+		delete(s.bus.subs, s)
+		s.bus.mu.Unlock()
+		close(s.c)
+	})
+}
+
+// Dropped returns number of notifications which were dropped because buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return atomic.LoadUint64(&s.dropped)
+}
+
+// Overflow returns channel which is closed when first notification is dropped, so that subscriber
+// which can't tolerate gaps learns about them without waiting for next notification.
+func (s *Subscription) Overflow() <-chan struct{} {
+	return s.overflow
+}
+
+// publish sends notification about transition to machine's bus, if any
+func (m *Machine) publish(info TransitionInfo) {
+	if m.bus != nil {
+		m.bus.Publish(m.transitionEvent(info))
+	}
+}
+
+// transitionEvent returns notification about transition
+func (m *Machine) transitionEvent(info TransitionInfo) TransitionEvent {
+	id, _ := objectID(info.Object)
+	actor, _ := ActorFrom(m.ctx)
+	return TransitionEvent{
+		Machine:  m.md.Schema.Name,
+		ObjectID: id,
+		From:     info.From,
+		To:       info.To,
+		Event:    info.Event,
+		Actor:    actor,
+		Time:     m.clock.Now(),
+		Results:  append([]ActionResult(nil), info.Results...),
+	}
+}
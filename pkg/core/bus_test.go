@@ -0,0 +1,124 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+
+	if _, err := bus.Subscribe(Filter{}, 0); err == nil {
+		t.Error("expected error for empty buffer")
+	}
+
+	all, _ := bus.Subscribe(Filter{}, 10)
+	toDone, _ := bus.Subscribe(Filter{To: []string{"done"}}, 10)
+	byEvent, _ := bus.Subscribe(Filter{From: []string{"a", "b"}, Events: []Event{"go"}}, 1)
+
+	events := []TransitionEvent{
+		{From: "a", To: "b", Event: "go"},
+		{From: "b", To: "done", Event: "finish"},
+		{From: "b", To: "c", Event: "go"},
+	}
+	for _, e := range events {
+		bus.Publish(e)
+	}
+
+	receive := func(s *Subscription) []TransitionEvent {
+		var received []TransitionEvent
+		for {
+			select {
+			case e := <-s.C:
+				received = append(received, e)
+			default:
+				return received
+			}
+		}
+	}
+
+	if received := receive(all); !reflect.DeepEqual(received, events) {
+		t.Errorf("expected %v, got %v", events, received)
+	}
+	if received := receive(toDone); !reflect.DeepEqual(received, events[1:2]) {
+		t.Errorf("expected %v, got %v", events[1:2], received)
+	}
+	// the second matching event doesn't fit into buffer
+	if received := receive(byEvent); !reflect.DeepEqual(received, events[:1]) || byEvent.Dropped() != 1 {
+		t.Errorf("expected %v with 1 dropped, got %v with %d dropped", events[:1], received, byEvent.Dropped())
+	}
+	select {
+	case <-byEvent.Overflow():
+	default:
+		t.Error("expected overflow to be signalled after drop")
+	}
+	select {
+	case <-all.Overflow():
+		t.Error("expected no overflow without drops")
+	default:
+	}
+
+	all.Unsubscribe()
+	all.Unsubscribe()
+	if _, ok := <-all.C; ok {
+		t.Error("expected channel to be closed")
+	}
+	bus.Publish(events[0])
+}
+
+func TestMachine_SendEvent_bus(t *testing.T) {
+	md, err := NewMachineDefinition(
+		Schema{
+			Name:         "order",
+			InitialState: State{Name: "a"},
+			States:       []State{{Name: "a"}, {Name: "b"}},
+			Transitions:  []Transition{{From: "a", To: "b", Event: "go", Actions: []ActionDefinition{{Name: "ok"}}}},
+		},
+		[]Action{{Name: "ok", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+			return ActionResult{Name: "ok", Output: 42}
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bus := NewBus()
+	s, _ := bus.Subscribe(Filter{}, 10)
+	clock := newFakeClock()
+
+	machine := NewMachine(context.Background(), md, bus, Clock(clock))
+	if machine.Bus() != bus {
+		t.Error("expected machine to return its bus")
+	}
+	object := &obj{id: "1"}
+	machine.Start(object)
+
+	// failed transitions are not published
+	machine.SendEvent(object, "unknown")
+	if _, err := machine.WithContext(WithActor(context.Background(), "bob")).SendEvent(object, "go"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := TransitionEvent{
+		Machine:  "order",
+		ObjectID: "1",
+		From:     "a",
+		To:       "b",
+		Event:    "go",
+		Actor:    "bob",
+		Time:     clock.Now(),
+		Results:  []ActionResult{{Name: "ok", Output: 42}},
+	}
+	select {
+	case e := <-s.C:
+		if !reflect.DeepEqual(e, expected) {
+			t.Errorf("expected %+v, got %+v", expected, e)
+		}
+	default:
+		t.Fatal("expected notification")
+	}
+	if len(s.C) != 0 {
+		t.Error("expected single notification")
+	}
+}
@@ -0,0 +1,17 @@
+package core
+
+import "time"
+
+// Clock is a source of current time. It can be replaced in tests to control time deterministically.
+type Clock interface {
+	Now() time.Time
+}
+
+// SystemClock is a Clock which returns real time
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
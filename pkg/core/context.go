@@ -0,0 +1,31 @@
+package core
+
+import "context"
+
+type payloadKey struct{}
+
+// WithPayload returns context which carries payload of event, e.g. request body.
+// Guards and actions can read it with PayloadFrom if the context is passed to Machine.WithContext.
+func WithPayload(ctx context.Context, payload interface{}) context.Context {
+	return context.WithValue(ctx, payloadKey{}, payload)
+}
+
+// PayloadFrom returns payload of event attached to context by WithPayload
+func PayloadFrom(ctx context.Context) (interface{}, bool) {
+	payload := ctx.Value(payloadKey{})
+	return payload, payload != nil
+}
+
+type actorKey struct{}
+
+// WithActor returns context which carries identity of user or system which sends event.
+// Machine includes it into TransitionEvent if the context is passed to Machine.WithContext.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns actor attached to context by WithActor
+func ActorFrom(ctx context.Context) (string, bool) {
+	actor, ok := ctx.Value(actorKey{}).(string)
+	return actor, ok
+}
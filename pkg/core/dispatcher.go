@@ -0,0 +1,186 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrDispatcherClosed is returned for events submitted to closed Dispatcher
+// and for deferred events which were still pending when Dispatcher was closed
+var ErrDispatcherClosed = errors.New("dispatcher is closed")
+
+// DispatchResult is a result of event processed by Dispatcher
+type DispatchResult struct {
+	Event   Event
+	Results []ActionResult
+	Err     error
+}
+
+// Dispatcher serializes events sent to the same object: every object has a mailbox identified by
+// its ID and events from the mailbox are passed to Machine.SendEvent one by one in order of submission.
+// Events for different objects are processed concurrently.
+//
+// Events which are not acceptable in object's current state can be deferred instead of being rejected:
+// they are kept aside and retried in order of submission after each successful transition of the object.
+//
+// Objects must implement Identifiable. Object passed along with event is the one which transition
+// is performed on, so submitters should share the same instance for the same ID.
+type Dispatcher struct {
+	m          *Machine
+	deferrable map[Event]bool
+
+	mu        sync.Mutex
+	mailboxes map[string]*mailbox
+	closed    bool
+	wg        sync.WaitGroup
+}
+
+// mailbox keeps pending events of a single object
+type mailbox struct {
+	queue    []*envelope
+	deferred []*envelope
+	// running is true while there is a goroutine processing the queue
+	running bool
+}
+
+type envelope struct {
+	o    Object
+	e    Event
+	done chan DispatchResult
+}
+
+// NewDispatcher returns dispatcher for machine. Optional args: []Event - events which are deferred
+// if they are not acceptable in object's current state.
+func NewDispatcher(m *Machine, args ...interface{}) (*Dispatcher, error) {
+	d := &Dispatcher{
+		m:          m,
+		deferrable: make(map[Event]bool),
+		mailboxes:  make(map[string]*mailbox),
+	}
+
+	// handle variadic optional args based on passed types
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case []Event:
+			for _, e := range arg {
+				d.deferrable[e] = true
+			}
+		default:
+			return nil, fmt.Errorf("unknown type %T, value %v in NewDispatcher call", arg, arg)
+		}
+	}
+
+	return d, nil
+}
+
+// Submit sends event to object and waits until it's processed or context is cancelled.
+// Cancelled context doesn't withdraw the event, it's still processed in its turn.
+func (d *Dispatcher) Submit(ctx context.Context, o Object, e Event) ([]ActionResult, error) {
+	select {
+	case r := <-d.SubmitAsync(o, e):
+		return r.Results, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SubmitAsync sends event to object and returns channel which receives result when event is processed.
+// Channel is buffered, so it's not required to read from it.
+func (d *Dispatcher) SubmitAsync(o Object, e Event) <-chan DispatchResult {
+	done := make(chan DispatchResult, 1)
+
+	id, err := objectID(o)
+	if err != nil {
+		done <- DispatchResult{Event: e, Err: err}
+		return done
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		done <- DispatchResult{Event: e, Err: ErrDispatcherClosed}
+		return done
+	}
+
+	mb, ok := d.mailboxes[id]
+	if !ok {
+		mb = &mailbox{}
+		d.mailboxes[id] = mb
+	}
+	mb.queue = append(mb.queue, &envelope{o: o, e: e, done: done})
+
+	if !mb.running {
+		mb.running = true
+		d.wg.Add(1)
+		go d.process(id, mb)
+	}
+
+	return done
+}
+
+// process handles events from mailbox until it's empty
+func (d *Dispatcher) process(id string, mb *mailbox) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		if len(mb.queue) == 0 {
+			mb.running = false
+			if len(mb.deferred) == 0 {
+				delete(d.mailboxes, id)
+			}
+			d.mu.Unlock()
+			return
+		}
+		env := mb.queue[0]
+		mb.queue = mb.queue[1:]
+		d.mu.Unlock()
+
+		results, err := d.m.SendEvent(env.o, env.e)
+
+		if errors.Is(err, ErrNoTransition) && d.deferrable[env.e] {
+			d.mu.Lock()
+			if d.closed {
+				d.mu.Unlock()
+				env.done <- DispatchResult{Event: env.e, Err: fmt.Errorf("%w: event '%s' was deferred", ErrDispatcherClosed, env.e)}
+				continue
+			}
+			mb.deferred = append(mb.deferred, env)
+			d.mu.Unlock()
+			continue
+		}
+
+		env.done <- DispatchResult{Event: env.e, Results: results, Err: err}
+
+		if err == nil {
+			// object could move to a state where deferred events are acceptable,
+			// retry them before the rest of queue preserving order of submission
+			d.mu.Lock()
+			mb.queue = append(mb.deferred, mb.queue...)
+			mb.deferred = nil
+			d.mu.Unlock()
+		}
+	}
+}
+
+// Close stops accepting new events and waits until all submitted events are processed.
+// Deferred events which are still pending receive ErrDispatcherClosed.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	d.closed = true
+	d.mu.Unlock()
+
+	d.wg.Wait()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, mb := range d.mailboxes {
+		for _, env := range mb.deferred {
+			env.done <- DispatchResult{Event: env.e, Err: fmt.Errorf("%w: event '%s' was deferred", ErrDispatcherClosed, env.e)}
+		}
+		delete(d.mailboxes, id)
+	}
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// counter is an object with business data which is modified by actions without synchronization
+type counter struct {
+	obj
+	value int
+}
+
+func TestDispatcher(t *testing.T) {
+	md, err := NewMachineDefinition(Schema{
+		States: []State{State{Name: "a"}, State{Name: "b"}, State{Name: "c"}},
+		Transitions: []Transition{
+			Transition{From: "a", To: "b", Event: "a->b"},
+			Transition{From: "b", To: "c", Event: "b->c"},
+			Transition{From: AnyState, Internal: true, Event: "inc", Actions: []ActionDefinition{ActionDefinition{Name: "inc"}}},
+		},
+	}, []Action{
+		Action{
+			Name: "inc",
+			F: func(ctx context.Context, o Object, params []Param, prev []ActionResult) ActionResult {
+				c := o.(*counter)
+				v := c.value
+				time.Sleep(time.Microsecond)
+				c.value = v + 1
+				return ActionResult{Name: "inc", Output: c.value}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := NewMachine(context.Background(), md)
+	ctx := context.Background()
+
+	if _, err := NewDispatcher(machine, "unknown"); err == nil {
+		t.Error("expected error for unknown arg")
+	}
+
+	d, err := NewDispatcher(machine, []Event{"b->c"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := d.Submit(ctx, struct{ Object }{&obj{}}, "a->b"); err == nil {
+		t.Error("expected error for object without identity")
+	}
+	if _, err := d.Submit(ctx, &obj{status: "a"}, "a->b"); err == nil {
+		t.Error("expected error for object with empty ID")
+	}
+
+	// concurrent events for the same object are serialized
+	object := &counter{obj: obj{id: "1", status: "a"}}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := d.Submit(ctx, object, "inc"); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if object.value != 50 {
+		t.Errorf("expected 50 increments, got %d", object.value)
+	}
+
+	// events are processed in order of submission
+	var results []<-chan DispatchResult
+	for _, e := range []Event{"inc", "a->b", "inc", "b->c", "inc"} {
+		results = append(results, d.SubmitAsync(object, e))
+	}
+	for i, ch := range results {
+		r := <-ch
+		if r.Err != nil {
+			t.Errorf("event %d (%s) failed: %v", i, r.Event, r.Err)
+		}
+	}
+	if object.Status() != "c" || object.value != 53 {
+		t.Errorf("expected status 'c' and 53 increments, got %s and %d", object.Status(), object.value)
+	}
+
+	// non-deferrable event which is not acceptable is rejected
+	if _, err := d.Submit(ctx, object, "a->b"); !errors.Is(err, ErrNoTransition) {
+		t.Errorf("expected ErrNoTransition, got %v", err)
+	}
+
+	// deferrable event waits until object reaches a state where it's acceptable
+	object = &counter{obj: obj{id: "2", status: "a"}}
+	deferred := d.SubmitAsync(object, "b->c")
+	select {
+	case r := <-deferred:
+		t.Fatalf("expected event to be deferred, got %v", r)
+	case <-time.After(10 * time.Millisecond):
+	}
+	if _, err := d.Submit(ctx, object, "a->b"); err != nil {
+		t.Fatal(err)
+	}
+	if r := <-deferred; r.Err != nil || object.Status() != "c" {
+		t.Errorf("expected deferred event to be performed, got %v and status %s", r, object.Status())
+	}
+
+	// closing dispatcher completes events which are still deferred
+	object = &counter{obj: obj{id: "3", status: "a"}}
+	deferred = d.SubmitAsync(object, "b->c")
+	time.Sleep(10 * time.Millisecond)
+	d.Close()
+	if r := <-deferred; !errors.Is(r.Err, ErrDispatcherClosed) {
+		t.Errorf("expected ErrDispatcherClosed for deferred event, got %v", r)
+	}
+	if _, err := d.Submit(ctx, object, "a->b"); !errors.Is(err, ErrDispatcherClosed) {
+		t.Errorf("expected ErrDispatcherClosed, got %v", err)
+	}
+
+	// context cancellation doesn't block submitter
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	d, _ = NewDispatcher(machine, []Event{"b->c"})
+	if _, err := d.Submit(cancelled, &counter{obj: obj{id: "4", status: "a"}}, "b->c"); err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+	d.Close()
+}
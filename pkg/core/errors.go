@@ -0,0 +1,58 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrNoTransition is returned by SendEvent when there is no transition available for event
+var ErrNoTransition = errors.New("no transition available")
+
+// ErrObjectNotFound should be returned by Repository if object doesn't exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ErrStatusConflict is matched by StatusConflictError with errors.Is
+var ErrStatusConflict = errors.New("object was modified concurrently")
+
+// StatusConflictError is returned by SendEvent when object implements StatusSwapper and it was modified
+// concurrently while transition was performed. Caller should reload object and retry.
+type StatusConflictError struct {
+	Event Event
+	// Expected is a status which object had when transition started
+	Expected string
+	// Target is a status which transition tried to set
+	Target string
+	// Actual is a status of object after failed compare-and-set. StatusSwapper may set it to status found
+	// in storage, otherwise it's the same as Expected.
+	Actual string
+}
+
+func (e *StatusConflictError) Error() string {
+	if e.Actual != e.Expected {
+		return fmt.Sprintf("%v: failed to set status '%s' expecting '%s' for event '%s', object has status '%s'",
+			ErrStatusConflict, e.Target, e.Expected, e.Event, e.Actual)
+	}
+	return fmt.Sprintf("%v: failed to set status '%s' expecting '%s' for event '%s'", ErrStatusConflict, e.Target, e.Expected, e.Event)
+}
+
+// Is makes StatusConflictError match ErrStatusConflict
+func (e *StatusConflictError) Is(target error) bool {
+	return target == ErrStatusConflict
+}
+
+// TransitionConflictError is returned by SendEvent when several transitions are available for event
+// and MachineDefinition's ConflictResolution can't choose one of them.
+type TransitionConflictError struct {
+	State string
+	Event Event
+	// Transitions which compete for the event, in order of declaration
+	Transitions []Transition
+}
+
+func (e *TransitionConflictError) Error() string {
+	targets := make([]string, len(e.Transitions))
+	for i, t := range e.Transitions {
+		targets[i] = fmt.Sprintf("%s->%s (priority %d)", t.From, t.To, t.Priority)
+	}
+	return fmt.Sprintf("%d transitions compete for event '%s' in state '%s': %v", len(e.Transitions), e.Event, e.State, targets)
+}
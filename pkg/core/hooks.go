@@ -0,0 +1,171 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// ErrVetoed is matched by errors returned by SendEvent when a hook rejects transition
+var ErrVetoed = errors.New("transition is vetoed")
+
+// TransitionInfo describes transition in progress for hooks
+type TransitionInfo struct {
+	// Machine is a name of machine's schema
+	Machine string
+	Object  Object
+	Event   Event
+	// From is a status of object when event was sent
+	From string
+	// Transition is a transition chosen for event; it's empty in BeforeGuard hooks
+	Transition Transition
+	// To is a target state: a name of choice in BeforeTransition if target is picked by choice
+	// after transition actions, a new status of object in AfterTransition
+	To string
+	// Results of actions, available in AfterTransition and OnError hooks; if action fails then its result is the last one
+	Results []ActionResult
+	// Err is an error returned by SendEvent, available in OnError hooks
+	Err error
+}
+
+// Hooks are called by Machine.SendEvent around every transition, e.g. for logging, authorization or metrics.
+// All of them are optional. Machine can have several Hooks: they are called in order of NewMachine args
+// and BeforeGuard/BeforeTransition stop at the first hook which returns error.
+type Hooks struct {
+	// BeforeGuard is called before guards are evaluated. Error vetoes transition.
+	BeforeGuard func(ctx context.Context, info TransitionInfo) error
+	// BeforeTransition is called when transition is chosen, before any action is performed. Error vetoes transition.
+	BeforeTransition func(ctx context.Context, info TransitionInfo) error
+	// AfterTransition is called after status of object is set, for pending transition it's called by Machine.Complete
+	AfterTransition func(ctx context.Context, info TransitionInfo)
+	// OnError is called if SendEvent fails, including vetoes by hooks, or pending transition fails
+	OnError func(ctx context.Context, info TransitionInfo)
+
+	// AroundCall wraps SendEvent, AvailableTransitions (Can and ResolveTransition included), Complete and Fail.
+	// It must call next with context which replaces machine's context for the call: guards, actions and other
+	// hooks receive it. SendEvent calls AvailableTransitions, so the latter is nested.
+	AroundCall func(ctx context.Context, info CallInfo, next func(context.Context) error) error
+	// AroundGuard wraps evaluation of every guard by SendEvent, AvailableTransitions and Can, guards of
+	// choice branches included. It must call next with context for Condition.F and return its result,
+	// which already takes Guard.Negate into account. Guards are evaluated concurrently,
+	// so AroundGuard must be safe for concurrent use.
+	AroundGuard func(ctx context.Context, info GuardInfo, next func(context.Context) bool) bool
+	// AroundAction wraps every action call. It must call next with context for Action.F and return its result.
+	AroundAction func(ctx context.Context, info ActionInfo, next func(context.Context) ActionResult) ActionResult
+}
+
+// CallInfo describes call of Machine's method
+type CallInfo struct {
+	// Machine is a name of machine's schema
+	Machine string
+	// Method is "SendEvent", "AvailableTransitions", "Complete" or "Fail"
+	Method string
+	Object Object
+	// Event is empty if AvailableTransitions is called without event
+	Event Event
+}
+
+// GuardInfo describes guard evaluated by machine
+type GuardInfo struct {
+	// Machine is a name of machine's schema
+	Machine string
+	Object  Object
+	Guard   Guard
+}
+
+// ActionInfo describes action performed by machine
+type ActionInfo struct {
+	// Machine is a name of machine's schema
+	Machine string
+	Object  Object
+	Event   Event
+	Action  ActionDefinition
+}
+
+// machineCall, guardCall and actionCall are signatures of AroundCall, AroundGuard and AroundAction hooks
+type machineCall func(ctx context.Context, info CallInfo, next func(context.Context) error) error
+type guardCall func(ctx context.Context, info GuardInfo, next func(context.Context) bool) bool
+type actionCall func(ctx context.Context, info ActionInfo, next func(context.Context) ActionResult) ActionResult
+
+// composeHooks chains AroundCall, AroundGuard and AroundAction hooks so that the first hook is the outermost one.
+// It returns nil functions if there are no such hooks.
+func composeHooks(hooks []Hooks) (machineCall, guardCall, actionCall) {
+	var call machineCall
+	var guard guardCall
+	var action actionCall
+
+	for i := len(hooks) - 1; i >= 0; i-- {
+		if h := hooks[i].AroundCall; h != nil {
+			if inner := call; inner == nil {
+				call = h
+			} else {
+				call = func(ctx context.Context, info CallInfo, next func(context.Context) error) error {
+					return h(ctx, info, func(ctx context.Context) error { return inner(ctx, info, next) })
+				}
+			}
+		}
+		if h := hooks[i].AroundGuard; h != nil {
+			if inner := guard; inner == nil {
+				guard = h
+			} else {
+				guard = func(ctx context.Context, info GuardInfo, next func(context.Context) bool) bool {
+					return h(ctx, info, func(ctx context.Context) bool { return inner(ctx, info, next) })
+				}
+			}
+		}
+		if h := hooks[i].AroundAction; h != nil {
+			if inner := action; inner == nil {
+				action = h
+			} else {
+				action = func(ctx context.Context, info ActionInfo, next func(context.Context) ActionResult) ActionResult {
+					return h(ctx, info, func(ctx context.Context) ActionResult { return inner(ctx, info, next) })
+				}
+			}
+		}
+	}
+	return call, guard, action
+}
+
+// beforeGuard calls BeforeGuard hooks
+func (m *Machine) beforeGuard(info TransitionInfo) error {
+	for _, h := range m.hooks {
+		if h.BeforeGuard == nil {
+			continue
+		}
+		if err := h.BeforeGuard(m.ctx, info); err != nil {
+			return fmt.Errorf("SendEvent: %w by BeforeGuard hook: %w", ErrVetoed, err)
+		}
+	}
+	return nil
+}
+
+// beforeTransition calls BeforeTransition hooks
+func (m *Machine) beforeTransition(info TransitionInfo) error {
+	for _, h := range m.hooks {
+		if h.BeforeTransition == nil {
+			continue
+		}
+		if err := h.BeforeTransition(m.ctx, info); err != nil {
+			return fmt.Errorf("SendEvent: %w by BeforeTransition hook: %w", ErrVetoed, err)
+		}
+	}
+	return nil
+}
+
+// afterTransition calls AfterTransition hooks
+func (m *Machine) afterTransition(info TransitionInfo) {
+	for _, h := range m.hooks {
+		if h.AfterTransition != nil {
+			h.AfterTransition(m.ctx, info)
+		}
+	}
+}
+
+// onError calls OnError hooks
+func (m *Machine) onError(info TransitionInfo) {
+	for _, h := range m.hooks {
+		if h.OnError != nil {
+			h.OnError(m.ctx, info)
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestMachine_SendEvent_hooks(t *testing.T) {
+	md, err := NewMachineDefinition(
+		Schema{
+			InitialState: State{Name: "a"},
+			States:       []State{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+			Transitions: []Transition{
+				{From: "a", To: "b", Event: "go", Actions: []ActionDefinition{{Name: "ok"}}},
+				{From: "b", To: "c", Event: "fail", Actions: []ActionDefinition{{Name: "ok"}, {Name: "fail"}}},
+			},
+		},
+		[]Action{
+			{Name: "ok", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+				return ActionResult{Name: "ok"}
+			}},
+			{Name: "fail", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+				return ActionResult{Name: "fail", Err: errors.New("failed")}
+			}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	var infos []TransitionInfo
+	veto := map[string]bool{}
+
+	hooks := func(name string) Hooks {
+		return Hooks{
+			BeforeGuard: func(ctx context.Context, info TransitionInfo) error {
+				calls = append(calls, name+".BeforeGuard")
+				if veto[name+".BeforeGuard"] {
+					return fmt.Errorf("%s says no", name)
+				}
+				return nil
+			},
+			BeforeTransition: func(ctx context.Context, info TransitionInfo) error {
+				calls = append(calls, name+".BeforeTransition")
+				infos = append(infos, info)
+				if veto[name+".BeforeTransition"] {
+					return fmt.Errorf("%s says no", name)
+				}
+				return nil
+			},
+			AfterTransition: func(ctx context.Context, info TransitionInfo) {
+				calls = append(calls, name+".AfterTransition")
+				infos = append(infos, info)
+			},
+			OnError: func(ctx context.Context, info TransitionInfo) {
+				calls = append(calls, name+".OnError")
+				infos = append(infos, info)
+			},
+		}
+	}
+
+	// empty hooks are skipped
+	machine := NewMachine(context.Background(), md, hooks("first"), Hooks{}, hooks("second"))
+	object := &obj{}
+	machine.Start(object)
+
+	reset := func() {
+		calls, infos = nil, nil
+		veto = map[string]bool{}
+	}
+
+	// successful transition
+	if _, err := machine.SendEvent(object, "go"); err != nil {
+		t.Fatal(err)
+	}
+	expectedCalls := []string{
+		"first.BeforeGuard", "second.BeforeGuard",
+		"first.BeforeTransition", "second.BeforeTransition",
+		"first.AfterTransition", "second.AfterTransition",
+	}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("expected %v, got %v", expectedCalls, calls)
+	}
+	if info := infos[0]; info.From != "a" || info.To != "b" || info.Transition.Event != "go" || info.Results != nil {
+		t.Errorf("unexpected info before transition %+v", info)
+	}
+	if info := infos[2]; info.From != "a" || info.To != "b" || len(info.Results) != 1 || info.Err != nil {
+		t.Errorf("unexpected info after transition %+v", info)
+	}
+
+	// veto of the first hook stops the chain
+	reset()
+	object.SetStatus("a")
+	veto["first.BeforeGuard"] = true
+	_, err = machine.SendEvent(object, "go")
+	if !errors.Is(err, ErrVetoed) || object.Status() != "a" {
+		t.Errorf("expected veto, got %v in state %s", err, object.Status())
+	}
+	expectedCalls = []string{"first.BeforeGuard", "first.OnError", "second.OnError"}
+	if !reflect.DeepEqual(calls, expectedCalls) {
+		t.Errorf("expected %v, got %v", expectedCalls, calls)
+	}
+
+	reset()
+	veto["second.BeforeTransition"] = true
+	if _, err = machine.SendEvent(object, "go"); !errors.Is(err, ErrVetoed) || object.Status() != "a" {
+		t.Errorf("expected veto, got %v in state %s", err, object.Status())
+	}
+	if calls[len(calls)-3] != "second.BeforeTransition" {
+		t.Errorf("expected veto by second BeforeTransition, got %v", calls)
+	}
+
+	// failed action is reported to OnError hooks along with previous results
+	reset()
+	object.SetStatus("b")
+	if _, err = machine.SendEvent(object, "fail"); err == nil || errors.Is(err, ErrVetoed) {
+		t.Errorf("expected action error, got %v", err)
+	}
+	info := infos[len(infos)-1]
+	if info.Err == nil || len(info.Results) != 2 || info.Results[1].Name != "fail" {
+		t.Errorf("unexpected info on error %+v", info)
+	}
+
+	// no transition is reported too
+	reset()
+	if _, err = machine.SendEvent(object, "unknown"); !errors.Is(err, ErrNoTransition) {
+		t.Errorf("expected ErrNoTransition, got %v", err)
+	}
+	if !errors.Is(infos[len(infos)-1].Err, ErrNoTransition) {
+		t.Errorf("expected ErrNoTransition in OnError hook, got %+v", infos)
+	}
+}
+
+func TestMachine_aroundHooks(t *testing.T) {
+	type key struct{}
+
+	md, err := NewMachineDefinition(
+		Schema{
+			Name:         "m",
+			InitialState: State{Name: "a"},
+			States:       []State{{Name: "a"}, {Name: "b"}},
+			Transitions: []Transition{
+				{From: "a", To: "b", Event: "go", Guards: []Guard{{Name: "tagged", Negate: true}}, Actions: []ActionDefinition{{Name: "tag"}}},
+			},
+		},
+		[]Condition{{Name: "tagged", F: func(ctx context.Context, o Object, p []Param) bool {
+			// context passed by hooks reaches condition
+			return ctx.Value(key{}) != "outer,inner"
+		}}},
+		[]Action{{Name: "tag", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+			return ActionResult{Name: "tag", Output: ctx.Value(key{})}
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var mu sync.Mutex
+	var calls []string
+	record := func(call string) {
+		mu.Lock()
+		calls = append(calls, call)
+		mu.Unlock()
+	}
+
+	hooks := func(name string) Hooks {
+		return Hooks{
+			AroundGuard: func(ctx context.Context, info GuardInfo, next func(context.Context) bool) bool {
+				tag, _ := ctx.Value(key{}).(string)
+				if tag != "" {
+					tag += ","
+				}
+				result := next(context.WithValue(ctx, key{}, tag+name))
+				record(fmt.Sprintf("%s.guard %s %s %v", name, info.Machine, info.Guard.Name, result))
+				return result
+			},
+			AroundAction: func(ctx context.Context, info ActionInfo, next func(context.Context) ActionResult) ActionResult {
+				tag, _ := ctx.Value(key{}).(string)
+				if tag != "" {
+					tag += ","
+				}
+				result := next(context.WithValue(ctx, key{}, tag+name))
+				record(fmt.Sprintf("%s.action %s %s %s", name, info.Machine, info.Event, info.Action.Name))
+				return result
+			},
+		}
+	}
+
+	machine := NewMachine(context.Background(), md, hooks("outer"), Hooks{}, hooks("inner"))
+	object := &obj{}
+	machine.Start(object)
+
+	if !machine.Can(object, "go") {
+		t.Fatal("expected transition to be available")
+	}
+	results, err := machine.SendEvent(object, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Output != "outer,inner" {
+		t.Errorf("expected context of hooks in action, got %v", results[0].Output)
+	}
+
+	expected := []string{
+		"inner.guard m tagged true", "outer.guard m tagged true",
+		"inner.guard m tagged true", "outer.guard m tagged true",
+		"inner.action m go tag", "outer.action m go tag",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
+
+func TestMachine_AroundCall(t *testing.T) {
+	type key struct{}
+
+	md, err := NewMachineDefinition(
+		Schema{
+			Name:         "m",
+			InitialState: State{Name: "a"},
+			States:       []State{{Name: "a"}, {Name: "b"}},
+			Transitions:  []Transition{{From: "a", To: "b", Event: "go", Guards: []Guard{{Name: "traced"}}}},
+		},
+		[]Condition{{Name: "traced", F: func(ctx context.Context, o Object, p []Param) bool {
+			return ctx.Value(key{}) != nil
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var calls []string
+	var afterCtx context.Context
+	machine := NewMachine(context.Background(), md, Hooks{
+		AroundCall: func(ctx context.Context, info CallInfo, next func(context.Context) error) error {
+			calls = append(calls, info.Method+" "+string(info.Event))
+			err := next(context.WithValue(ctx, key{}, info.Method))
+			if err != nil {
+				calls = append(calls, "error "+info.Method)
+			}
+			return err
+		},
+		AfterTransition: func(ctx context.Context, info TransitionInfo) {
+			afterCtx = ctx
+		},
+	})
+	object := &obj{}
+	machine.Start(object)
+
+	if trs, err := machine.AvailableTransitions(object); err != nil || len(trs) != 1 {
+		t.Fatalf("expected transition to be available with context of hook, got %v, %v", trs, err)
+	}
+	if _, err := machine.SendEvent(object, "go"); err != nil {
+		t.Fatal(err)
+	}
+	if afterCtx.Value(key{}) != "SendEvent" {
+		t.Error("expected context of hook to be passed to other hooks")
+	}
+	if _, err := machine.SendEvent(object, "go"); err == nil {
+		t.Error("expected error")
+	}
+
+	expected := []string{
+		"AvailableTransitions ",
+		"SendEvent go", "AvailableTransitions go",
+		"SendEvent go", "AvailableTransitions go", "error SendEvent",
+	}
+	if !reflect.DeepEqual(calls, expected) {
+		t.Errorf("expected %v, got %v", expected, calls)
+	}
+}
@@ -0,0 +1,130 @@
+package core
+
+// fromEvent is a key for transitions lookup by source state and event
+type fromEvent struct {
+	from  string
+	event Event
+}
+
+// definitionIndex contains lookup tables for MachineDefinition.
+// It's built once in NewMachineDefinition and never modified afterwards,
+// therefore it's safe for concurrent use.
+type definitionIndex struct {
+	states       map[string]*State
+	finalStates  map[string]struct{}
+	stateActions map[string]*StateActions
+	choices      map[string]*Choice
+	timers       map[string][]Timer
+	conditions   map[string]*Condition
+	actions      map[string]*Action
+
+	// transitions is a copy of Schema.Transitions, lookup tables below contain
+	// ascending positions in this slice so that order of declaration is preserved
+	transitions  []Transition
+	byFrom       map[string][]int
+	byFromEvent  map[fromEvent][]int
+	anyFrom      []int
+	anyFromEvent map[Event][]int
+}
+
+// newDefinitionIndex builds indexes for provided definition.
+// If several states, conditions or actions share the same name then the first one wins,
+// as with linear search.
+func newDefinitionIndex(md *MachineDefinition) *definitionIndex {
+	idx := &definitionIndex{
+		states:       make(map[string]*State, len(md.Schema.States)),
+		finalStates:  make(map[string]struct{}, len(md.Schema.FinalStates)),
+		stateActions: make(map[string]*StateActions, len(md.Schema.StateActions)),
+		choices:      make(map[string]*Choice, len(md.Schema.Choices)),
+		timers:       make(map[string][]Timer),
+		conditions:   make(map[string]*Condition, len(md.Conditions)),
+		actions:      make(map[string]*Action, len(md.Actions)),
+		transitions:  append([]Transition(nil), md.Schema.Transitions...),
+		byFrom:       make(map[string][]int),
+		byFromEvent:  make(map[fromEvent][]int),
+		anyFromEvent: make(map[Event][]int),
+	}
+
+	for i := range md.Schema.States {
+		s := md.Schema.States[i]
+		if _, ok := idx.states[s.Name]; !ok {
+			idx.states[s.Name] = &s
+		}
+	}
+
+	for _, s := range md.Schema.FinalStates {
+		idx.finalStates[s.Name] = struct{}{}
+	}
+
+	// NewMachineDefinition rejects several state actions of the same state
+	for i := range md.Schema.StateActions {
+		sa := md.Schema.StateActions[i]
+		idx.stateActions[sa.State] = &sa
+	}
+
+	for _, tm := range md.Schema.Timers {
+		if _, ok := idx.timers[tm.State]; !ok {
+			idx.timers[tm.State] = timersOf(md.Schema.Timers, tm.State)
+		}
+	}
+
+	for i := range md.Schema.Choices {
+		c := md.Schema.Choices[i]
+		idx.choices[c.Name] = &c
+	}
+
+	for i, t := range idx.transitions {
+		if t.From == AnyState {
+			idx.anyFrom = append(idx.anyFrom, i)
+			idx.anyFromEvent[t.Event] = append(idx.anyFromEvent[t.Event], i)
+			continue
+		}
+		seen := make(map[string]bool, len(t.FromStates)+1)
+		for _, from := range t.Sources() {
+			// the same state listed twice shouldn't produce duplicate candidates
+			if seen[from] {
+				continue
+			}
+			seen[from] = true
+			idx.byFrom[from] = append(idx.byFrom[from], i)
+			key := fromEvent{from, t.Event}
+			idx.byFromEvent[key] = append(idx.byFromEvent[key], i)
+		}
+	}
+
+	for i := range md.Conditions {
+		cond := md.Conditions[i]
+		if _, ok := idx.conditions[cond.Name]; !ok {
+			idx.conditions[cond.Name] = &cond
+		}
+	}
+
+	for i := range md.Actions {
+		a := md.Actions[i]
+		if _, ok := idx.actions[a.Name]; !ok {
+			idx.actions[a.Name] = &a
+		}
+	}
+
+	return idx
+}
+
+// transitionsAt merges two ascending lists of positions and returns transitions
+// at these positions in order of declaration
+func (idx *definitionIndex) transitionsAt(a, b []int) []Transition {
+	if len(a)+len(b) == 0 {
+		return nil
+	}
+
+	transitions := make([]Transition, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		var pos int
+		if len(b) == 0 || (len(a) > 0 && a[0] < b[0]) {
+			pos, a = a[0], a[1:]
+		} else {
+			pos, b = b[0], b[1:]
+		}
+		transitions = append(transitions, idx.transitions[pos])
+	}
+	return transitions
+}
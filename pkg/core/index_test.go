@@ -0,0 +1,142 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+// generateDefinition returns definition with n states where each state has
+// 3 transitions to next states and each transition is guarded by its own condition
+func generateDefinition(n int) (Schema, []Condition, []Action) {
+	schema := Schema{Name: fmt.Sprintf("generated-%d", n)}
+	var conditions []Condition
+	var actions []Action
+
+	for i := 0; i < n; i++ {
+		schema.States = append(schema.States, State{Name: fmt.Sprintf("s%d", i)})
+	}
+	schema.InitialState = schema.States[0]
+	schema.FinalStates = []State{schema.States[n-1]}
+
+	for i := 0; i < n-1; i++ {
+		for j := 0; j < 3; j++ {
+			name := fmt.Sprintf("c%d_%d", i, j)
+			conditions = append(conditions, Condition{
+				Name: name,
+				F:    func(ctx context.Context, o Object, params []Param) bool { return true },
+			})
+			actions = append(actions, Action{
+				Name: name,
+				F: func(ctx context.Context, o Object, params []Param, prev []ActionResult) ActionResult {
+					return ActionResult{}
+				},
+			})
+			schema.Transitions = append(schema.Transitions, Transition{
+				From:    fmt.Sprintf("s%d", i),
+				To:      fmt.Sprintf("s%d", i+1),
+				Event:   Event(fmt.Sprintf("e%d", j)),
+				Guards:  []Guard{Guard{Name: name}},
+				Actions: []ActionDefinition{ActionDefinition{Name: name}},
+			})
+		}
+	}
+
+	return schema, conditions, actions
+}
+
+func TestMachineDefinition_index(t *testing.T) {
+	schema, conditions, actions := generateDefinition(5)
+	// duplicate condition name: the first one should win
+	conditions = append(conditions, Condition{Name: "c0_0"})
+
+	md, err := NewMachineDefinition(schema, conditions, actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.index == nil {
+		t.Fatal("expected NewMachineDefinition to build index")
+	}
+
+	// definition without index must return the same results
+	plain := &MachineDefinition{Schema: schema, Conditions: conditions, Actions: actions}
+
+	for _, def := range []*MachineDefinition{md, plain} {
+		if s, ok := def.getStateByName("s3"); !ok || s.Name != "s3" {
+			t.Errorf("expected state s3, got %v, %v", s, ok)
+		}
+		if _, ok := def.getStateByName("unknown"); ok {
+			t.Error("expected unknown state not to be found")
+		}
+		if !def.isFinalState("s4") || def.isFinalState("s3") {
+			t.Error("expected only s4 to be final state")
+		}
+		if cond, err := def.getConditionByName("c0_0"); err != nil || cond.F == nil {
+			t.Errorf("expected the first condition c0_0, got %v, %v", cond, err)
+		}
+		if a, err := def.getActionByName("c2_1"); err != nil || a.Name != "c2_1" {
+			t.Errorf("expected action c2_1, got %v, %v", a, err)
+		}
+		if _, err := def.getActionByName("unknown"); err == nil {
+			t.Error("expected error for unknown action")
+		}
+
+		trs := def.candidateTransitions("s1", "")
+		if len(trs) != 3 {
+			t.Fatalf("expected 3 candidate transitions, got %v", trs)
+		}
+		for i, tr := range trs {
+			if tr.Event != Event(fmt.Sprintf("e%d", i)) {
+				t.Errorf("expected transitions in order of declaration, got %v at %d", tr.Event, i)
+			}
+		}
+
+		trs = def.candidateTransitions("s1", "e2")
+		if len(trs) != 1 || trs[0].To != "s2" {
+			t.Errorf("expected single transition s1->s2 for e2, got %v", trs)
+		}
+	}
+}
+
+func BenchmarkMachineDefinition_findAvailableTransitions(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		schema, conditions, actions := generateDefinition(n)
+		md, err := NewMachineDefinition(schema, conditions, actions)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		ctx := context.Background()
+		// the last non-final state is the worst case for linear search
+		object := &obj{status: fmt.Sprintf("s%d", n-2)}
+
+		b.Run(fmt.Sprintf("states=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := md.findAvailableTransitions(ctx, object, Event("e1")); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMachine_CurrentState(b *testing.B) {
+	for _, n := range []int{10, 100, 1000, 10000} {
+		schema, conditions, actions := generateDefinition(n)
+		md, err := NewMachineDefinition(schema, conditions, actions)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		machine := NewMachine(context.Background(), md)
+		object := &obj{status: fmt.Sprintf("s%d", n-1)}
+
+		b.Run(fmt.Sprintf("states=%d", n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := machine.CurrentState(object); err != nil || !machine.IsInFinalState(object) {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
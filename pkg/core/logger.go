@@ -0,0 +1,168 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+)
+
+// Level is a severity of log record, values match levels of log/slog
+type Level int
+
+// Levels of log records
+const (
+	LevelDebug Level = -4
+	LevelInfo  Level = 0
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+// Field is a structured field of log record
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Logger is used by Machine to log what it does, see NewSlogLogger for adapter of log/slog.
+type Logger interface {
+	// Enabled reports whether records of level are logged, machine doesn't build records otherwise
+	Enabled(ctx context.Context, level Level) bool
+	Log(ctx context.Context, level Level, msg string, fields ...Field)
+}
+
+// LogLevels are levels at which Machine logs records of every kind. If LogLevels are passed to NewMachine then
+// they replace DefaultLogLevels entirely, so start with DefaultLogLevels to change some of them.
+type LogLevels struct {
+	// Attempt is a level of "event sent" record, logged before guards are evaluated
+	Attempt Level
+	// Guard is a level of "guard evaluated" record
+	Guard Level
+	// Action is a level of "action performed" and "action pending" records
+	Action Level
+	// ActionFailure is a level of "action failed" record
+	ActionFailure Level
+	// Transition is a level of "transition performed" record
+	Transition Level
+	// Rejection is a level of "event rejected" record: there is no transition for event, hook vetoed it
+	// or object has pending transition
+	Rejection Level
+	// Error is a level of "transition failed" record for all other errors, e.g. failed actions
+	Error Level
+}
+
+// DefaultLogLevels are used by Machine unless other LogLevels are passed to NewMachine
+var DefaultLogLevels = LogLevels{
+	Attempt:       LevelDebug,
+	Guard:         LevelDebug,
+	Action:        LevelDebug,
+	ActionFailure: LevelWarn,
+	Transition:    LevelInfo,
+	Rejection:     LevelInfo,
+	Error:         LevelError,
+}
+
+// Keys of fields logged by Machine
+const (
+	MachineField = "machine"
+	ObjectField  = "object_id"
+	EventField   = "event"
+	FromField    = "from"
+	ToField      = "to"
+	ActorField   = "actor"
+	GuardField   = "guard"
+	NegateField  = "negate"
+	PassedField  = "passed"
+	ActionField  = "action"
+	ErrorField   = "error"
+)
+
+// NewSlogLogger returns Logger which writes records to l
+func NewSlogLogger(l *slog.Logger) Logger {
+	return slogLogger{l}
+}
+
+type slogLogger struct {
+	l *slog.Logger
+}
+
+func (s slogLogger) Enabled(ctx context.Context, level Level) bool {
+	return s.l.Enabled(ctx, slog.Level(level))
+}
+
+func (s slogLogger) Log(ctx context.Context, level Level, msg string, fields ...Field) {
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.Any(f.Key, f.Value)
+	}
+	s.l.LogAttrs(ctx, slog.Level(level), msg, attrs...)
+}
+
+// logHooks returns hooks which log transitions with logger at levels
+func logHooks(logger Logger, levels LogLevels) Hooks {
+	// objectFields returns fields which identify machine and object
+	objectFields := func(ctx context.Context, machine string, o Object) []Field {
+		fields := []Field{{MachineField, machine}}
+		if id, err := objectID(o); err == nil {
+			fields = append(fields, Field{ObjectField, id})
+		}
+		if actor, ok := ActorFrom(ctx); ok {
+			fields = append(fields, Field{ActorField, actor})
+		}
+		return fields
+	}
+
+	return Hooks{
+		BeforeGuard: func(ctx context.Context, info TransitionInfo) error {
+			if logger.Enabled(ctx, levels.Attempt) {
+				fields := append(objectFields(ctx, info.Machine, info.Object), Field{EventField, string(info.Event)}, Field{FromField, info.From})
+				logger.Log(ctx, levels.Attempt, "event sent", fields...)
+			}
+			return nil
+		},
+		AfterTransition: func(ctx context.Context, info TransitionInfo) {
+			if logger.Enabled(ctx, levels.Transition) {
+				fields := append(objectFields(ctx, info.Machine, info.Object),
+					Field{EventField, string(info.Event)}, Field{FromField, info.From}, Field{ToField, info.To})
+				logger.Log(ctx, levels.Transition, "transition performed", fields...)
+			}
+		},
+		OnError: func(ctx context.Context, info TransitionInfo) {
+			level, msg := levels.Error, "transition failed"
+			if errors.Is(info.Err, ErrNoTransition) || errors.Is(info.Err, ErrVetoed) || errors.Is(info.Err, ErrInFlight) {
+				level, msg = levels.Rejection, "event rejected"
+			}
+			if logger.Enabled(ctx, level) {
+				fields := append(objectFields(ctx, info.Machine, info.Object),
+					Field{EventField, string(info.Event)}, Field{FromField, info.From}, Field{ErrorField, info.Err})
+				logger.Log(ctx, level, msg, fields...)
+			}
+		},
+		AroundGuard: func(ctx context.Context, info GuardInfo, next func(context.Context) bool) bool {
+			passed := next(ctx)
+			if logger.Enabled(ctx, levels.Guard) {
+				fields := append(objectFields(ctx, info.Machine, info.Object),
+					Field{GuardField, info.Guard.Name}, Field{NegateField, info.Guard.Negate}, Field{PassedField, passed})
+				logger.Log(ctx, levels.Guard, "guard evaluated", fields...)
+			}
+			return passed
+		},
+		AroundAction: func(ctx context.Context, info ActionInfo, next func(context.Context) ActionResult) ActionResult {
+			result := next(ctx)
+			level, msg := levels.Action, "action performed"
+			switch {
+			case result.Err != nil:
+				level, msg = levels.ActionFailure, "action failed"
+			case result.Pending:
+				msg = "action pending"
+			}
+			if logger.Enabled(ctx, level) {
+				fields := append(objectFields(ctx, info.Machine, info.Object), Field{EventField, string(info.Event)}, Field{ActionField, info.Action.Name})
+				if result.Err != nil {
+					fields = append(fields, Field{ErrorField, result.Err})
+				}
+				logger.Log(ctx, level, msg, fields...)
+			}
+			return result
+		},
+	}
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMachine_Logger(t *testing.T) {
+	md, err := NewMachineDefinition(
+		Schema{
+			Name:         "order",
+			InitialState: State{Name: "new"},
+			States:       []State{{Name: "new"}, {Name: "paid"}, {Name: "failed"}},
+			Transitions: []Transition{
+				{From: "new", To: "paid", Event: "pay", Guards: []Guard{{Name: "valid"}}, Actions: []ActionDefinition{{Name: "charge"}}},
+				{From: "new", To: "failed", Event: "fail", Actions: []ActionDefinition{{Name: "broken"}}},
+			},
+		},
+		[]Condition{{Name: "valid", F: func(ctx context.Context, o Object, p []Param) bool { return true }}},
+		[]Action{
+			{Name: "charge", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+				return ActionResult{Name: "charge"}
+			}},
+			{Name: "broken", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+				return ActionResult{Name: "broken", Err: errors.New("failed")}
+			}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	newLogger := func(level slog.Level) Logger {
+		return NewSlogLogger(slog.New(slog.NewJSONHandler(&buf, &slog.HandlerOptions{
+			Level: level,
+			// time is dropped, so that records can be compared
+			ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+				if a.Key == slog.TimeKey {
+					return slog.Attr{}
+				}
+				return a
+			},
+		})))
+	}
+
+	records := func() []map[string]interface{} {
+		var rs []map[string]interface{}
+		for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+			var r map[string]interface{}
+			if err := json.Unmarshal([]byte(line), &r); err != nil {
+				t.Fatal(err)
+			}
+			rs = append(rs, r)
+		}
+		buf.Reset()
+		return rs
+	}
+
+	// veto by hook is logged as rejection
+	veto := Hooks{BeforeTransition: func(ctx context.Context, info TransitionInfo) error {
+		if info.Event == "pay" && info.Object.(*obj).enabled {
+			return errors.New("no")
+		}
+		return nil
+	}}
+	machine := NewMachine(context.Background(), md, veto, newLogger(slog.LevelDebug))
+
+	if _, err := machine.WithContext(WithActor(context.Background(), "alice")).SendEvent(&obj{id: "1", status: "new"}, "pay"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []map[string]interface{}{
+		{"level": "DEBUG", "msg": "event sent", "machine": "order", "object_id": "1", "actor": "alice", "event": "pay", "from": "new"},
+		{"level": "DEBUG", "msg": "guard evaluated", "machine": "order", "object_id": "1", "actor": "alice", "guard": "valid", "negate": false, "passed": true},
+		{"level": "DEBUG", "msg": "action performed", "machine": "order", "object_id": "1", "actor": "alice", "event": "pay", "action": "charge"},
+		{"level": "INFO", "msg": "transition performed", "machine": "order", "object_id": "1", "actor": "alice", "event": "pay", "from": "new", "to": "paid"},
+	}
+	if rs := records(); !reflect.DeepEqual(rs, expected) {
+		t.Errorf("expected %v, got %v", expected, rs)
+	}
+
+	machine.SendEvent(&obj{id: "2", status: "new"}, "fail")
+	expected = []map[string]interface{}{
+		{"level": "DEBUG", "msg": "event sent", "machine": "order", "object_id": "2", "event": "fail", "from": "new"},
+		{"level": "WARN", "msg": "action failed", "machine": "order", "object_id": "2", "event": "fail", "action": "broken", "error": "failed"},
+		{"level": "ERROR", "msg": "transition failed", "machine": "order", "object_id": "2", "event": "fail", "from": "new", "error": "failed"},
+	}
+	if rs := records(); !reflect.DeepEqual(rs, expected) {
+		t.Errorf("expected %v, got %v", expected, rs)
+	}
+
+	// only records of enabled levels are logged
+	levels := DefaultLogLevels
+	levels.Attempt, levels.Guard = LevelInfo, LevelWarn
+	machine = NewMachine(context.Background(), md, veto, newLogger(slog.LevelInfo), levels)
+
+	machine.SendEvent(&obj{id: "3", status: "new", enabled: true}, "pay")
+	machine.SendEvent(&obj{id: "4", status: "paid"}, "pay")
+	var msgs []string
+	for _, r := range records() {
+		msgs = append(msgs, r["level"].(string)+" "+r["msg"].(string)+" "+r["object_id"].(string))
+	}
+	expectedMsgs := []string{
+		"INFO event sent 3", "WARN guard evaluated 3", "INFO event rejected 3",
+		"INFO event sent 4", "INFO event rejected 4",
+	}
+	if !reflect.DeepEqual(msgs, expectedMsgs) {
+		t.Errorf("expected %v, got %v", expectedMsgs, msgs)
+	}
+}
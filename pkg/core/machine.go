@@ -3,6 +3,7 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
 )
 
@@ -11,14 +12,140 @@ type Machine struct {
 	// context is passed to all downstream guards and actions and can be used for their cancellation
 	ctx context.Context
 	md  *MachineDefinition
+
+	clock Clock
+	// scheduleStore is optional; if it's set then events of timers are recorded there
+	// when object enters a state and cancelled when object leaves it
+	scheduleStore ScheduleStore
+	// repository is optional, it's required for operations with objects by ID
+	repository Repository
+	// hooks are called around transitions in order
+	hooks []Hooks
+	// aroundCall, aroundGuard and aroundAction are compositions of AroundCall, AroundGuard and AroundAction hooks,
+	// nil if there are none
+	aroundCall   machineCall
+	aroundGuard  guardCall
+	aroundAction actionCall
+	// bus is optional, notifications about transitions are published there
+	bus *Bus
+	// breakers are circuit breakers by action name, they are shared by copies of machine
+	breakers map[string]*breaker
+	// pending keeps suspended transitions, nil if asynchronous actions aren't supported by machine
+	pending PendingStore
+	// delivering is ID of scheduled event which DurableScheduler delivers with this copy of machine
+	delivering string
+	// entered is set on copy of machine which saves object after transition: state entered by object is recorded
+	// there at commit, and scheduled events are updated only after object is saved
+	entered *enteredState
+}
+
+// NewMachine returns new machine instance, optional args are the same as in NewMachineWithOptions.
+// It panics if argument of unknown type or invalid CircuitBreaker is passed, because it's a programming error;
+// use NewMachineWithOptions to get an error instead.
+func NewMachine(ctx context.Context, md *MachineDefinition, args ...interface{}) *Machine {
+	m, err := NewMachineWithOptions(ctx, md, args...)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// NewMachineWithOptions returns new machine instance.
+// Optional args: Clock, ScheduleStore, Repository, Hooks (can be passed several times), *Bus, Logger, LogLevels,
+// CircuitBreaker (can be passed once per action). Logger is called before all hooks, so that it logs every attempt,
+// even vetoed by hooks. Error is returned if argument of unknown type or invalid CircuitBreaker is passed.
+//
+// Pending transitions of asynchronous actions are kept in Repository or, failing that, in ScheduleStore if it
+// implements PendingStore, so that they can be completed by any process. Machine which has neither Repository
+// nor ScheduleStore keeps them in memory along with objects, they are lost on restart then. Otherwise
+// asynchronous actions fail if neither of them implements PendingStore.
+func NewMachineWithOptions(ctx context.Context, md *MachineDefinition, args ...interface{}) (*Machine, error) {
+	m := &Machine{ctx: ctx, md: md, clock: SystemClock}
+	var logger Logger
+	levels := DefaultLogLevels
+	var breakers []CircuitBreaker
+
+	// handle variadic optional args based on passed types
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case Clock:
+			m.clock = arg
+		case ScheduleStore:
+			m.scheduleStore = arg
+		case Repository:
+			m.repository = arg
+		case Hooks:
+			m.hooks = append(m.hooks, arg)
+		case *Bus:
+			m.bus = arg
+		case Logger:
+			logger = arg
+		case LogLevels:
+			levels = arg
+		case CircuitBreaker:
+			breakers = append(breakers, arg)
+		default:
+			return nil, fmt.Errorf("unknown type %T, value %v in NewMachineWithOptions call", arg, arg)
+		}
+	}
+
+	for _, b := range breakers {
+		if _, err := md.getActionByName(b.Action); err != nil {
+			return nil, fmt.Errorf("circuit breaker refers to unknown action '%s'", b.Action)
+		}
+		if b.Threshold < 1 || b.Cooldown <= 0 {
+			return nil, fmt.Errorf("circuit breaker of action '%s' must have positive threshold and cooldown", b.Action)
+		}
+		if _, ok := m.breakers[b.Action]; ok {
+			return nil, fmt.Errorf("circuit breaker of action '%s' is passed more than once", b.Action)
+		}
+		if m.breakers == nil {
+			m.breakers = map[string]*breaker{}
+		}
+		m.breakers[b.Action] = newBreaker(b, m.clock)
+	}
+
+	if store, ok := m.repository.(PendingStore); ok {
+		m.pending = store
+	} else if store, ok := m.scheduleStore.(PendingStore); ok {
+		m.pending = store
+	} else if m.repository == nil && m.scheduleStore == nil {
+		m.pending = newMemoryPending()
+	}
+
+	if logger != nil {
+		m.hooks = append([]Hooks{logHooks(logger, levels)}, m.hooks...)
+	}
+	m.aroundCall, m.aroundGuard, m.aroundAction = composeHooks(m.hooks)
+	return m, nil
+}
+
+// WithContext returns a copy of machine which passes ctx to guards and actions instead of machine's context,
+// e.g. context of an incoming request with its deadline and payload
+func (m *Machine) WithContext(ctx context.Context) *Machine {
+	c := *m
+	c.ctx = ctx
+	return &c
+}
+
+// Schema returns schema of machine's definition
+func (m *Machine) Schema() Schema {
+	return m.md.Schema
+}
+
+// Bus returns bus passed to NewMachine, or nil if machine doesn't publish transitions
+func (m *Machine) Bus() *Bus {
+	return m.bus
 }
 
-// NewMachine returns new machine instance
-func NewMachine(ctx context.Context, md *MachineDefinition) *Machine {
-	return &Machine{ctx, md}
+// Repository returns repository passed to NewMachine, or nil if machine doesn't load objects by itself
+func (m *Machine) Repository() Repository {
+	return m.repository
 }
 
-// Start sets object status to initial state
+// Start sets object status to initial state.
+// If machine has ScheduleStore then timers of initial state are recorded by Schedule, which should be called
+// after started object is saved.
 // TODO: add user, description variadic args like in findAvailableTransitions
 func (m *Machine) Start(o Object) {
 	o.SetStatus(m.md.Schema.InitialState.Name)
@@ -26,31 +153,54 @@ func (m *Machine) Start(o Object) {
 
 // AvailableTransitions returns transitions available for provided Object.
 // Event can be passed as optional argument to narrow search down to particular Event.
+// Object which has pending transition doesn't have available transitions, error wraps ErrInFlight then.
 func (m *Machine) AvailableTransitions(o Object, args ...interface{}) ([]Transition, error) {
+	var event Event
+	for _, arg := range args {
+		if e, ok := arg.(Event); ok {
+			event = e
+		}
+	}
+
+	var trs []Transition
+	err := m.call("AvailableTransitions", o, event, func(m *Machine) error {
+		var err error
+		trs, err = m.availableTransitions(o, args...)
+		return err
+	})
+	return trs, err
+}
+
+// availableTransitions implements AvailableTransitions without AroundCall hooks
+func (m *Machine) availableTransitions(o Object, args ...interface{}) ([]Transition, error) {
+	// objects without identity can't have pending transitions
+	if id, err := objectID(o); err == nil && m.pending != nil {
+		p, ok, err := m.pending.PendingOf(m.ctx, id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check pending transition of object %s: %w", id, err)
+		}
+		if ok {
+			return nil, fmt.Errorf("%w: object %s waits for action '%s', token %s", ErrInFlight, p.ObjectID, p.Action, p.Token)
+		}
+	}
+	if m.aroundGuard != nil {
+		args = append(args[:len(args):len(args)], m.aroundGuard)
+	}
 	return m.md.findAvailableTransitions(m.ctx, o, args...)
 }
 
 // CurrentState returns current state based on object's status
-func (m *Machine) CurrentState(o Object) (state State, err error) {
-	err = fmt.Errorf("state '%s' not found in schema", o.Status())
-	for _, s := range m.md.Schema.States {
-		if s.Name == o.Status() {
-			state = s
-			err = nil
-			break
-		}
+func (m *Machine) CurrentState(o Object) (State, error) {
+	state, ok := m.md.getStateByName(o.Status())
+	if !ok {
+		return State{}, fmt.Errorf("state '%s' not found in schema", o.Status())
 	}
-	return state, err
+	return *state, nil
 }
 
 // IsInFinalState returns true if Object.Status() is a name of a final state
 func (m *Machine) IsInFinalState(o Object) bool {
-	for _, state := range m.md.Schema.FinalStates {
-		if o.Status() == state.Name {
-			return true
-		}
-	}
-	return false
+	return m.md.isFinalState(o.Status())
 }
 
 // AvailableStates returns all states available in machine's definition
@@ -60,12 +210,10 @@ func (m *Machine) AvailableStates() []State {
 
 // IsRunning returns true if object's status matches non-final state of machine
 func (m *Machine) IsRunning(o Object) bool {
-	for _, state := range m.AvailableStates() {
-		if state.Name == o.Status() {
-			return !m.IsInFinalState(o)
-		}
+	if _, ok := m.md.getStateByName(o.Status()); !ok {
+		return false
 	}
-	return false
+	return !m.IsInFinalState(o)
 }
 
 // Can indicates weither object can perform transition according to event
@@ -74,35 +222,342 @@ func (m *Machine) Can(o Object, e Event) bool {
 	return err == nil && len(trs) > 0
 }
 
-// SendEvent triggers transition according to Event
+// ResolveTransition returns transition which SendEvent would perform for Object and Event
+// along with all available transitions which competed for the event, in order of declaration.
+// If there is no available transition then error wraps ErrNoTransition; if transitions conflict
+// according to MachineDefinition's ConflictResolution then error is *TransitionConflictError.
+func (m *Machine) ResolveTransition(o Object, e Event) (Transition, []Transition, error) {
+	t, trs, _, err := m.resolveTransition(o, e)
+	return t, trs, err
+}
+
+// resolveTransition implements ResolveTransition, it also returns branch of junction which transition leads to,
+// so that junction isn't evaluated again
+func (m *Machine) resolveTransition(o Object, e Event) (Transition, []Transition, *Branch, error) {
+	var branches junctionBranches
+	trs, err := m.AvailableTransitions(o, e, &branches)
+	if err != nil {
+		return Transition{}, nil, nil, err
+	}
+
+	i, err := m.md.chooseTransition(o.Status(), e, trs)
+	if err != nil {
+		return Transition{}, trs, nil, err
+	}
+	return trs[i], trs, branches[i], nil
+}
+
+// SendEvent triggers transition according to Event.
+// If transition leads to Choice then target state is picked by its branches.
+// Hooks of machine are called around transition, see Hooks. After successful transition
+// notification is published to machine's Bus.
+// If asynchronous action returns pending result then transition is suspended and SendEvent returns *PendingError
+// along with results of actions performed so far, see Machine.Complete.
 // TODO(?): (design) return revert function(s) along with error? So that caller can revert transition in case of an error
 func (m *Machine) SendEvent(o Object, e Event) ([]ActionResult, error) {
-	trs, err := m.AvailableTransitions(o, e)
+	var results []ActionResult
+	err := m.call("SendEvent", o, e, func(m *Machine) error {
+		var err error
+		results, err = m.sendEventWithHooks(o, e)
+		return err
+	})
+	return results, err
+}
+
+// call calls f with machine which has context of AroundCall hooks, if there are any
+func (m *Machine) call(method string, o Object, e Event, f func(m *Machine) error) error {
+	if m.aroundCall == nil {
+		return f(m)
+	}
+
+	info := CallInfo{Machine: m.md.Schema.Name, Method: method, Object: o, Event: e}
+	return m.aroundCall(m.ctx, info, func(ctx context.Context) error {
+		return f(m.WithContext(ctx))
+	})
+}
+
+// sendEventWithHooks implements SendEvent without AroundCall hooks
+func (m *Machine) sendEventWithHooks(o Object, e Event) ([]ActionResult, error) {
+	info := &TransitionInfo{Machine: m.md.Schema.Name, Object: o, Event: e, From: o.Status()}
+
+	results, err := m.sendEvent(info)
+	return m.finish(info, results, err)
+}
+
+// finish calls hooks when transition is done or failed and publishes notification about successful transition.
+// Suspended transition isn't finished yet, so it's returned as is.
+func (m *Machine) finish(info *TransitionInfo, results []ActionResult, err error) ([]ActionResult, error) {
+	var pending *PendingError
+	if errors.As(err, &pending) {
+		return results, err
+	}
+
+	if err != nil {
+		info.Results = results
+		info.Err = err
+		m.onError(*info)
+		return nil, err
+	}
+
+	info.To = info.Object.Status()
+	info.Results = results
+	m.afterTransition(*info)
+	m.publish(*info)
+	return results, nil
+}
+
+// stages of transition after it's chosen, in order of execution
+const (
+	stageExit = iota
+	stageTransition
+	stageBranch
+	stageEntry
+	stageCommit
+)
+
+// transitionRun is a state of transition after it's chosen. It's kept by machine while transition is pending.
+type transitionRun struct {
+	info   *TransitionInfo
+	choice *Choice
+	branch *Branch
+	// to is a target state, it's a name of choice until branch is taken
+	to string
+	// stage and action point to the next action to perform
+	stage   int
+	action  int
+	results []ActionResult
+	// pending describes suspended transition
+	pending PendingTransition
+}
+
+// sendEvent chooses transition, fills info along the way and performs transition.
+// In case of error it returns results of actions performed before the error.
+func (m *Machine) sendEvent(info *TransitionInfo) ([]ActionResult, error) {
+	o, e := info.Object, info.Event
+
+	if err := m.beforeGuard(*info); err != nil {
+		return nil, err
+	}
+
+	t, _, branch, err := m.resolveTransition(o, e)
 	if err != nil {
+		return nil, fmt.Errorf("SendEvent: %w", err)
+	}
+	info.Transition = t
+
+	// branch of junction is chosen while transition is resolved
+	r := &transitionRun{info: info, to: t.To, choice: m.md.getChoice(t.To), branch: branch}
+	if branch != nil {
+		r.to = branch.To
+	}
+
+	info.To = r.to
+	if t.Internal {
+		info.To = info.From
+	}
+	if err := m.beforeTransition(*info); err != nil {
 		return nil, err
 	}
 
-	if len(trs) != 1 {
-		return nil, fmt.Errorf("SendEvent: expected 1 transition in SendEvent, but got %d; input: %v, %v", len(trs), o, e)
+	return m.resume(r)
+}
+
+// resume performs transition from the next action of run until it's committed, failed or suspended
+func (m *Machine) resume(r *transitionRun) ([]ActionResult, error) {
+	o, e, t := r.info.Object, r.info.Event, r.info.Transition
+
+	for ; r.stage < stageCommit; r.stage, r.action = r.stage+1, 0 {
+		var actions []ActionDefinition
+		switch r.stage {
+		case stageExit:
+			actions = m.md.exitActions(r.info.From, t)
+		case stageTransition:
+			actions = t.Actions
+		case stageBranch:
+			if r.choice == nil {
+				continue
+			}
+			// branch of junction is already taken, otherwise guards can rely on side-effects of transition actions
+			if r.branch == nil {
+				branch, err := m.takeBranch(o, e, r.choice)
+				if err != nil {
+					return r.results, err
+				}
+				r.branch = branch
+			}
+			r.to = r.branch.To
+			actions = r.branch.Actions
+		case stageEntry:
+			actions = m.md.entryActions(r.to, t)
+		}
+		if err := m.runActions(r, actions); err != nil {
+			return r.results, err
+		}
+	}
+
+	if err := m.commit(o, e, r.info.From, r.to, t.Internal); err != nil {
+		return r.results, err
 	}
+	return r.results, nil
+}
 
-	t := trs[0]
+// commit sets status of object after actions are performed.
+// If object implements StatusSwapper then status is set with compare-and-set, so that
+// concurrent modification is detected and reported with StatusConflictError; internal transitions
+// are committed this way too, although status stays the same. Otherwise status is set with SetStatus
+// unless transition is internal.
+func (m *Machine) commit(o Object, e Event, from, to string, internal bool) error {
+	if internal {
+		to = from
+	}
 
-	var actionResults []ActionResult
+	swapper, ok := o.(StatusSwapper)
+	if !ok {
+		if internal {
+			return nil
+		}
+		if err := m.enter(o, to); err != nil {
+			return err
+		}
+		o.SetStatus(to)
+		return nil
+	}
 
-	for _, tAction := range t.Actions {
+	swapped, err := swapper.CompareAndSetStatus(from, to)
+	if err != nil {
+		return err
+	}
+	if !swapped {
+		return &StatusConflictError{Event: e, Expected: from, Target: to, Actual: o.Status()}
+	}
+
+	if internal {
+		return nil
+	}
+	// scheduled events are updated only after successful commit,
+	// otherwise events of the state set by concurrent writer would be cancelled
+	if err := m.enter(o, to); err != nil {
+		return fmt.Errorf("status is committed, but %w", err)
+	}
+	return nil
+}
+
+// SendEventByID loads object from Repository, sends event to it and saves it.
+// If Repository implements TransitionRecorder then notification about transition is saved along with object.
+// Scheduled events of object are updated only after it's saved, so that failed save keeps events of the state
+// which object stays in. It returns saved object along with results of actions. If transition is suspended
+// by asynchronous action then object isn't saved, it's returned along with results and *PendingError as by SendEvent.
+func (m *Machine) SendEventByID(id string, e Event) (Object, []ActionResult, error) {
+	if m.repository == nil {
+		return nil, nil, fmt.Errorf("SendEventByID: machine doesn't have Repository")
+	}
+
+	o, err := m.repository.Load(m.ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("SendEventByID: failed to load object %s: %w", id, err)
+	}
+
+	from := o.Status()
+	dm, entered := m.deferSchedule()
+	results, err := dm.SendEvent(o, e)
+	var pending *PendingError
+	if errors.As(err, &pending) {
+		return o, results, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := m.SaveTransition(m.repository, TransitionInfo{Object: o, Event: e, From: from, To: o.Status(), Results: results}); err != nil {
+		return nil, nil, fmt.Errorf("SendEventByID: failed to save object %s: %w", id, err)
+	}
+	if err := m.scheduleEntered(o, entered); err != nil {
+		return o, results, fmt.Errorf("SendEventByID: %w", err)
+	}
+
+	return o, results, nil
+}
+
+// SaveTransition saves object after successful transition described by info to repository. If repository
+// implements TransitionRecorder then notification about transition is saved along with object.
+// SendEventByID and DurableScheduler save objects with it; code which loads objects and sends events by itself
+// should use it too, so that no transition is missed by TransitionRecorder.
+func (m *Machine) SaveTransition(repository Repository, info TransitionInfo) error {
+	if recorder, ok := repository.(TransitionRecorder); ok {
+		return recorder.SaveTransition(m.ctx, info.Object, m.transitionEvent(info))
+	}
+	return repository.Save(m.ctx, info.Object)
+}
+
+// takeBranch returns branch of choice which should be taken by object
+func (m *Machine) takeBranch(o Object, e Event, c *Choice) (*Branch, error) {
+	branch, err := m.md.chooseBranch(m.ctx, o, c, m.aroundGuard)
+	if err != nil {
+		return nil, err
+	}
+	if branch == nil {
+		return nil, fmt.Errorf("SendEvent: %w for event '%s' in state '%s': no branch of choice '%s' is taken",
+			ErrNoTransition, e, o.Status(), c.Name)
+	}
+	return branch, nil
+}
+
+// runActions performs actions of run one by one starting from the next one and appends their results to results of run.
+// Failed action is retried according to its RetryPolicy, every attempt is wrapped by AroundAction hooks.
+// If action fails then its result is the last one. If action is pending then run is suspended.
+func (m *Machine) runActions(r *transitionRun, actions []ActionDefinition) error {
+	for ; r.action < len(actions); r.action++ {
+		tAction := actions[r.action]
 		action, err := m.md.getActionByName(tAction.Name)
 		if err != nil {
-			return nil, err
+			return err
+		}
+
+		call := m.actionCall(r.info.Object, r.info.Event, tAction, action, r.results)
+		var result ActionResult
+		if tAction.Retry.enabled() {
+			result = retry(m.ctx, tAction.Retry, call)
+		} else {
+			result = call(m.ctx)
 		}
-		result := action.F(m.ctx, o, tAction.Params, actionResults)
+		r.results = append(r.results, result)
 		if result.Err != nil {
 			// TODO use wrapped errors and wrap it with action name
-			return nil, result.Err
+			return result.Err
+		}
+		if result.Pending {
+			r.action++
+			return m.suspend(r, tAction)
 		}
-		actionResults = append(actionResults, result)
 	}
+	return nil
+}
 
-	o.SetStatus(t.To)
-	return actionResults, nil
+// actionCall returns a single attempt of action: action is called through circuit breaker if it has one,
+// with context limited by its timeout and wrapped by AroundAction hooks
+func (m *Machine) actionCall(o Object, e Event, tAction ActionDefinition, action *Action, actionResults []ActionResult) func(context.Context) ActionResult {
+	call := func(ctx context.Context) ActionResult {
+		return action.F(ctx, o, tAction.Params, actionResults)
+	}
+	if m.aroundAction != nil {
+		f := call
+		call = func(ctx context.Context) ActionResult {
+			return m.aroundAction(ctx, ActionInfo{Machine: m.md.Schema.Name, Object: o, Event: e, Action: tAction}, f)
+		}
+	}
+	if tAction.Timeout > 0 {
+		f := call
+		call = func(ctx context.Context) ActionResult {
+			ctx, cancel := context.WithTimeout(ctx, tAction.Timeout)
+			defer cancel()
+			return f(ctx)
+		}
+	}
+	if b, ok := m.breakers[tAction.Name]; ok {
+		f := call
+		call = func(ctx context.Context) ActionResult {
+			return b.call(ctx, f)
+		}
+	}
+	return call
 }
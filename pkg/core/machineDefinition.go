@@ -3,7 +3,9 @@ package core
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
+	"time"
 )
 
 // Param describes a single param for guard's condition function
@@ -27,15 +29,60 @@ type Event string
 type ActionDefinition struct {
 	Name   string
 	Params []Param
+	// Timeout limits every attempt of action with deadline of its context, there is no limit if it's zero.
+	// Action must respect cancellation of context to be interrupted.
+	Timeout time.Duration
+	// Retry is a policy of retries of failed action, action isn't retried by default
+	Retry RetryPolicy
+	// PendingTimeout limits time from pending result of asynchronous action to its completion,
+	// there is no limit if it's zero. See Machine.RunExpiry.
+	PendingTimeout time.Duration
 }
 
+// AnyState can be used as Transition.From to make transition available from any non-final state
+const AnyState = "*"
+
 // Transition is a single path between two states
 type Transition struct {
-	From    string
-	To      string
-	Event   Event
-	Guards  []Guard
-	Actions []ActionDefinition
+	// From is a source state of transition or AnyState
+	From string
+	// FromStates is a list of additional source states, e.g. if the same transition
+	// is available from several states. It can be used instead of From.
+	FromStates []string
+	// To is a target state or a name of Choice. Transition with To equal to source state
+	// is an external self-transition: exit and entry actions of the state are performed.
+	To    string
+	Event Event
+	// Internal transition doesn't change object's status and performs only its own actions
+	// without exit and entry actions of the state. To must be empty for internal transition.
+	Internal bool
+	Guards   []Guard
+	Actions  []ActionDefinition
+	// Priority is used to choose one of several transitions available for the same event
+	// when MachineDefinition's ConflictResolution is ConflictPriority; higher value wins
+	Priority int
+}
+
+// Sources returns all source states of transition: From followed by FromStates
+func (t Transition) Sources() []string {
+	if t.From == "" {
+		return t.FromStates
+	}
+	return append([]string{t.From}, t.FromStates...)
+}
+
+// hasSource returns true if transition is declared for provided state.
+// Wildcard is not taken into account here, because it depends on schema.
+func (t Transition) hasSource(state string) bool {
+	if t.From == state {
+		return true
+	}
+	for _, s := range t.FromStates {
+		if s == state {
+			return true
+		}
+	}
+	return false
 }
 
 // State marks a node in workflow's graph
@@ -43,6 +90,43 @@ type State struct {
 	Name string
 }
 
+// StateActions defines actions which are performed when object enters or leaves the state
+// in external transition
+type StateActions struct {
+	State   string
+	OnEntry []ActionDefinition
+	OnExit  []ActionDefinition
+}
+
+// Choice is a pseudostate which is used as a target of transition when target state
+// should be picked dynamically. Branches are evaluated in order of declaration and
+// the first branch with passing guards is taken; if none of them passes then Else is taken.
+type Choice struct {
+	Name     string
+	Branches []Branch
+	// Else is a target state if none of branches is taken
+	Else string
+	// Junction is evaluated before transition actions: if no branch is taken and there is no Else
+	// then transition is not available at all. Otherwise choice is evaluated after transition actions,
+	// so that guards can rely on their side-effects, and Else is required.
+	Junction bool
+}
+
+// Branch is an outgoing path of Choice. Its actions are performed after actions of transition.
+type Branch struct {
+	To      string
+	Guards  []Guard
+	Actions []ActionDefinition
+}
+
+// Timer fires Event when object stays in State for the duration After.
+// Timers are fired by Scheduler, the event is handled by regular transitions.
+type Timer struct {
+	State string
+	After time.Duration
+	Event Event
+}
+
 // Schema is a workflow configuration, TODO: add serialize/parse methods (to/from JSON)
 type Schema struct {
 	Name         string
@@ -50,6 +134,9 @@ type Schema struct {
 	FinalStates  []State
 	States       []State
 	Transitions  []Transition
+	StateActions []StateActions
+	Choices      []Choice
+	Timers       []Timer
 }
 
 // Condition wraps a function which defines if certain condition is passed for provided object or not
@@ -66,22 +153,50 @@ type Action struct {
 }
 
 // ActionResult is a struct returned by action. If Err != nil then action is considered failed.
+// Asynchronous action returns result with Pending set and completes later, see Machine.Complete.
 type ActionResult struct {
 	// Name of action which produced result
 	Name   string
 	Output interface{}
 	Err    error
+	// Attempts is a number of calls of action which has RetryPolicy, it's set by machine
+	Attempts int
+	// Pending suspends transition until action is completed or failed by Token
+	Pending bool
+	// Token correlates completion of pending action with transition, machine generates it if action doesn't set it
+	Token string
 }
 
+// ConflictResolution defines how SendEvent chooses a transition
+// when several transitions are available for the same event
+type ConflictResolution int
+
+const (
+	// ConflictError rejects event with TransitionConflictError (default)
+	ConflictError ConflictResolution = iota
+	// ConflictPriority chooses transition with the highest Priority;
+	// if several transitions share the highest priority then it's still a conflict
+	ConflictPriority
+	// ConflictDeclarationOrder chooses transition which is declared first in Schema.Transitions
+	ConflictDeclarationOrder
+)
+
 // MachineDefinition is a configuration for finite states machine
 type MachineDefinition struct {
-	Schema     Schema
-	Conditions []Condition
-	Actions    []Action
+	Schema             Schema
+	Conditions         []Condition
+	Actions            []Action
+	ConflictResolution ConflictResolution
+
+	// index is built by NewMachineDefinition; definitions created as struct literals
+	// don't have it and fall back to linear search
+	index *definitionIndex
 }
 
 // NewMachineDefinition creates new ModelDefinition and validates if it's sane.
-// Optional args: []Condition (, TODO: []Action when implemented)
+// Optional args: []Condition, []Action, ConflictResolution
+// MachineDefinition returned by this function must not be modified, because lookups are served
+// from indexes built here.
 // TODO validate if initial and final states refer to known states
 func NewMachineDefinition(schema Schema, args ...interface{}) (*MachineDefinition, error) {
 	md := &MachineDefinition{
@@ -93,44 +208,153 @@ func NewMachineDefinition(schema Schema, args ...interface{}) (*MachineDefinitio
 		switch arg := arg.(type) {
 		case []Condition:
 			md.Conditions = arg
+		case []Action:
+			md.Actions = arg
+		case ConflictResolution:
+			if arg < ConflictError || arg > ConflictDeclarationOrder {
+				return nil, fmt.Errorf("unknown conflict resolution %d in NewMachineDefinition call", arg)
+			}
+			md.ConflictResolution = arg
 		default:
 			return nil, fmt.Errorf("unknown type %T, value %v in NewMachineDefinition call", arg, arg)
 		}
 	}
 
+	states := make(map[string]struct{}, len(md.Schema.States))
+	for _, s := range md.Schema.States {
+		states[s.Name] = struct{}{}
+	}
+
+	// validate if choices are well-formed and branches refer to known states
+	choices := make(map[string]struct{}, len(md.Schema.Choices))
+	for _, c := range md.Schema.Choices {
+		if _, ok := states[c.Name]; ok {
+			return nil, fmt.Errorf("choice %s has the same name as state", c.Name)
+		}
+		if _, ok := choices[c.Name]; ok {
+			return nil, fmt.Errorf("choice %s is defined more than once", c.Name)
+		}
+		choices[c.Name] = struct{}{}
+
+		if c.Else == "" && !c.Junction {
+			return nil, fmt.Errorf("choice %s doesn't have else branch", c.Name)
+		}
+		targets := []string{}
+		if c.Else != "" {
+			targets = append(targets, c.Else)
+		}
+		for _, b := range c.Branches {
+			targets = append(targets, b.To)
+		}
+		for _, to := range targets {
+			if _, ok := states[to]; !ok {
+				return nil, fmt.Errorf("choice %s refers to state %s which doesn't exist in schema", c.Name, to)
+			}
+		}
+	}
+
 	// validate if transitions refer to known states
 	for _, t := range md.Schema.Transitions {
-		for _, ts := range []string{t.From, t.To} {
-			var stateFound bool
-			for _, s := range md.Schema.States {
-				if s.Name == ts {
-					stateFound = true
-					break
+		sources := t.Sources()
+		if len(sources) == 0 {
+			return nil, fmt.Errorf("transition %v doesn't have source state", t)
+		}
+		for _, ts := range sources {
+			if ts == AnyState {
+				if len(sources) > 1 {
+					return nil, fmt.Errorf("transition %v mixes %s with other source states", t, AnyState)
 				}
+				continue
 			}
-			if !stateFound {
+			if _, ok := states[ts]; !ok {
 				return nil, fmt.Errorf("transition %v refers to state %s which doesn't exist in schema", t, ts)
 			}
 		}
+		if t.Internal {
+			if t.To != "" {
+				return nil, fmt.Errorf("internal transition %v must not have target state", t)
+			}
+			continue
+		}
+		if _, ok := states[t.To]; !ok {
+			if _, ok := choices[t.To]; !ok {
+				return nil, fmt.Errorf("transition %v refers to state %s which doesn't exist in schema", t, t.To)
+			}
+		}
+	}
+
+	// validate if entry/exit actions refer to known states and are defined once per state
+	stateActions := make(map[string]struct{}, len(md.Schema.StateActions))
+	for _, sa := range md.Schema.StateActions {
+		if _, ok := states[sa.State]; !ok {
+			return nil, fmt.Errorf("state actions %v refer to state %s which doesn't exist in schema", sa, sa.State)
+		}
+		if _, ok := stateActions[sa.State]; ok {
+			return nil, fmt.Errorf("state actions of state %s are defined more than once", sa.State)
+		}
+		stateActions[sa.State] = struct{}{}
+	}
+
+	// validate timeouts and retry policies of actions
+	var definitions []ActionDefinition
+	for _, t := range md.Schema.Transitions {
+		definitions = append(definitions, t.Actions...)
+	}
+	for _, sa := range md.Schema.StateActions {
+		definitions = append(definitions, sa.OnEntry...)
+		definitions = append(definitions, sa.OnExit...)
+	}
+	for _, c := range md.Schema.Choices {
+		for _, b := range c.Branches {
+			definitions = append(definitions, b.Actions...)
+		}
+	}
+	for _, a := range definitions {
+		if a.Timeout < 0 || a.PendingTimeout < 0 {
+			return nil, fmt.Errorf("action %s: timeout must not be negative", a.Name)
+		}
+		if err := a.Retry.validate(); err != nil {
+			return nil, fmt.Errorf("action %s: %w", a.Name, err)
+		}
+	}
+
+	// validate if timers refer to known states
+	for _, tm := range md.Schema.Timers {
+		if _, ok := states[tm.State]; !ok {
+			return nil, fmt.Errorf("timer %v refers to state %s which doesn't exist in schema", tm, tm.State)
+		}
+		if tm.After <= 0 || tm.Event == "" {
+			return nil, fmt.Errorf("timer %v must have positive duration and event", tm)
+		}
 	}
 
 	// validate if guards refer to known conditions
 	// TODO: add also release guards when implemented
+	conditions := make(map[string]struct{}, len(md.Conditions))
+	for _, cond := range md.Conditions {
+		conditions[cond.Name] = struct{}{}
+	}
+
 	for _, t := range md.Schema.Transitions {
 		for _, g := range t.Guards {
-			var conditionFound bool
-			for _, cond := range md.Conditions {
-				if cond.Name == g.Name {
-					conditionFound = true
-					break
-				}
-			}
-			if !conditionFound {
+			if _, ok := conditions[g.Name]; !ok {
 				return nil, fmt.Errorf("guard %v in transition %v refers to condition %s which doesn't exist", g, t, g.Name)
 			}
 		}
 	}
 
+	for _, c := range md.Schema.Choices {
+		for _, b := range c.Branches {
+			for _, g := range b.Guards {
+				if _, ok := conditions[g.Name]; !ok {
+					return nil, fmt.Errorf("guard %v in choice %s refers to condition %s which doesn't exist", g, c.Name, g.Name)
+				}
+			}
+		}
+	}
+
+	md.index = newDefinitionIndex(md)
+
 	return md, nil
 }
 
@@ -138,24 +362,190 @@ func (md *MachineDefinition) getAvailableStates() []State {
 	return md.Schema.States
 }
 
+func (md *MachineDefinition) getStateByName(name string) (*State, bool) {
+	if md.index != nil {
+		s, ok := md.index.states[name]
+		return s, ok
+	}
+	for _, s := range md.Schema.States {
+		if s.Name == name {
+			return &s, true
+		}
+	}
+	return nil, false
+}
+
+func (md *MachineDefinition) isFinalState(name string) bool {
+	if md.index != nil {
+		_, ok := md.index.finalStates[name]
+		return ok
+	}
+	for _, s := range md.Schema.FinalStates {
+		if s.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (md *MachineDefinition) getConditionByName(name string) (*Condition, error) {
-	for _, cond := range md.Conditions {
-		if cond.Name == name {
-			return &cond, nil
+	if md.index != nil {
+		if cond, ok := md.index.conditions[name]; ok {
+			return cond, nil
+		}
+	} else {
+		for _, cond := range md.Conditions {
+			if cond.Name == name {
+				return &cond, nil
+			}
 		}
 	}
 	return nil, fmt.Errorf("Condition with name '%s' not found", name)
 }
 
 func (md *MachineDefinition) getActionByName(name string) (*Action, error) {
-	for _, a := range md.Actions {
-		if a.Name == name {
-			return &a, nil
+	if md.index != nil {
+		if a, ok := md.index.actions[name]; ok {
+			return a, nil
+		}
+	} else {
+		for _, a := range md.Actions {
+			if a.Name == name {
+				return &a, nil
+			}
 		}
 	}
 	return nil, fmt.Errorf("Action with name '%s' not found", name)
 }
 
+func (md *MachineDefinition) getChoice(name string) *Choice {
+	if md.index != nil {
+		return md.index.choices[name]
+	}
+	for _, c := range md.Schema.Choices {
+		if c.Name == name {
+			return &c
+		}
+	}
+	return nil
+}
+
+// getTimers returns timers of state sorted by duration
+func (md *MachineDefinition) getTimers(state string) []Timer {
+	if md.index != nil {
+		return md.index.timers[state]
+	}
+	return timersOf(md.Schema.Timers, state)
+}
+
+// timersOf returns timers of state from the list sorted by duration
+func timersOf(timers []Timer, state string) []Timer {
+	var result []Timer
+	for _, tm := range timers {
+		if tm.State == state {
+			result = append(result, tm)
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool { return result[i].After < result[j].After })
+	return result
+}
+
+func (md *MachineDefinition) getStateActions(state string) *StateActions {
+	if md.index != nil {
+		return md.index.stateActions[state]
+	}
+	for _, sa := range md.Schema.StateActions {
+		if sa.State == state {
+			return &sa
+		}
+	}
+	return nil
+}
+
+// acceptsAnyState returns true if transitions with AnyState source are available from state
+func (md *MachineDefinition) acceptsAnyState(state string) bool {
+	_, known := md.getStateByName(state)
+	return known && !md.isFinalState(state)
+}
+
+// candidateTransitions returns transitions from state 'from' in order of declaration,
+// including transitions declared with AnyState or with list of source states.
+// If event is not empty then only transitions for this event are returned.
+func (md *MachineDefinition) candidateTransitions(from string, event Event) []Transition {
+	anyState := md.acceptsAnyState(from)
+
+	if md.index != nil {
+		var direct, wildcard []int
+		if event != "" {
+			direct = md.index.byFromEvent[fromEvent{from, event}]
+			if anyState {
+				wildcard = md.index.anyFromEvent[event]
+			}
+		} else {
+			direct = md.index.byFrom[from]
+			if anyState {
+				wildcard = md.index.anyFrom
+			}
+		}
+		return md.index.transitionsAt(direct, wildcard)
+	}
+
+	var transitions []Transition
+	for _, t := range md.Schema.Transitions {
+		if !(t.hasSource(from) || (anyState && t.From == AnyState)) ||
+			// if event does matter for search then narrow down transitions to only those which contain this event
+			(event != "" && t.Event != event) {
+			continue
+		}
+		transitions = append(transitions, t)
+	}
+	return transitions
+}
+
+// exitActions returns actions which are performed when object leaves state in transition t
+func (md *MachineDefinition) exitActions(state string, t Transition) []ActionDefinition {
+	if t.Internal {
+		return nil
+	}
+	if sa := md.getStateActions(state); sa != nil {
+		return sa.OnExit
+	}
+	return nil
+}
+
+// entryActions returns actions which are performed when object enters state in transition t
+func (md *MachineDefinition) entryActions(state string, t Transition) []ActionDefinition {
+	if t.Internal {
+		return nil
+	}
+	if sa := md.getStateActions(state); sa != nil {
+		return sa.OnEntry
+	}
+	return nil
+}
+
+// chooseBranch evaluates branches of choice in order of declaration and returns the first one
+// which guards pass, or else-branch. It returns nil if nothing is taken.
+func (md *MachineDefinition) chooseBranch(ctx context.Context, o Object, c *Choice, around guardCall) (*Branch, error) {
+	for i := range c.Branches {
+		allowed, err := md.guardsPass(ctx, o, c.Branches[i].Guards, around)
+		if err != nil {
+			return nil, err
+		}
+		if allowed {
+			return &c.Branches[i], nil
+		}
+	}
+	if c.Else != "" {
+		return &Branch{To: c.Else}, nil
+	}
+	return nil, nil
+}
+
+// junctionBranches collects branches of junctions chosen by findAvailableTransitions, they are in order of
+// returned transitions and branch is nil if transition doesn't lead to junction
+type junctionBranches []*Branch
+
 // findAvailableTransitions returns transitions available for provided Object.
 // Event can be passed as optional argument to narrow search down to particular Event.
 func (md *MachineDefinition) findAvailableTransitions(ctx context.Context, o Object, args ...interface{}) ([]Transition, error) {
@@ -164,80 +554,155 @@ func (md *MachineDefinition) findAvailableTransitions(ctx context.Context, o Obj
 	// handle variadic optional args based on passed types (yay arbitrary order)
 	// TODO: add request object as in opuscapita/fsm-workflow
 	var event Event
+	// around wraps evaluation of guards, it's passed by Machine according to its hooks
+	var around guardCall
+	// branches receives chosen branches of junctions, so that they aren't evaluated again
+	var branches *junctionBranches
 
 	for _, arg := range args {
 		switch arg := arg.(type) {
 		case Event:
 			event = arg
+		case guardCall:
+			around = arg
+		case *junctionBranches:
+			branches = arg
 		default:
 			return nil, fmt.Errorf("unknown type %T, value %v in findAvailableTransitions call", arg, arg)
 		}
 	}
 
-	// In most cases one or two transitions are defined for particular 'from' state,
-	// therefore consequent loop shouldn't introduce a bottleneck
-	for _, t := range md.Schema.Transitions {
-		if t.From != o.Status() ||
-			// if event does matter for search then narrow down transitions to only those which contain this event
-			(event != "" && t.Event != event) {
-			continue
-		}
-
-		allowed, err := md.transitionAllowed(ctx, o, t)
+	for _, t := range md.candidateTransitions(o.Status(), event) {
+		allowed, err := md.guardsPass(ctx, o, t.Guards, around)
 
 		if err != nil {
 			return nil, err
 		}
 
+		// junction is evaluated in advance: transition is not available if no branch can be taken
+		var branch *Branch
+		if c := md.getChoice(t.To); allowed && c != nil && c.Junction {
+			branch, err = md.chooseBranch(ctx, o, c, around)
+			if err != nil {
+				return nil, err
+			}
+			allowed = branch != nil
+		}
+
 		if allowed {
 			transitions = append(transitions, t)
+			if branches != nil {
+				*branches = append(*branches, branch)
+			}
 		}
 	}
 	return transitions, nil
 }
 
-// transitionAllowed evaluates transition's guards concurrently and returns aggregated result
-func (md *MachineDefinition) transitionAllowed(ctx context.Context, o Object, t Transition) (bool, error) {
-	// stops all running goroutines if any
-	stopC := make(chan struct{})
-	defer close(stopC)
+// chooseTransition picks a single transition out of available ones according to ConflictResolution
+// and returns its position. Available transitions must be in order of declaration.
+func (md *MachineDefinition) chooseTransition(state string, event Event, available []Transition) (int, error) {
+	if len(available) == 0 {
+		return -1, fmt.Errorf("%w for event '%s' in state '%s'", ErrNoTransition, event, state)
+	}
 
-	results := make(chan bool)
+	if len(available) == 1 {
+		return 0, nil
+	}
 
-	var wg sync.WaitGroup
+	switch md.ConflictResolution {
+	case ConflictDeclarationOrder:
+		return 0, nil
+	case ConflictPriority:
+		var best []int
+		for i, t := range available {
+			if len(best) == 0 || t.Priority > available[best[0]].Priority {
+				best = []int{i}
+			} else if t.Priority == available[best[0]].Priority {
+				best = append(best, i)
+			}
+		}
+		if len(best) == 1 {
+			return best[0], nil
+		}
+		conflicting := make([]Transition, len(best))
+		for i, pos := range best {
+			conflicting[i] = available[pos]
+		}
+		return -1, &TransitionConflictError{State: state, Event: event, Transitions: conflicting}
+	default:
+		return -1, &TransitionConflictError{State: state, Event: event, Transitions: available}
+	}
+}
+
+// transitionAllowed evaluates transition's guards concurrently and returns aggregated result.
+// It returns as soon as any guard returns false or ctx is cancelled. Guards receive a context
+// which is cancelled in such case and are expected to respect it: transitionAllowed doesn't return
+// until all started guards are done, so no guard keeps running against the object afterwards.
+func (md *MachineDefinition) transitionAllowed(ctx context.Context, o Object, t Transition) (bool, error) {
+	return md.guardsPass(ctx, o, t.Guards, nil)
+}
 
-	for _, guard := range t.Guards {
+// guardsPass implements transitionAllowed for arbitrary list of guards. If around isn't nil
+// then evaluation of every guard is wrapped with it.
+func (md *MachineDefinition) guardsPass(ctx context.Context, o Object, guards []Guard, around guardCall) (bool, error) {
+	if len(guards) == 0 {
+		return true, nil
+	}
+
+	// resolve conditions before starting any goroutine, so that lookup error doesn't leave guards running
+	conds := make([]*Condition, len(guards))
+	for i, guard := range guards {
 		cond, err := md.getConditionByName(guard.Name)
 		if err != nil {
 			return false, err
 		}
+		conds[i] = cond
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+
+	// buffered so that guards never block on sending result even if nobody reads it anymore
+	results := make(chan bool, len(guards))
 
+	var wg sync.WaitGroup
+
+	// cancel remaining guards if function returns prematurely (one of guards returned false
+	// or parent context is cancelled) and wait until all of them are done
+	defer func() {
+		cancel()
+		wg.Wait()
+	}()
+
+	for i, guard := range guards {
 		wg.Add(1)
 		go func(cond *Condition, guard Guard) {
 			defer wg.Done() // decrement waitGroup counter before any return
 
-			select {
-			case <-ctx.Done(): // cancel if context is cancelled
-			case <-stopC: // cancel if parent function returned prematurely (one of guards returned false or/and error)
-			case results <- func() bool { // evaluate condition and send result outside
+			eval := func(ctx context.Context) bool {
 				result := cond.F(ctx, o, guard.Params)
 				if guard.Negate {
-					return !result
+					result = !result
 				}
 				return result
-			}():
 			}
-		}(cond, guard)
-	}
 
-	go func() {
-		wg.Wait()
-		close(results)
-	}()
+			if around != nil {
+				results <- around(ctx, GuardInfo{Machine: md.Schema.Name, Object: o, Guard: guard}, eval)
+			} else {
+				results <- eval(ctx)
+			}
+		}(conds[i], guard)
+	}
 
-	for r := range results {
-		if r == false {
-			return false, nil
+	for range guards {
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case r := <-results:
+			if !r {
+				return false, nil
+			}
 		}
 	}
 
@@ -2,7 +2,9 @@ package core
 
 import (
 	"context"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestMachineDefinition_NewMachineDefinition(t *testing.T) {
@@ -189,3 +191,197 @@ func TestMachineDefinition_findAvailableTransitions(t *testing.T) {
 		t.Error("should've failed for unexpected variadic arg of type 'string', but didn't")
 	}
 }
+
+func TestMachineDefinition_transitionAllowed(t *testing.T) {
+	// running counts guards which are currently executing
+	var running int32
+
+	track := func(f func(context.Context) bool) func(context.Context, Object, []Param) bool {
+		return func(ctx context.Context, o Object, params []Param) bool {
+			atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+			return f(ctx)
+		}
+	}
+
+	md := &MachineDefinition{
+		Conditions: []Condition{
+			Condition{
+				Name: "yes",
+				F:    track(func(ctx context.Context) bool { return true }),
+			},
+			Condition{
+				Name: "no",
+				F:    track(func(ctx context.Context) bool { return false }),
+			},
+			Condition{
+				// blocks until context is cancelled
+				Name: "slow",
+				F: track(func(ctx context.Context) bool {
+					<-ctx.Done()
+					return true
+				}),
+			},
+		},
+	}
+
+	ctx := context.Background()
+
+	allowed, err := md.transitionAllowed(ctx, &obj{}, Transition{
+		Guards: []Guard{Guard{Name: "yes"}, Guard{Name: "no", Negate: true}},
+	})
+	if err != nil || !allowed {
+		t.Errorf("expected transition to be allowed, got %v, %v", allowed, err)
+	}
+
+	// one guard returns false while other one is still running
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		allowed, err = md.transitionAllowed(ctx, &obj{}, Transition{
+			Guards: []Guard{Guard{Name: "slow"}, Guard{Name: "no"}, Guard{Name: "slow"}},
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("transitionAllowed didn't return after guard returned false")
+	}
+	if err != nil || allowed {
+		t.Errorf("expected transition to be rejected, got %v, %v", allowed, err)
+	}
+	if n := atomic.LoadInt32(&running); n != 0 {
+		t.Errorf("expected all guards to be done after return, but %d still running", n)
+	}
+
+	// parent context is cancelled while guard is running
+	cancelCtx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	allowed, err = md.transitionAllowed(cancelCtx, &obj{}, Transition{
+		Guards: []Guard{Guard{Name: "slow"}, Guard{Name: "yes"}},
+	})
+	if err != context.Canceled || allowed {
+		t.Errorf("expected context.Canceled error, got %v, %v", allowed, err)
+	}
+	if n := atomic.LoadInt32(&running); n != 0 {
+		t.Errorf("expected all guards to be done after return, but %d still running", n)
+	}
+
+	// unknown condition: no guard should be started at all
+	allowed, err = md.transitionAllowed(ctx, &obj{}, Transition{
+		Guards: []Guard{Guard{Name: "slow"}, Guard{Name: "unknown"}},
+	})
+	if err == nil || allowed {
+		t.Errorf("expected error for unknown condition, got %v, %v", allowed, err)
+	}
+	if n := atomic.LoadInt32(&running); n != 0 {
+		t.Errorf("expected no guards running, but %d still running", n)
+	}
+}
+
+func TestMachineDefinition_NewMachineDefinition_sources(t *testing.T) {
+	states := []State{State{Name: "one"}, State{Name: "two"}}
+
+	tests := []struct {
+		transition Transition
+		valid      bool
+	}{
+		{transition: Transition{From: AnyState, To: "two"}, valid: true},
+		{transition: Transition{FromStates: []string{"one", "two"}, To: "two"}, valid: true},
+		{transition: Transition{From: "one", FromStates: []string{"two"}, To: "two"}, valid: true},
+		{transition: Transition{From: "one", Internal: true}, valid: true},
+		{transition: Transition{To: "two"}, valid: false},
+		{transition: Transition{FromStates: []string{"one", "three"}, To: "two"}, valid: false},
+		{transition: Transition{From: AnyState, FromStates: []string{"one"}, To: "two"}, valid: false},
+		{transition: Transition{From: "one", To: "one", Internal: true}, valid: false},
+		{transition: Transition{From: AnyState}, valid: false},
+	}
+
+	for i, test := range tests {
+		_, err := NewMachineDefinition(Schema{States: states, Transitions: []Transition{test.transition}})
+		if (err == nil) != test.valid {
+			t.Errorf("test %d: expected valid = %v, got error %v", i, test.valid, err)
+		}
+	}
+
+	_, err := NewMachineDefinition(Schema{
+		States:       states,
+		StateActions: []StateActions{StateActions{State: "three"}},
+	})
+	if err == nil {
+		t.Error("should fail if state actions refer to unknown state")
+	}
+
+	_, err = NewMachineDefinition(Schema{
+		States:       states,
+		StateActions: []StateActions{StateActions{State: "one"}, StateActions{State: "one", OnEntry: []ActionDefinition{{Name: "a"}}}},
+	})
+	if err == nil {
+		t.Error("should fail if state actions of the same state are defined more than once")
+	}
+}
+
+func TestMachineDefinition_NewMachineDefinition_choices(t *testing.T) {
+	states := []State{State{Name: "one"}, State{Name: "two"}}
+	conditions := []Condition{
+		Condition{
+			Name: "ok",
+			F:    func(c context.Context, o Object, params []Param) bool { return true },
+		},
+	}
+
+	tests := []struct {
+		choice Choice
+		valid  bool
+	}{
+		{choice: Choice{Name: "c", Branches: []Branch{Branch{To: "two", Guards: []Guard{Guard{Name: "ok"}}}}, Else: "one"}, valid: true},
+		{choice: Choice{Name: "c", Branches: []Branch{Branch{To: "two"}}, Junction: true}, valid: true},
+		{choice: Choice{Name: "c", Branches: []Branch{Branch{To: "two"}}}, valid: false},
+		{choice: Choice{Name: "one", Else: "two"}, valid: false},
+		{choice: Choice{Name: "c", Else: "three"}, valid: false},
+		{choice: Choice{Name: "c", Branches: []Branch{Branch{To: "three"}}, Else: "two"}, valid: false},
+		{choice: Choice{Name: "c", Branches: []Branch{Branch{To: "two", Guards: []Guard{Guard{Name: "unknown"}}}}, Else: "one"}, valid: false},
+	}
+
+	for i, test := range tests {
+		_, err := NewMachineDefinition(Schema{
+			States:      states,
+			Transitions: []Transition{Transition{From: "one", To: "c"}},
+			Choices:     []Choice{test.choice},
+		}, conditions)
+		if (err == nil) != test.valid {
+			t.Errorf("test %d: expected valid = %v, got error %v", i, test.valid, err)
+		}
+	}
+
+	_, err := NewMachineDefinition(Schema{
+		States:  states,
+		Choices: []Choice{Choice{Name: "c", Else: "one"}, Choice{Name: "c", Else: "two"}},
+	})
+	if err == nil {
+		t.Error("should fail if choice is defined twice")
+	}
+}
+
+func TestMachineDefinition_NewMachineDefinition_timers(t *testing.T) {
+	states := []State{State{Name: "one"}}
+
+	tests := []struct {
+		timer Timer
+		valid bool
+	}{
+		{timer: Timer{State: "one", After: time.Hour, Event: "e"}, valid: true},
+		{timer: Timer{State: "two", After: time.Hour, Event: "e"}, valid: false},
+		{timer: Timer{State: "one", Event: "e"}, valid: false},
+		{timer: Timer{State: "one", After: time.Hour}, valid: false},
+	}
+
+	for i, test := range tests {
+		_, err := NewMachineDefinition(Schema{States: states, Timers: []Timer{test.timer}})
+		if (err == nil) != test.valid {
+			t.Errorf("test %d: expected valid = %v, got error %v", i, test.valid, err)
+		}
+	}
+}
@@ -2,9 +2,26 @@ package core
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
 	"testing"
 )
 
+func TestNewMachineWithOptions_unknownArg(t *testing.T) {
+	if _, err := NewMachineWithOptions(context.Background(), &MachineDefinition{}, "string arg is not expected"); err == nil {
+		t.Error("expected error for argument of unknown type")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("NewMachine should panic for argument of unknown type")
+		}
+	}()
+	NewMachine(context.Background(), &MachineDefinition{}, "string arg is not expected")
+}
+
 func TestMachine_Start(t *testing.T) {
 	initialState := "k2h3ih38olhdo32ydo93hlf34"
 
@@ -337,3 +354,489 @@ func TestMachine_SendEvent(t *testing.T) {
 		t.Error("expected error, but got nil")
 	}
 }
+
+func TestMachine_SendEvent_conflictResolution(t *testing.T) {
+	schema := Schema{
+		States: []State{State{Name: "a"}, State{Name: "b"}, State{Name: "c"}, State{Name: "d"}},
+		Transitions: []Transition{
+			Transition{From: "a", To: "b", Event: "go", Priority: 1},
+			Transition{From: "a", To: "c", Event: "go", Priority: 5},
+			Transition{From: "a", To: "d", Event: "go", Priority: 5},
+			Transition{From: "b", To: "c", Event: "go"},
+			Transition{From: "b", To: "d", Event: "go", Priority: 2},
+		},
+	}
+
+	tests := []struct {
+		resolution ConflictResolution
+		status     string
+		expected   string // empty if conflict is expected
+		conflicts  int    // number of transitions reported in conflict error
+	}{
+		{resolution: ConflictError, status: "a", conflicts: 3},
+		{resolution: ConflictError, status: "b", conflicts: 2},
+		{resolution: ConflictDeclarationOrder, status: "a", expected: "b"},
+		{resolution: ConflictDeclarationOrder, status: "b", expected: "c"},
+		{resolution: ConflictPriority, status: "a", conflicts: 2},
+		{resolution: ConflictPriority, status: "b", expected: "d"},
+	}
+
+	for i, test := range tests {
+		md, err := NewMachineDefinition(schema, test.resolution)
+		if err != nil {
+			t.Fatal(err)
+		}
+		machine := NewMachine(context.Background(), md)
+		object := &obj{status: test.status}
+
+		_, err = machine.SendEvent(object, "go")
+
+		if test.expected != "" {
+			if err != nil || object.Status() != test.expected {
+				t.Errorf("test %d: expected status %s, got %s and error %v", i, test.expected, object.Status(), err)
+			}
+			continue
+		}
+
+		var conflict *TransitionConflictError
+		if !errors.As(err, &conflict) || object.Status() != test.status {
+			t.Errorf("test %d: expected conflict error and unchanged status, got %v and %s", i, err, object.Status())
+			continue
+		}
+		if len(conflict.Transitions) != test.conflicts || conflict.State != test.status || conflict.Event != "go" {
+			t.Errorf("test %d: expected %d competing transitions in diagnostics, got %v", i, test.conflicts, conflict)
+		}
+	}
+
+	// competing transitions are reported even when conflict is resolved
+	md, _ := NewMachineDefinition(schema, ConflictPriority)
+	tr, competing, err := NewMachine(context.Background(), md).ResolveTransition(&obj{status: "b"}, "go")
+	if err != nil || tr.To != "d" || len(competing) != 2 {
+		t.Errorf("expected b->d out of 2 competing transitions, got %v, %v, %v", tr, competing, err)
+	}
+
+	// no transition available
+	_, err = NewMachine(context.Background(), md).SendEvent(&obj{status: "c"}, "go")
+	if !errors.Is(err, ErrNoTransition) {
+		t.Errorf("expected ErrNoTransition, got %v", err)
+	}
+
+	if _, err := NewMachineDefinition(schema, ConflictResolution(42)); err == nil {
+		t.Error("expected error for unknown conflict resolution")
+	}
+}
+
+func TestMachine_SendEvent_sourcesAndSelfTransitions(t *testing.T) {
+	var performed []string
+
+	record := func(name string) Action {
+		return Action{
+			Name: name,
+			F: func(ctx context.Context, o Object, params []Param, prev []ActionResult) ActionResult {
+				performed = append(performed, name)
+				return ActionResult{Name: name}
+			},
+		}
+	}
+
+	schema := Schema{
+		States:      []State{State{Name: "new"}, State{Name: "paid"}, State{Name: "shipped"}, State{Name: "cancelled"}},
+		FinalStates: []State{State{Name: "cancelled"}},
+		Transitions: []Transition{
+			Transition{From: "new", To: "paid", Event: "pay"},
+			Transition{From: AnyState, To: "cancelled", Event: "cancel"},
+			Transition{FromStates: []string{"new", "paid"}, To: "shipped", Event: "ship"},
+			Transition{From: "paid", To: "paid", Event: "refresh", Actions: []ActionDefinition{ActionDefinition{Name: "refresh"}}},
+			Transition{From: "paid", Internal: true, Event: "touch", Actions: []ActionDefinition{ActionDefinition{Name: "touch"}}},
+		},
+		StateActions: []StateActions{
+			StateActions{
+				State:   "paid",
+				OnEntry: []ActionDefinition{ActionDefinition{Name: "enterPaid"}},
+				OnExit:  []ActionDefinition{ActionDefinition{Name: "exitPaid"}},
+			},
+		},
+	}
+
+	actions := []Action{record("refresh"), record("touch"), record("enterPaid"), record("exitPaid")}
+
+	md, err := NewMachineDefinition(schema, actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the same behaviour is expected from definition without indexes
+	for _, md := range []*MachineDefinition{md, &MachineDefinition{Schema: schema, Actions: actions}} {
+		machine := NewMachine(context.Background(), md)
+
+		for _, status := range []string{"new", "paid", "shipped"} {
+			if !machine.Can(&obj{status: status}, "cancel") {
+				t.Errorf("expected wildcard transition to be available from %s", status)
+			}
+		}
+		if machine.Can(&obj{status: "cancelled"}, "cancel") || machine.Can(&obj{status: "unknown"}, "cancel") {
+			t.Error("expected wildcard transition not to be available from final or unknown state")
+		}
+		if !machine.Can(&obj{status: "new"}, "ship") || !machine.Can(&obj{status: "paid"}, "ship") ||
+			machine.Can(&obj{status: "shipped"}, "ship") {
+			t.Error("expected transition with list of sources to be available from 'new' and 'paid' only")
+		}
+
+		trs, err := machine.AvailableTransitions(&obj{status: "new"})
+		if err != nil || len(trs) != 3 || trs[0].Event != "pay" || trs[1].Event != "cancel" || trs[2].Event != "ship" {
+			t.Errorf("expected transitions in order of declaration, got %v, %v", trs, err)
+		}
+
+		tests := []struct {
+			status    string
+			event     Event
+			expected  string
+			performed []string
+		}{
+			{status: "new", event: "pay", expected: "paid", performed: []string{"enterPaid"}},
+			{status: "paid", event: "refresh", expected: "paid", performed: []string{"exitPaid", "refresh", "enterPaid"}},
+			{status: "paid", event: "touch", expected: "paid", performed: []string{"touch"}},
+			{status: "paid", event: "cancel", expected: "cancelled", performed: []string{"exitPaid"}},
+		}
+
+		for i, test := range tests {
+			performed = nil
+			object := &obj{status: test.status}
+			results, err := machine.SendEvent(object, test.event)
+			if err != nil || object.Status() != test.expected {
+				t.Errorf("test %d: expected status %s, got %s and error %v", i, test.expected, object.Status(), err)
+			}
+			if fmt.Sprint(performed) != fmt.Sprint(test.performed) || len(results) != len(test.performed) {
+				t.Errorf("test %d: expected actions %v, got %v and results %v", i, test.performed, performed, results)
+			}
+		}
+	}
+}
+
+func TestMachine_SendEvent_choice(t *testing.T) {
+	schema := Schema{
+		States: []State{State{Name: "new"}, State{Name: "review"}, State{Name: "approved"}, State{Name: "express"}},
+		Transitions: []Transition{
+			Transition{From: "new", To: "check", Event: "submit", Actions: []ActionDefinition{ActionDefinition{Name: "enable"}}},
+			Transition{From: "new", To: "route", Event: "route"},
+		},
+		Choices: []Choice{
+			Choice{
+				Name: "check",
+				Branches: []Branch{
+					Branch{To: "review", Guards: []Guard{Guard{Name: "isEnabled", Negate: true}}},
+					Branch{To: "express", Guards: []Guard{Guard{Name: "isEnabled"}}, Actions: []ActionDefinition{ActionDefinition{Name: "mark"}}},
+				},
+				Else: "approved",
+			},
+			Choice{
+				Name:     "route",
+				Junction: true,
+				Branches: []Branch{
+					Branch{To: "express", Guards: []Guard{Guard{Name: "isEnabled"}}},
+				},
+			},
+		},
+	}
+
+	var evaluations int
+	conditions := []Condition{
+		Condition{
+			Name: "isEnabled",
+			F: func(ctx context.Context, o Object, params []Param) bool {
+				evaluations++
+				return o.(*obj).enabled
+			},
+		},
+	}
+
+	actions := []Action{
+		Action{
+			Name: "enable",
+			F: func(ctx context.Context, o Object, params []Param, prev []ActionResult) ActionResult {
+				o.(*obj).enabled = true
+				return ActionResult{Name: "enable"}
+			},
+		},
+		Action{
+			Name: "mark",
+			F: func(ctx context.Context, o Object, params []Param, prev []ActionResult) ActionResult {
+				return ActionResult{Name: "mark"}
+			},
+		},
+	}
+
+	md, err := NewMachineDefinition(schema, conditions, actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := NewMachine(context.Background(), md)
+
+	// choice is evaluated after transition actions, so branch guard sees side-effect of "enable"
+	object := &obj{status: "new"}
+	results, err := machine.SendEvent(object, "submit")
+	if err != nil || object.Status() != "express" {
+		t.Errorf("expected status 'express', got %s and error %v", object.Status(), err)
+	}
+	if len(results) != 2 || results[0].Name != "enable" || results[1].Name != "mark" {
+		t.Errorf("expected results of transition and branch actions, got %v", results)
+	}
+
+	// junction is evaluated in advance and transition isn't available if no branch is taken
+	object = &obj{status: "new"}
+	if machine.Can(object, "route") {
+		t.Error("expected junction transition not to be available")
+	}
+	if _, err := machine.SendEvent(object, "route"); !errors.Is(err, ErrNoTransition) || object.Status() != "new" {
+		t.Errorf("expected ErrNoTransition and unchanged status, got %v and %s", err, object.Status())
+	}
+
+	object = &obj{status: "new", enabled: true}
+	evaluations = 0
+	if _, err := machine.SendEvent(object, "route"); err != nil || object.Status() != "express" {
+		t.Errorf("expected status 'express', got %s and error %v", object.Status(), err)
+	}
+	// branch chosen while transition is resolved is taken without evaluating junction again
+	if evaluations != 1 {
+		t.Errorf("expected guard of junction to be evaluated once, got %d", evaluations)
+	}
+
+	// else branch
+	md.Schema.Choices[0].Branches = md.Schema.Choices[0].Branches[:1]
+	md, err = NewMachineDefinition(md.Schema, conditions, actions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	object = &obj{status: "new"}
+	if _, err := NewMachine(context.Background(), md).SendEvent(object, "submit"); err != nil || object.Status() != "approved" {
+		t.Errorf("expected status 'approved', got %s and error %v", object.Status(), err)
+	}
+}
+
+// sharedRow imitates a database row shared by several replicas
+type sharedRow struct {
+	mu      sync.Mutex
+	status  string
+	version int
+}
+
+// versionedObj is a copy of sharedRow loaded by a replica
+type versionedObj struct {
+	obj
+	row     *sharedRow
+	version int
+}
+
+func (r *sharedRow) load() *versionedObj {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return &versionedObj{obj: obj{status: r.status}, row: r, version: r.version}
+}
+
+func (o *versionedObj) CompareAndSetStatus(expected, status string) (bool, error) {
+	o.row.mu.Lock()
+	defer o.row.mu.Unlock()
+	if o.row.status != expected || o.row.version != o.version {
+		// replica learns status found in storage
+		o.SetStatus(o.row.status)
+		return false, nil
+	}
+	o.row.status = status
+	o.row.version++
+	o.version = o.row.version
+	o.SetStatus(status)
+	return true, nil
+}
+
+func TestMachine_SendEvent_compareAndSet(t *testing.T) {
+	md, err := NewMachineDefinition(Schema{
+		States: []State{State{Name: "a"}, State{Name: "b"}, State{Name: "c"}},
+		Transitions: []Transition{
+			Transition{From: "a", To: "b", Event: "a->b"},
+			Transition{From: "a", To: "c", Event: "a->c"},
+			Transition{From: "a", Internal: true, Event: "touch"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := NewMachine(context.Background(), md)
+	row := &sharedRow{status: "a"}
+
+	first, second := row.load(), row.load()
+
+	if _, err := machine.SendEvent(first, "a->b"); err != nil || row.status != "b" || row.version != 1 {
+		t.Fatalf("expected status 'b' to be committed, got %v, %+v", err, row)
+	}
+
+	_, err = machine.SendEvent(second, "a->c")
+	var conflict *StatusConflictError
+	if !errors.As(err, &conflict) || !errors.Is(err, ErrStatusConflict) {
+		t.Fatalf("expected StatusConflictError, got %v", err)
+	}
+	if conflict.Expected != "a" || conflict.Target != "c" || conflict.Actual != "b" || conflict.Event != "a->c" {
+		t.Errorf("unexpected conflict details: %+v", conflict)
+	}
+	if second.Status() != "b" || row.status != "b" {
+		t.Errorf("expected conflicting transition to keep status found in storage, got %s and %s", second.Status(), row.status)
+	}
+
+	// internal transition is committed too, so that concurrent modification is detected
+	row = &sharedRow{status: "a"}
+	first, second = row.load(), row.load()
+
+	if _, err := machine.SendEvent(first, "touch"); err != nil || row.version != 1 || row.status != "a" {
+		t.Fatalf("expected internal transition to bump version, got %v, %+v", err, row)
+	}
+	if _, err := machine.SendEvent(second, "a->b"); !errors.Is(err, ErrStatusConflict) {
+		t.Errorf("expected ErrStatusConflict, got %v", err)
+	}
+
+	// reload and retry
+	second = row.load()
+	if _, err := machine.SendEvent(second, "a->b"); err != nil || row.status != "b" {
+		t.Errorf("expected retry to succeed, got %v, %+v", err, row)
+	}
+}
+
+func TestMachine_SendEventByID(t *testing.T) {
+	md, err := NewMachineDefinition(Schema{
+		States:      []State{State{Name: "a"}, State{Name: "b"}},
+		Transitions: []Transition{Transition{From: "a", To: "b", Event: "a->b", Actions: []ActionDefinition{ActionDefinition{Name: "act"}}}},
+	}, []Action{
+		Action{
+			Name: "act",
+			F: func(ctx context.Context, o Object, params []Param, prev []ActionResult) ActionResult {
+				return ActionResult{Name: "act", Output: o.(*obj).id}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := NewMachine(context.Background(), md).SendEventByID("1", "a->b"); err == nil {
+		t.Error("expected error for machine without Repository")
+	}
+
+	repo := newMemRepository(obj{id: "1", status: "a"}, obj{id: "2", status: "a"})
+	machine := NewMachine(context.Background(), md, repo)
+
+	o, results, err := machine.SendEventByID("1", "a->b")
+	if err != nil || o.Status() != "b" || len(results) != 1 || results[0].Output != "1" {
+		t.Fatalf("expected object 1 in status 'b', got %v, %v, %v", o, results, err)
+	}
+	if saved, _ := repo.Load(context.Background(), "1"); saved.Status() != "b" {
+		t.Errorf("expected object to be saved, got status %s", saved.Status())
+	}
+
+	if _, _, err := machine.SendEventByID("1", "a->b"); !errors.Is(err, ErrNoTransition) {
+		t.Errorf("expected ErrNoTransition, got %v", err)
+	}
+
+	if _, _, err := machine.SendEventByID("unknown", "a->b"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+
+	repo.setFailSave(true)
+	if _, _, err := machine.SendEventByID("2", "a->b"); err == nil {
+		t.Error("expected error when object can't be saved")
+	}
+	if saved, _ := repo.Load(context.Background(), "2"); saved.Status() != "a" {
+		t.Errorf("expected object in storage to stay in 'a', got %s", saved.Status())
+	}
+}
+
+// recordingRepository saves notifications about transitions along with objects
+type recordingRepository struct {
+	*memRepository
+	events []TransitionEvent
+}
+
+func (r *recordingRepository) SaveTransition(ctx context.Context, o Object, e TransitionEvent) error {
+	if err := r.Save(ctx, o); err != nil {
+		return err
+	}
+	r.events = append(r.events, e)
+	return nil
+}
+
+func TestMachine_SendEventByID_transitionRecorder(t *testing.T) {
+	md, err := NewMachineDefinition(Schema{
+		Name:        "ab",
+		States:      []State{{Name: "a"}, {Name: "b"}},
+		Transitions: []Transition{{From: "a", To: "b", Event: "a->b"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &recordingRepository{memRepository: newMemRepository(obj{id: "1", status: "a"}, obj{id: "2", status: "a"})}
+	clock := newFakeClock()
+	machine := NewMachine(context.Background(), md, repo, Clock(clock))
+
+	if _, _, err := machine.SendEventByID("1", "a->b"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []TransitionEvent{{Machine: "ab", ObjectID: "1", From: "a", To: "b", Event: "a->b", Time: clock.Now()}}
+	if !reflect.DeepEqual(repo.events, expected) {
+		t.Errorf("expected %+v, got %+v", expected, repo.events)
+	}
+
+	repo.setFailSave(true)
+	if _, _, err := machine.SendEventByID("2", "a->b"); err == nil {
+		t.Error("expected error when object can't be saved")
+	}
+	if len(repo.events) != 1 {
+		t.Errorf("expected no notification for failed save, got %+v", repo.events)
+	}
+}
+
+func TestMachine_WithContext(t *testing.T) {
+	md, err := NewMachineDefinition(
+		Schema{
+			InitialState: State{Name: "a"},
+			States:       []State{{Name: "a"}, {Name: "b"}},
+			Transitions: []Transition{
+				{From: "a", To: "b", Event: "go", Guards: []Guard{{Name: "hasPayload"}}, Actions: []ActionDefinition{{Name: "echo"}}},
+			},
+		},
+		[]Condition{{
+			Name: "hasPayload",
+			F: func(ctx context.Context, o Object, p []Param) bool {
+				_, ok := PayloadFrom(ctx)
+				return ok
+			},
+		}},
+		[]Action{{
+			Name: "echo",
+			F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+				payload, _ := PayloadFrom(ctx)
+				return ActionResult{Name: "echo", Output: payload}
+			},
+		}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	machine := NewMachine(context.Background(), md)
+	object := &obj{}
+	machine.Start(object)
+
+	if _, err := machine.SendEvent(object, "go"); !errors.Is(err, ErrNoTransition) {
+		t.Errorf("expected ErrNoTransition without payload, got %v", err)
+	}
+
+	results, err := machine.WithContext(WithPayload(context.Background(), "hello")).SendEvent(object, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].Output != "hello" || object.Status() != "b" {
+		t.Errorf("expected payload to be passed to action, got %v in state %s", results, object.Status())
+	}
+	if machine.Schema().Name != md.Schema.Name {
+		t.Error("expected schema of definition")
+	}
+}
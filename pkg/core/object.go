@@ -1,7 +1,58 @@
 package core
 
+import (
+	"context"
+	"fmt"
+)
+
 // Object is an interface for business object which is a subject of workflow
 type Object interface {
 	Status() string
 	SetStatus(string)
 }
+
+// Identifiable is an optional interface for objects which have stable identity, e.g. primary key.
+// It's required by components which track objects over time, like Scheduler.
+type Identifiable interface {
+	ID() string
+}
+
+// objectID returns identity of object if it implements Identifiable and its ID isn't empty,
+// otherwise objects without ID would share mailbox, pending transition and scheduled events
+func objectID(o Object) (string, error) {
+	i, ok := o.(Identifiable)
+	if !ok {
+		return "", fmt.Errorf("object %v doesn't implement Identifiable", o)
+	}
+	id := i.ID()
+	if id == "" {
+		return "", fmt.Errorf("object %v has empty ID", o)
+	}
+	return id, nil
+}
+
+// StatusSwapper is an optional interface for objects which are stored in shared storage and can be
+// modified concurrently, e.g. by several replicas of a service. If object implements it then Machine
+// commits transition with CompareAndSetStatus instead of SetStatus.
+type StatusSwapper interface {
+	// CompareAndSetStatus atomically sets status if object in storage still has expected status
+	// (and typically the same version as when object was loaded). It returns false if object was
+	// modified concurrently; in-memory status can be set to status found in storage then, so that
+	// StatusConflictError reports it. On success in-memory status must be updated as well.
+	CompareAndSetStatus(expected, status string) (bool, error)
+}
+
+// Repository loads and saves objects by identity.
+// Load should return ErrObjectNotFound (possibly wrapped) if object doesn't exist.
+type Repository interface {
+	Load(ctx context.Context, id string) (Object, error)
+	Save(ctx context.Context, o Object) error
+}
+
+// TransitionRecorder is an optional extension of Repository. If repository implements it then
+// Machine.SaveTransition saves object after transition with SaveTransition instead of Save, so that
+// notification about transition can be stored in the same unit of work as the new status,
+// e.g. in the same database transaction (transactional outbox).
+type TransitionRecorder interface {
+	SaveTransition(ctx context.Context, o Object, e TransitionEvent) error
+}
@@ -1,11 +1,23 @@
 package core
 
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
 // concrete implementation of Object interface for tests in this package
 type obj struct {
+	id      string // identity for components which track objects
 	status  string // status field for interactions with FSM
 	enabled bool   // some business data
 }
 
+func (o *obj) ID() string {
+	return o.id
+}
+
 func (o *obj) Status() string {
 	return o.status
 }
@@ -13,3 +25,44 @@ func (o *obj) Status() string {
 func (o *obj) SetStatus(s string) {
 	o.status = s
 }
+
+// memRepository is a Repository for tests in this package which stores copies of obj
+type memRepository struct {
+	mu       sync.Mutex
+	objects  map[string]obj
+	failSave bool
+}
+
+func newMemRepository(objects ...obj) *memRepository {
+	r := &memRepository{objects: make(map[string]obj)}
+	for _, o := range objects {
+		r.objects[o.id] = o
+	}
+	return r
+}
+
+func (r *memRepository) Load(ctx context.Context, id string) (Object, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.objects[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrObjectNotFound, id)
+	}
+	return &o, nil
+}
+
+func (r *memRepository) Save(ctx context.Context, o Object) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failSave {
+		return errors.New("database is down")
+	}
+	r.objects[o.(*obj).id] = *o.(*obj)
+	return nil
+}
+
+func (r *memRepository) setFailSave(fail bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failSave = fail
+}
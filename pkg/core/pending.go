@@ -0,0 +1,495 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrPending is matched by PendingError
+var ErrPending = errors.New("transition is pending")
+
+// ErrInFlight is returned when event is sent to object which has pending transition
+var ErrInFlight = errors.New("object has pending transition")
+
+// ErrPendingNotFound is returned by Complete and Fail if there is no pending transition with provided token,
+// e.g. it's completed or expired already
+var ErrPendingNotFound = errors.New("pending transition not found")
+
+// ErrPendingTimeout is matched by errors of pending transitions which are not completed before deadline
+var ErrPendingTimeout = errors.New("pending transition timed out")
+
+// PendingError is returned by SendEvent when asynchronous action returns pending result.
+// Transition is suspended until Machine.Complete or Machine.Fail is called with Token.
+type PendingError struct {
+	Token  string
+	Action string
+}
+
+func (e *PendingError) Error() string {
+	return fmt.Sprintf("%v: action '%s' waits for completion, token %s", ErrPending, e.Action, e.Token)
+}
+
+// Is makes PendingError match ErrPending
+func (e *PendingError) Is(target error) bool {
+	return target == ErrPending
+}
+
+// PendingTransition describes transition which waits for completion of asynchronous action.
+// Status of object stays the same until transition is completed.
+type PendingTransition struct {
+	Token    string
+	ObjectID string
+	Event    Event
+	From     string
+	// To is a target state, it's a name of choice if branch isn't taken yet
+	To string
+	// Action is a name of pending action
+	Action string
+	Since  time.Time
+	// Deadline is zero if action doesn't have PendingTimeout
+	Deadline time.Time
+	// Results are results of actions performed so far, the last one is a pending result of Action.
+	// PendingStore can encode outputs, e.g. as JSON, then the rest of actions receives decoded outputs.
+	Results []ActionResult
+	// Resume is a position in schema which transition is resumed from, it's opaque for PendingStore
+	Resume string
+}
+
+// PendingStore persists pending transitions, so that they survive restart of process and can be completed
+// by another process. Machine keeps pending transitions in its Repository or ScheduleStore if it implements
+// PendingStore, see NewMachineWithOptions.
+type PendingStore interface {
+	// AddPending stores pending transition. It returns error which wraps ErrInFlight if object has pending transition
+	// already, or another error if token is used by another transition.
+	AddPending(ctx context.Context, p PendingTransition) error
+	// TakePending removes pending transition and returns it, so that only one caller can finish it.
+	// It returns error which wraps ErrPendingNotFound if there is no transition with token.
+	TakePending(ctx context.Context, token string) (PendingTransition, error)
+	// PendingOf returns pending transition of object, ok is false if there is none
+	PendingOf(ctx context.Context, objectID string) (p PendingTransition, ok bool, err error)
+	// ListPending returns all pending transitions ordered by Since and then by Token
+	ListPending(ctx context.Context) ([]PendingTransition, error)
+}
+
+// memoryPending keeps pending transitions of machine which has neither Repository nor ScheduleStore,
+// along with their objects, because objects can't be loaded by ID then
+type memoryPending struct {
+	mu      sync.Mutex
+	pending map[string]PendingTransition
+	objects map[string]Object
+}
+
+func newMemoryPending() *memoryPending {
+	return &memoryPending{pending: map[string]PendingTransition{}, objects: map[string]Object{}}
+}
+
+// AddPending implements PendingStore
+func (s *memoryPending) AddPending(ctx context.Context, p PendingTransition) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.pending[p.Token]; ok {
+		return fmt.Errorf("token %s is used by another pending transition", p.Token)
+	}
+	for _, other := range s.pending {
+		if other.ObjectID == p.ObjectID {
+			return fmt.Errorf("%w: object %s, token %s", ErrInFlight, p.ObjectID, other.Token)
+		}
+	}
+	s.pending[p.Token] = p
+	return nil
+}
+
+// TakePending implements PendingStore
+func (s *memoryPending) TakePending(ctx context.Context, token string) (PendingTransition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.pending[token]
+	if !ok {
+		return PendingTransition{}, fmt.Errorf("%w: token %s", ErrPendingNotFound, token)
+	}
+	delete(s.pending, token)
+	return p, nil
+}
+
+// PendingOf implements PendingStore
+func (s *memoryPending) PendingOf(ctx context.Context, objectID string) (PendingTransition, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, p := range s.pending {
+		if p.ObjectID == objectID {
+			return p, true, nil
+		}
+	}
+	return PendingTransition{}, false, nil
+}
+
+// ListPending implements PendingStore
+func (s *memoryPending) ListPending(ctx context.Context) ([]PendingTransition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := make([]PendingTransition, 0, len(s.pending))
+	for _, p := range s.pending {
+		pending = append(pending, p)
+	}
+	SortPending(pending)
+	return pending, nil
+}
+
+// setObject keeps object of pending transition
+func (s *memoryPending) setObject(token string, o Object) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.objects[token] = o
+}
+
+// takeObject returns object of pending transition and forgets it
+func (s *memoryPending) takeObject(token string) (Object, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.objects[token]
+	delete(s.objects, token)
+	return o, ok
+}
+
+// SortPending sorts transitions by time of suspension and then by token, as PendingStore.ListPending returns them
+func SortPending(pending []PendingTransition) {
+	sort.Slice(pending, func(i, j int) bool {
+		a, b := pending[i], pending[j]
+		if !a.Since.Equal(b.Since) {
+			return a.Since.Before(b.Since)
+		}
+		return a.Token < b.Token
+	})
+}
+
+// expired returns true if pending action isn't completed before deadline
+func (p PendingTransition) expired(now time.Time) bool {
+	return !p.Deadline.IsZero() && !now.Before(p.Deadline)
+}
+
+// newToken returns random correlation token
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// suspend records transition in machine's PendingStore until its pending action is completed and returns PendingError.
+// The last result of run is a pending result of action, token is generated for it unless action has set it.
+func (m *Machine) suspend(r *transitionRun, a ActionDefinition) error {
+	if m.pending == nil {
+		return fmt.Errorf("asynchronous action '%s' requires Repository or ScheduleStore which implements PendingStore", a.Name)
+	}
+	id, err := objectID(r.info.Object)
+	if err != nil {
+		return fmt.Errorf("asynchronous action '%s': %w", a.Name, err)
+	}
+
+	result := &r.results[len(r.results)-1]
+	if result.Token == "" {
+		if result.Token, err = newToken(); err != nil {
+			return fmt.Errorf("failed to generate token of action '%s': %w", a.Name, err)
+		}
+	}
+
+	now := m.clock.Now()
+	r.pending = PendingTransition{
+		Token:    result.Token,
+		ObjectID: id,
+		Event:    r.info.Event,
+		From:     r.info.From,
+		To:       r.to,
+		Action:   a.Name,
+		Since:    now,
+		Results:  append([]ActionResult(nil), r.results...),
+		Resume:   m.resumePosition(r),
+	}
+	if a.PendingTimeout > 0 {
+		r.pending.Deadline = now.Add(a.PendingTimeout)
+	}
+
+	if err := m.pending.AddPending(m.ctx, r.pending); err != nil {
+		return err
+	}
+	if mem, ok := m.pending.(*memoryPending); ok {
+		mem.setObject(r.pending.Token, r.info.Object)
+	}
+	return &PendingError{Token: result.Token, Action: a.Name}
+}
+
+// resumePosition encodes position of run in schema: index of transition, index of branch of choice
+// (-1 if there is none, number of branches for else-branch), stage and the next action
+func (m *Machine) resumePosition(r *transitionRun) string {
+	transition := -1
+	for i, t := range m.md.Schema.Transitions {
+		if reflect.DeepEqual(t, r.info.Transition) {
+			transition = i
+			break
+		}
+	}
+	branch := -1
+	if r.choice != nil && r.branch != nil {
+		branch = len(r.choice.Branches)
+		for i, b := range r.choice.Branches {
+			if reflect.DeepEqual(b, *r.branch) {
+				branch = i
+				break
+			}
+		}
+	}
+	return fmt.Sprintf("%d.%d.%d.%d", transition, branch, r.stage, r.action)
+}
+
+// restore returns run of pending transition. Object is loaded from Repository, unless machine keeps
+// pending transitions in memory along with objects.
+func (m *Machine) restore(p PendingTransition) (*transitionRun, error) {
+	var o Object
+	if mem, ok := m.pending.(*memoryPending); ok {
+		if o, ok = mem.takeObject(p.Token); !ok {
+			return nil, fmt.Errorf("object of pending transition %s is not found", p.Token)
+		}
+	} else {
+		if m.repository == nil {
+			return nil, fmt.Errorf("machine doesn't have Repository to load object %s", p.ObjectID)
+		}
+		var err error
+		if o, err = m.repository.Load(m.ctx, p.ObjectID); err != nil {
+			return nil, fmt.Errorf("failed to load object %s: %w", p.ObjectID, err)
+		}
+	}
+
+	var transition, branch int
+	r := &transitionRun{to: p.To, results: p.Results, pending: p}
+	_, err := fmt.Sscanf(p.Resume, "%d.%d.%d.%d", &transition, &branch, &r.stage, &r.action)
+	if err != nil || transition < 0 || transition >= len(m.md.Schema.Transitions) {
+		return nil, fmt.Errorf("pending transition %s can't be resumed from position '%s'", p.Token, p.Resume)
+	}
+	t := m.md.Schema.Transitions[transition]
+	r.choice = m.md.getChoice(t.To)
+	if r.choice != nil && branch >= 0 {
+		if branch > len(r.choice.Branches) {
+			return nil, fmt.Errorf("pending transition %s can't be resumed from position '%s'", p.Token, p.Resume)
+		}
+		if branch < len(r.choice.Branches) {
+			r.branch = &r.choice.Branches[branch]
+		} else {
+			r.branch = &Branch{To: r.choice.Else}
+		}
+	}
+
+	r.info = &TransitionInfo{Machine: m.md.Schema.Name, Object: o, Event: p.Event, From: p.From, To: p.To, Transition: t}
+	if t.Internal {
+		r.info.To = p.From
+	}
+	return r, nil
+}
+
+// take removes pending transition from machine's PendingStore and restores its run. If run can't be restored,
+// e.g. object can't be loaded, then transition is put back, so that it can be finished later.
+func (m *Machine) take(token string) (*transitionRun, error) {
+	if m.pending == nil {
+		return nil, fmt.Errorf("%w: token %s", ErrPendingNotFound, token)
+	}
+	p, err := m.pending.TakePending(m.ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	r, err := m.restore(p)
+	if err != nil {
+		if putErr := m.pending.AddPending(m.ctx, p); putErr != nil {
+			return nil, fmt.Errorf("%w, and transition can't be put back: %v", err, putErr)
+		}
+		return nil, err
+	}
+	return r, nil
+}
+
+// Pending returns pending transition of object, object must implement Identifiable
+func (m *Machine) Pending(o Object) (PendingTransition, bool, error) {
+	if m.pending == nil {
+		return PendingTransition{}, false, nil
+	}
+	id, err := objectID(o)
+	if err != nil {
+		return PendingTransition{}, false, err
+	}
+	return m.pending.PendingOf(m.ctx, id)
+}
+
+// PendingTransitions returns all pending transitions of machine ordered by time of suspension
+func (m *Machine) PendingTransitions() ([]PendingTransition, error) {
+	if m.pending == nil {
+		return nil, nil
+	}
+	return m.pending.ListPending(m.ctx)
+}
+
+// Complete resumes pending transition with output of asynchronous action: the rest of actions are performed
+// and status of object is set, hooks are called as for SendEvent. Transition can be suspended again by another
+// asynchronous action. Complete returns object of transition along with results of all actions of transition.
+//
+// Object is loaded from machine's Repository by ID, so that changes made while transition was pending aren't
+// overwritten; if its status isn't From of pending transition anymore then transition fails with
+// *StatusConflictError. Object which implements StatusSwapper is committed with compare-and-set, as by SendEvent.
+// After successful transition object is saved with SaveTransition, as by SendEventByID. Machine without
+// Repository and ScheduleStore keeps objects of pending transitions in memory and doesn't save them.
+//
+// If transition is expired then it fails with ErrPendingTimeout. Complete and Fail are wrapped by AroundCall hooks
+// with methods "Complete" and "Fail".
+func (m *Machine) Complete(token string, output interface{}) (Object, []ActionResult, error) {
+	r, err := m.take(token)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Complete: %w", err)
+	}
+	o := r.info.Object
+
+	if r.pending.expired(m.clock.Now()) {
+		return o, nil, m.call("Fail", o, r.info.Event, func(m *Machine) error {
+			return m.abort(r, r.timeoutError())
+		})
+	}
+	if o.Status() != r.pending.From {
+		conflict := &StatusConflictError{Event: r.info.Event, Expected: r.pending.From, Target: r.pending.To, Actual: o.Status()}
+		return o, nil, m.call("Complete", o, r.info.Event, func(m *Machine) error {
+			return m.abort(r, conflict)
+		})
+	}
+
+	dm, entered := m.deferSchedule()
+	var results []ActionResult
+	err = dm.call("Complete", o, r.info.Event, func(m *Machine) error {
+		n := len(r.results)
+		result := r.results[n-1]
+		result.Pending = false
+		result.Output = output
+		// results returned by SendEvent stay intact
+		r.results = append(r.results[:n-1:n-1], result)
+
+		var err error
+		results, err = m.resume(r)
+		results, err = m.finish(r.info, results, err)
+		return err
+	})
+	var pending *PendingError
+	if errors.As(err, &pending) {
+		return o, results, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if m.repository == nil {
+		return o, results, m.scheduleEntered(o, entered)
+	}
+
+	info := TransitionInfo{Object: o, Event: r.info.Event, From: r.info.From, To: o.Status(), Results: results}
+	if err := m.SaveTransition(m.repository, info); err != nil {
+		return nil, nil, fmt.Errorf("Complete: failed to save object %s: %w", r.pending.ObjectID, err)
+	}
+	if err := m.scheduleEntered(o, entered); err != nil {
+		return o, results, fmt.Errorf("Complete: %w", err)
+	}
+	return o, results, nil
+}
+
+// Fail fails pending transition with cause as error of asynchronous action, status of object stays the same
+// and OnError hooks are called. It returns cause or error which wraps ErrPendingNotFound.
+func (m *Machine) Fail(token string, cause error) error {
+	r, err := m.take(token)
+	if err != nil {
+		return fmt.Errorf("Fail: %w", err)
+	}
+	if cause == nil {
+		cause = fmt.Errorf("action '%s' failed", r.pending.Action)
+	}
+
+	return m.call("Fail", r.info.Object, r.info.Event, func(m *Machine) error {
+		return m.abort(r, cause)
+	})
+}
+
+// ExpirePending fails pending transitions which are not completed before deadline with error which wraps
+// ErrPendingTimeout and returns them. It should be called periodically, e.g. by RunExpiry. Transitions which
+// are finished concurrently are skipped; error is returned if store fails or objects of transitions
+// can't be loaded, such transitions are kept and expired by the next call.
+func (m *Machine) ExpirePending() ([]PendingTransition, error) {
+	all, err := m.PendingTransitions()
+	if err != nil {
+		return nil, err
+	}
+
+	var expired []PendingTransition
+	var errs []error
+	now := m.clock.Now()
+	for _, p := range all {
+		if !p.expired(now) {
+			continue
+		}
+		r, err := m.take(p.Token)
+		if errors.Is(err, ErrPendingNotFound) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		m.call("Fail", r.info.Object, r.info.Event, func(m *Machine) error {
+			return m.abort(r, r.timeoutError())
+		})
+		expired = append(expired, r.pending)
+	}
+	return expired, errors.Join(errs...)
+}
+
+// RunExpiry calls ExpirePending with provided interval until context is cancelled, ctx is passed to hooks and
+// PendingStore. Expired transitions are passed to optional callback. It returns error of ExpirePending, if any.
+func (m *Machine) RunExpiry(ctx context.Context, interval time.Duration, callback func(PendingTransition)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	m = m.WithContext(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			expired, err := m.ExpirePending()
+			for _, p := range expired {
+				if callback != nil {
+					callback(p)
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// abort fails transition with err of its pending action
+func (m *Machine) abort(r *transitionRun, err error) error {
+	n := len(r.results)
+	result := r.results[n-1]
+	result.Pending = false
+	result.Err = err
+	r.results = append(r.results[:n-1:n-1], result)
+
+	_, err = m.finish(r.info, r.results, err)
+	return err
+}
+
+func (r *transitionRun) timeoutError() error {
+	return fmt.Errorf("action '%s': %w after %v", r.pending.Action, ErrPendingTimeout, r.pending.Deadline.Sub(r.pending.Since))
+}
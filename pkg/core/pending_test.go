@@ -0,0 +1,374 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// anonymous is an object without identity
+type anonymous struct{ status string }
+
+func (o *anonymous) Status() string     { return o.status }
+func (o *anonymous) SetStatus(s string) { o.status = s }
+
+func TestMachine_pending(t *testing.T) {
+	var token string
+	var archived []ActionResult
+	result := func(name string) Action {
+		return Action{Name: name, F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+			return ActionResult{Name: name}
+		}}
+	}
+
+	md, err := NewMachineDefinition(
+		Schema{
+			InitialState: State{Name: "draft"},
+			States:       []State{{Name: "draft"}, {Name: "signed"}},
+			Transitions: []Transition{
+				{From: "draft", To: "signed", Event: "sign", Actions: []ActionDefinition{
+					{Name: "prepare"}, {Name: "sign", PendingTimeout: time.Hour}, {Name: "archive"},
+				}},
+				{From: "draft", To: "draft", Event: "edit"},
+			},
+			StateActions: []StateActions{{State: "draft", OnExit: []ActionDefinition{{Name: "leave"}}}},
+		},
+		[]Action{
+			result("leave"),
+			result("prepare"),
+			{Name: "sign", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+				return ActionResult{Name: "sign", Pending: true, Token: token}
+			}},
+			{Name: "archive", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+				archived = r
+				return ActionResult{Name: "archive"}
+			}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var after, failed []TransitionInfo
+	hooks := Hooks{
+		AfterTransition: func(ctx context.Context, info TransitionInfo) { after = append(after, info) },
+		OnError:         func(ctx context.Context, info TransitionInfo) { failed = append(failed, info) },
+	}
+	clock := newFakeClock()
+	machine := NewMachine(context.Background(), md, clock, hooks)
+
+	// asynchronous action suspends transition
+	object := &obj{id: "1", status: "draft"}
+	results, err := machine.SendEvent(object, "sign")
+	var pendingErr *PendingError
+	if !errors.As(err, &pendingErr) || !errors.Is(err, ErrPending) || pendingErr.Action != "sign" || pendingErr.Token == "" {
+		t.Fatalf("expected pending error, got %v", err)
+	}
+	generated := pendingErr.Token
+	expected := []ActionResult{{Name: "leave"}, {Name: "prepare"}, {Name: "sign", Pending: true, Token: generated}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+	if object.status != "draft" || len(after) != 0 || len(failed) != 0 {
+		t.Errorf("expected transition to be suspended, got status %s, %d successful and %d failed transitions",
+			object.status, len(after), len(failed))
+	}
+
+	p, ok, err := machine.Pending(object)
+	expectedPending := PendingTransition{
+		Token: generated, ObjectID: "1", Event: "sign", From: "draft", To: "signed", Action: "sign",
+		Since: clock.Now(), Deadline: clock.Now().Add(time.Hour), Results: results, Resume: "0.-1.1.2",
+	}
+	if err != nil || !ok || !reflect.DeepEqual(p, expectedPending) {
+		t.Errorf("expected %+v, got %+v, %v", expectedPending, p, err)
+	}
+	if all, err := machine.PendingTransitions(); err != nil || len(all) != 1 || !reflect.DeepEqual(all[0], expectedPending) {
+		t.Errorf("expected the only pending transition, got %+v, %v", all, err)
+	}
+
+	// object with pending transition rejects events
+	if _, err := machine.SendEvent(object, "edit"); !errors.Is(err, ErrInFlight) {
+		t.Errorf("expected object to be in flight, got %v", err)
+	}
+	if machine.Can(object, "edit") {
+		t.Error("expected no available transitions for object in flight")
+	}
+	failed = nil
+
+	// completion performs the rest of actions and sets status
+	completed, results, err := machine.Complete(generated, "signature")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = []ActionResult{{Name: "leave"}, {Name: "prepare"}, {Name: "sign", Output: "signature", Token: generated}, {Name: "archive"}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+	if !reflect.DeepEqual(archived, expected[:3]) {
+		t.Errorf("expected output of completed action to be passed to next actions, got %v", archived)
+	}
+	if completed != object || object.status != "signed" {
+		t.Errorf("expected status to be set on completion, got %s", object.status)
+	}
+	if len(after) != 1 || after[0].From != "draft" || after[0].To != "signed" || !reflect.DeepEqual(after[0].Results, expected) {
+		t.Errorf("expected AfterTransition hook on completion, got %+v", after)
+	}
+	if _, ok, _ := machine.Pending(object); ok {
+		t.Error("expected no pending transition after completion")
+	}
+	if _, _, err := machine.Complete(generated, nil); !errors.Is(err, ErrPendingNotFound) {
+		t.Errorf("expected completed transition not to be found, got %v", err)
+	}
+
+	// failure of asynchronous action fails transition
+	object = &obj{id: "2", status: "draft"}
+	token = "envelope-2"
+	if _, err := machine.SendEvent(object, "sign"); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got %v", err)
+	}
+	if _, err := machine.SendEvent(&obj{id: "3", status: "draft"}, "sign"); err == nil || errors.Is(err, ErrPending) {
+		t.Errorf("expected error for token which is already used, got %v", err)
+	}
+	failed = nil
+	cause := errors.New("declined")
+	if err := machine.Fail("envelope-2", cause); err != cause {
+		t.Errorf("expected cause of failure, got %v", err)
+	}
+	if object.status != "draft" || len(failed) != 1 || failed[0].Err != cause || failed[0].Results[2].Err != cause {
+		t.Errorf("expected OnError hook and the same status, got %s and %+v", object.status, failed)
+	}
+	if err := machine.Fail("envelope-2", cause); !errors.Is(err, ErrPendingNotFound) {
+		t.Errorf("expected failed transition not to be found, got %v", err)
+	}
+	if _, err := machine.SendEvent(object, "edit"); err != nil {
+		t.Errorf("expected object to accept events after failure, got %v", err)
+	}
+
+	// asynchronous action requires identity of object
+	token = ""
+	if _, err := machine.SendEvent(&anonymous{status: "draft"}, "sign"); err == nil || errors.Is(err, ErrPending) {
+		t.Errorf("expected error for object without identity, got %v", err)
+	}
+}
+
+func TestMachine_ExpirePending(t *testing.T) {
+	md := newApprovalDefinition(t)
+
+	var failed []error
+	clock := newFakeClock()
+	machine := NewMachine(context.Background(), md, clock, Hooks{OnError: func(ctx context.Context, info TransitionInfo) {
+		failed = append(failed, info.Err)
+	}})
+
+	first, second := &obj{id: "1", status: "a"}, &obj{id: "2", status: "a"}
+	machine.SendEvent(first, "go")
+	clock.Advance(time.Second)
+	machine.SendEvent(second, "go")
+
+	clock.Advance(time.Minute - time.Second)
+	expired, err := machine.ExpirePending()
+	if err != nil || len(expired) != 1 || expired[0].Token != "1" {
+		t.Errorf("expected the first transition to expire, got %+v, %v", expired, err)
+	}
+	if len(failed) != 1 || !errors.Is(failed[0], ErrPendingTimeout) {
+		t.Errorf("expected OnError hook with timeout, got %v", failed)
+	}
+	if _, _, err := machine.Complete("1", nil); !errors.Is(err, ErrPendingNotFound) {
+		t.Errorf("expected expired transition not to be found, got %v", err)
+	}
+
+	// completion after deadline fails too
+	clock.Advance(time.Second)
+	if _, _, err := machine.Complete("2", nil); !errors.Is(err, ErrPendingTimeout) {
+		t.Errorf("expected timeout, got %v", err)
+	}
+	if all, _ := machine.PendingTransitions(); second.status != "a" || len(all) != 0 {
+		t.Errorf("expected expired transition to fail, got status %s", second.status)
+	}
+}
+
+// newApprovalDefinition returns definition with asynchronous action "approve" which uses ID of object as token
+func newApprovalDefinition(t *testing.T) *MachineDefinition {
+	md, err := NewMachineDefinition(
+		Schema{
+			Name:         "approval",
+			InitialState: State{Name: "a"},
+			States:       []State{{Name: "a"}, {Name: "b"}},
+			Transitions:  []Transition{{From: "a", To: "b", Event: "go", Actions: []ActionDefinition{{Name: "approve", PendingTimeout: time.Minute}}}},
+		},
+		[]Action{{Name: "approve", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+			return ActionResult{Name: "approve", Pending: true, Token: o.(*obj).id}
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return md
+}
+
+func TestMachine_Complete_repository(t *testing.T) {
+	repo := &recordingRepository{memRepository: newMemRepository(obj{id: "1", status: "a"}, obj{id: "2", status: "a"})}
+	clock := newFakeClock()
+	store := newMemScheduleStore()
+	machine := NewMachine(context.Background(), newApprovalDefinition(t), repo, store, Clock(clock))
+
+	o, results, err := machine.SendEventByID("1", "go")
+	if !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got %v", err)
+	}
+	expectedResults := []ActionResult{{Name: "approve", Pending: true, Token: "1"}}
+	if o == nil || o.Status() != "a" || !reflect.DeepEqual(results, expectedResults) {
+		t.Errorf("expected object in state a and pending result, got %v, %+v", o, results)
+	}
+
+	// object is changed while transition is pending, and transition is completed by another process
+	repo.objects["1"] = obj{id: "1", status: "a", enabled: true}
+	machine = NewMachine(context.Background(), newApprovalDefinition(t), repo, store, Clock(clock))
+	if _, _, err := machine.Complete("1", "ok"); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := repo.Load(context.Background(), "1"); saved.Status() != "b" || !saved.(*obj).enabled {
+		t.Errorf("expected completed transition to be saved without losing changes, got %+v", saved)
+	}
+	expected := []TransitionEvent{{
+		Machine: "approval", ObjectID: "1", From: "a", To: "b", Event: "go", Time: clock.Now(),
+		Results: []ActionResult{{Name: "approve", Output: "ok", Token: "1"}},
+	}}
+	if !reflect.DeepEqual(repo.events, expected) {
+		t.Errorf("expected %+v, got %+v", expected, repo.events)
+	}
+
+	repo.setFailSave(true)
+	if _, _, err := machine.SendEventByID("2", "go"); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got %v", err)
+	}
+	if _, _, err := machine.Complete("2", "ok"); err == nil {
+		t.Error("expected error of failed save")
+	}
+}
+
+func TestMachine_Complete_conflict(t *testing.T) {
+	repo := newMemRepository(obj{id: "1", status: "a"}, obj{id: "2", status: "a"})
+	var failed []TransitionInfo
+	machine := NewMachine(context.Background(), newApprovalDefinition(t), repo, newMemScheduleStore(),
+		Hooks{OnError: func(ctx context.Context, info TransitionInfo) { failed = append(failed, info) }})
+
+	if _, _, err := machine.SendEventByID("1", "go"); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got %v", err)
+	}
+	// status is changed while transition is pending
+	repo.objects["1"] = obj{id: "1", status: "b"}
+	o, _, err := machine.Complete("1", "ok")
+	var conflict *StatusConflictError
+	if !errors.As(err, &conflict) || conflict.Expected != "a" || conflict.Target != "b" || conflict.Actual != "b" {
+		t.Fatalf("expected status conflict, got %v", err)
+	}
+	if o == nil || o.Status() != "b" || len(failed) != 1 || failed[0].Err != err {
+		t.Errorf("expected transition to fail with object from repository, got %v and %+v", o, failed)
+	}
+	if _, _, err := machine.Complete("1", "ok"); !errors.Is(err, ErrPendingNotFound) {
+		t.Errorf("expected conflicting transition to be finished, got %v", err)
+	}
+
+	// transition is kept if object can't be loaded
+	if _, _, err := machine.SendEventByID("2", "go"); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got %v", err)
+	}
+	delete(repo.objects, "2")
+	if _, _, err := machine.Complete("2", "ok"); !errors.Is(err, ErrObjectNotFound) {
+		t.Errorf("expected object not to be found, got %v", err)
+	}
+	if p, ok, err := machine.Pending(&obj{id: "2"}); err != nil || !ok || p.Token != "2" {
+		t.Errorf("expected transition to be kept, got %+v, %v", p, err)
+	}
+}
+
+func TestMachine_pendingStore(t *testing.T) {
+	md := newApprovalDefinition(t)
+
+	// pending transitions are kept by Repository or ScheduleStore if machine has one of them
+	machine := NewMachine(context.Background(), md, newMemRepository(obj{id: "1", status: "a"}))
+	if _, _, err := machine.SendEventByID("1", "go"); err == nil || errors.Is(err, ErrPending) {
+		t.Errorf("expected error without PendingStore, got %v", err)
+	}
+
+	// transition is resumed after branch of choice
+	md, err := NewMachineDefinition(
+		Schema{
+			Name:         "approval",
+			InitialState: State{Name: "a"},
+			States:       []State{{Name: "a"}, {Name: "b"}, {Name: "c"}},
+			Choices: []Choice{{Name: "decide", Else: "b", Branches: []Branch{
+				{To: "b", Guards: []Guard{{Name: "never"}}},
+				{To: "c", Guards: []Guard{{Name: "always"}}, Actions: []ActionDefinition{{Name: "approve"}, {Name: "notify"}}},
+			}}},
+			Transitions: []Transition{{From: "b", To: "a", Event: "back"}, {From: "a", To: "decide", Event: "go"}},
+		},
+		[]Condition{
+			{Name: "never", F: func(ctx context.Context, o Object, p []Param) bool { return false }},
+			{Name: "always", F: func(ctx context.Context, o Object, p []Param) bool { return true }},
+		},
+		[]Action{
+			{Name: "approve", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+				return ActionResult{Name: "approve", Pending: true, Token: o.(*obj).id}
+			}},
+			{Name: "notify", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+				return ActionResult{Name: "notify", Output: r[0].Output}
+			}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo, store := newMemRepository(obj{id: "1", status: "a"}), newMemScheduleStore()
+	machine = NewMachine(context.Background(), md, repo, store)
+	if _, _, err := machine.SendEventByID("1", "go"); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got %v", err)
+	}
+	if p, _, _ := machine.Pending(&obj{id: "1"}); p.Resume != "1.1.2.1" || p.To != "c" {
+		t.Errorf("expected transition to be suspended in branch, got %+v", p)
+	}
+	o, results, err := NewMachine(context.Background(), md, repo, store).Complete("1", "ok")
+	expected := []ActionResult{{Name: "approve", Output: "ok", Token: "1"}, {Name: "notify", Output: "ok"}}
+	if err != nil || o.Status() != "c" || !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected transition to be completed in branch, got %v, %+v, %v", o, results, err)
+	}
+}
+
+func TestMachine_RunExpiry(t *testing.T) {
+	clock := newFakeClock()
+	var failed []error
+	machine := NewMachine(context.Background(), newApprovalDefinition(t), clock,
+		Hooks{OnError: func(ctx context.Context, info TransitionInfo) { failed = append(failed, info.Err) }})
+
+	if _, err := machine.SendEvent(&obj{id: "1", status: "a"}, "go"); !errors.Is(err, ErrPending) {
+		t.Fatalf("expected pending error, got %v", err)
+	}
+	clock.Advance(time.Minute)
+
+	// timers don't expire pending transitions
+	NewScheduler(machine, clock).Poll()
+	if all, _ := machine.PendingTransitions(); len(all) != 1 {
+		t.Fatal("expected pending transition to be kept by scheduler")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	expired := make(chan PendingTransition)
+	done := make(chan struct{})
+	go func() {
+		if err := machine.RunExpiry(ctx, time.Millisecond, func(p PendingTransition) { expired <- p }); err != context.Canceled {
+			t.Errorf("expected context error, got %v", err)
+		}
+		close(done)
+	}()
+	if p := <-expired; p.Token != "1" {
+		t.Errorf("expected transition of object 1 to expire, got %+v", p)
+	}
+	cancel()
+	<-done
+	if all, _ := machine.PendingTransitions(); len(failed) != 1 || !errors.Is(failed[0], ErrPendingTimeout) || len(all) != 0 {
+		t.Errorf("expected expired transition to fail, got %v", failed)
+	}
+}
@@ -0,0 +1,92 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy defines how SendEvent retries action which returned error. Zero value means no retries.
+//
+// Delay before the n-th retry is InitialBackoff * Multiplier^(n-1) capped by MaxBackoff, then randomized
+// by Jitter: with Jitter 0.2 delay of 1s becomes a random value between 0.8s and 1.2s. Waiting stops when
+// context of machine is done, SendEvent fails with the last error of action then.
+type RetryPolicy struct {
+	// MaxAttempts is a maximum number of calls of action including the first one, values below 2 disable retries
+	MaxAttempts int
+	// InitialBackoff is a delay before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps delay between attempts, delay isn't capped if it's zero
+	MaxBackoff time.Duration
+	// Multiplier increases delay after every retry, 2 if it's zero
+	Multiplier float64
+	// Jitter is a fraction of delay which is randomized, between 0 and 1
+	Jitter float64
+	// Retryable reports whether error of action should be retried, all errors are retried if it's nil
+	Retryable func(error) bool
+}
+
+// enabled returns true if policy allows retries
+func (p RetryPolicy) enabled() bool {
+	return p.MaxAttempts > 1
+}
+
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 0 || p.InitialBackoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("retry policy must not have negative attempts or backoff")
+	}
+	if p.Multiplier != 0 && p.Multiplier < 1 {
+		return fmt.Errorf("multiplier of retry policy must not be less than 1, got %v", p.Multiplier)
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return fmt.Errorf("jitter of retry policy must be between 0 and 1, got %v", p.Jitter)
+	}
+	return nil
+}
+
+// retryable returns true if err should be retried after provided number of attempts
+func (p RetryPolicy) retryable(err error, attempts int) bool {
+	if attempts >= p.MaxAttempts {
+		return false
+	}
+	return p.Retryable == nil || p.Retryable(err)
+}
+
+// delay returns delay before the next attempt after provided number of attempts, r is a random number in [0, 1)
+func (p RetryPolicy) delay(attempts int, r float64) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier == 0 {
+		multiplier = 2
+	}
+
+	d := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempts-1))
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	d *= 1 + p.Jitter*(2*r-1)
+	return time.Duration(d)
+}
+
+// retry calls action until it succeeds or policy stops retries, Attempts of the last result are set
+func retry(ctx context.Context, p RetryPolicy, call func(context.Context) ActionResult) ActionResult {
+	for attempts := 1; ; attempts++ {
+		result := call(ctx)
+		result.Attempts = attempts
+		// action fails fast while its circuit breaker is open, so it is not retried
+		if result.Err == nil || errors.Is(result.Err, ErrCircuitOpen) || !p.retryable(result.Err, attempts) {
+			return result
+		}
+
+		timer := time.NewTimer(p.delay(attempts, rand.Float64()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			result.Err = fmt.Errorf("%w, retries are stopped: %w", result.Err, ctx.Err())
+			return result
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_delay(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: time.Second, MaxBackoff: 5 * time.Second}
+
+	var delays []time.Duration
+	for attempts := 1; attempts <= 4; attempts++ {
+		delays = append(delays, p.delay(attempts, 0.5))
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	if !reflect.DeepEqual(delays, expected) {
+		t.Errorf("expected %v, got %v", expected, delays)
+	}
+
+	p = RetryPolicy{InitialBackoff: time.Second, Multiplier: 3, Jitter: 0.2}
+	if d := p.delay(2, 0); d != 2400*time.Millisecond {
+		t.Errorf("expected lower bound of jitter, got %v", d)
+	}
+	if d := p.delay(2, 1); d != 3600*time.Millisecond {
+		t.Errorf("expected upper bound of jitter, got %v", d)
+	}
+}
+
+func TestMachine_SendEvent_retry(t *testing.T) {
+	errTemporary := errors.New("temporary")
+	errPermanent := errors.New("permanent")
+
+	var failures []error
+	var hookCalls int
+	newMachine := func(ctx context.Context, policy RetryPolicy) *Machine {
+		md, err := NewMachineDefinition(
+			Schema{
+				InitialState: State{Name: "a"},
+				States:       []State{{Name: "a"}, {Name: "b"}},
+				Transitions: []Transition{
+					{From: "a", To: "b", Event: "go", Actions: []ActionDefinition{{Name: "first"}, {Name: "flaky", Retry: policy}}},
+				},
+			},
+			[]Action{
+				{Name: "first", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+					return ActionResult{Name: "first"}
+				}},
+				{Name: "flaky", F: func(ctx context.Context, o Object, p []Param, r []ActionResult) ActionResult {
+					if len(r) != 1 {
+						t.Errorf("expected results of previous actions only, got %v", r)
+					}
+					if len(failures) > 0 {
+						err := failures[0]
+						failures = failures[1:]
+						return ActionResult{Name: "flaky", Err: err}
+					}
+					return ActionResult{Name: "flaky", Output: "done"}
+				}},
+			},
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hooks := Hooks{AroundAction: func(ctx context.Context, info ActionInfo, next func(context.Context) ActionResult) ActionResult {
+			hookCalls++
+			return next(ctx)
+		}}
+		return NewMachine(ctx, md, hooks)
+	}
+
+	policy := RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		Jitter:         0.5,
+		Retryable:      func(err error) bool { return !errors.Is(err, errPermanent) },
+	}
+
+	// action succeeds after retries
+	failures, hookCalls = []error{errTemporary, errTemporary}, 0
+	results, err := newMachine(context.Background(), policy).SendEvent(&obj{status: "a"}, "go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []ActionResult{{Name: "first"}, {Name: "flaky", Output: "done", Attempts: 3}}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("expected %v, got %v", expected, results)
+	}
+	if hookCalls != 4 {
+		t.Errorf("expected every attempt to be wrapped by hooks, got %d calls", hookCalls)
+	}
+
+	// attempts are exhausted
+	failures = []error{errTemporary, errTemporary, errTemporary}
+	object := &obj{status: "a"}
+	if _, err := newMachine(context.Background(), policy).SendEvent(object, "go"); !errors.Is(err, errTemporary) {
+		t.Errorf("expected error of the last attempt, got %v", err)
+	}
+	if object.status != "a" || len(failures) != 0 {
+		t.Errorf("expected transition to fail after 3 attempts, got status %s and %d unused failures", object.status, len(failures))
+	}
+
+	// error which isn't retryable stops retries
+	failures = []error{errTemporary, errPermanent, errTemporary}
+	if _, err := newMachine(context.Background(), policy).SendEvent(&obj{status: "a"}, "go"); !errors.Is(err, errPermanent) {
+		t.Errorf("expected permanent error, got %v", err)
+	}
+	if len(failures) != 1 {
+		t.Errorf("expected retries to stop at permanent error, got %d unused failures", len(failures))
+	}
+
+	// cancellation of context stops waiting for the next attempt
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	failures = []error{errTemporary, errTemporary}
+	policy = RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Minute}
+	start := time.Now()
+	_, err = newMachine(ctx, policy).SendEvent(&obj{status: "a"}, "go")
+	if !errors.Is(err, errTemporary) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected error of action and context, got %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("expected retries to stop when context is done")
+	}
+}
+
+func TestNewMachineDefinition_retryPolicy(t *testing.T) {
+	for _, policy := range []RetryPolicy{
+		{MaxAttempts: -1},
+		{MaxAttempts: 2, InitialBackoff: -time.Second},
+		{MaxAttempts: 2, Multiplier: 0.5},
+		{MaxAttempts: 2, Jitter: 1.5},
+	} {
+		_, err := NewMachineDefinition(
+			Schema{
+				InitialState: State{Name: "a"},
+				States:       []State{{Name: "a"}},
+				StateActions: []StateActions{{State: "a", OnEntry: []ActionDefinition{{Name: "x", Retry: policy}}}},
+			},
+		)
+		if err == nil {
+			t.Errorf("expected error for policy %+v", policy)
+		}
+	}
+}
@@ -0,0 +1,416 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Scheduler fires events of Schema.Timers for tracked objects through Machine.SendEvent
+// when objects stay in a state long enough. It keeps track of objects in memory only.
+type Scheduler struct {
+	m     *Machine
+	clock Clock
+
+	mu      sync.Mutex
+	entries map[string]*trackedObject
+}
+
+// trackedObject is a state of a single object tracked by Scheduler
+type trackedObject struct {
+	o         Object
+	state     string
+	enteredAt time.Time
+	// fired contains events of timers which were already fired since object entered the state
+	fired map[Event]bool
+}
+
+// FiredTimer is a result of timer's event sent to object
+type FiredTimer struct {
+	ObjectID string
+	Timer    Timer
+	Results  []ActionResult
+	Err      error
+}
+
+// NewScheduler returns scheduler for machine which uses provided clock, SystemClock if nil
+func NewScheduler(m *Machine, clock Clock) *Scheduler {
+	if clock == nil {
+		clock = SystemClock
+	}
+	return &Scheduler{
+		m:       m,
+		clock:   clock,
+		entries: make(map[string]*trackedObject),
+	}
+}
+
+// Track starts tracking of object, which must implement Identifiable.
+// Object is considered to enter its current state at the moment of call,
+// therefore Track should be called right after Machine.Start or Machine.SendEvent.
+// Tracking an object with the same identity again replaces previous record.
+func (s *Scheduler) Track(o Object) error {
+	id, err := objectID(o)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[id] = &trackedObject{
+		o:         o,
+		state:     o.Status(),
+		enteredAt: s.clock.Now(),
+		fired:     make(map[Event]bool),
+	}
+	return nil
+}
+
+// Untrack stops tracking of object with provided identity
+func (s *Scheduler) Untrack(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, id)
+}
+
+// Poll fires events of all due timers and returns their results.
+// Status changes made outside of Scheduler are detected here, so that object is considered to enter
+// new state at the moment of Poll; objects which reach final state are not tracked anymore.
+// Each timer fires at most once per stay in a state, even if event is rejected.
+func (s *Scheduler) Poll() []FiredTimer {
+	type dueTimer struct {
+		id    string
+		entry *trackedObject
+		timer Timer
+	}
+
+	now := s.clock.Now()
+
+	var due []dueTimer
+
+	s.mu.Lock()
+	for id, entry := range s.entries {
+		s.refresh(entry, now)
+		if s.m.IsInFinalState(entry.o) {
+			delete(s.entries, id)
+			continue
+		}
+		for _, tm := range s.m.md.getTimers(entry.state) {
+			if entry.fired[tm.Event] || now.Sub(entry.enteredAt) < tm.After {
+				continue
+			}
+			entry.fired[tm.Event] = true
+			due = append(due, dueTimer{id, entry, tm})
+		}
+	}
+	s.mu.Unlock()
+
+	var fired []FiredTimer
+
+	for _, d := range due {
+		// previous timer could move object to another state already
+		if d.entry.o.Status() != d.timer.State {
+			continue
+		}
+		results, err := s.m.SendEvent(d.entry.o, d.timer.Event)
+		fired = append(fired, FiredTimer{ObjectID: d.id, Timer: d.timer, Results: results, Err: err})
+	}
+
+	s.mu.Lock()
+	for _, d := range due {
+		s.refresh(d.entry, now)
+		if s.entries[d.id] == d.entry && s.m.IsInFinalState(d.entry.o) {
+			delete(s.entries, d.id)
+		}
+	}
+	s.mu.Unlock()
+
+	return fired
+}
+
+// refresh resets timers of entry if object's status has changed
+func (s *Scheduler) refresh(entry *trackedObject, now time.Time) {
+	if status := entry.o.Status(); status != entry.state {
+		entry.state = status
+		entry.enteredAt = now
+		entry.fired = make(map[Event]bool)
+	}
+}
+
+// Run polls scheduler with provided interval until context is cancelled.
+// Results of fired timers are passed to optional callback.
+func (s *Scheduler) Run(ctx context.Context, interval time.Duration, callback func(FiredTimer)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for _, f := range s.Poll() {
+				if callback != nil {
+					callback(f)
+				}
+			}
+		}
+	}
+}
+
+// ScheduledEvent is an event of timer which is pending for object
+type ScheduledEvent struct {
+	// ID is unique for object, state, event and due time
+	ID       string
+	ObjectID string
+	// State in which object should stay for event to be sent
+	State string
+	Event Event
+	Due   time.Time
+}
+
+// ScheduleStore persists scheduled events so that they survive restart of process
+type ScheduleStore interface {
+	// Schedule stores events replacing existing ones with the same ID
+	Schedule(ctx context.Context, events ...ScheduledEvent) error
+	// Cancel removes all pending events of object except events with IDs listed in keep
+	Cancel(ctx context.Context, objectID string, keep ...string) error
+	// Due returns events which are due at provided moment ordered by due time
+	Due(ctx context.Context, now time.Time) ([]ScheduledEvent, error)
+	// Done removes delivered event; it's not an error if event doesn't exist anymore
+	Done(ctx context.Context, id string) error
+}
+
+// Schedule records events of timers of object's current state in machine's ScheduleStore, replacing events
+// scheduled for object before. Machine schedules events by itself when object enters a state by transition;
+// Schedule should be called once object started by Start is saved. It does nothing if machine has no ScheduleStore.
+func (m *Machine) Schedule(o Object) error {
+	return m.reschedule(o, o.Status())
+}
+
+// enteredState is a state entered by object, see Machine.entered
+type enteredState struct {
+	state string
+	ok    bool
+}
+
+// deferSchedule returns copy of machine which only records state entered by object instead of updating
+// scheduled events, so that they are updated with scheduleEntered after object is saved
+func (m *Machine) deferSchedule() (*Machine, *enteredState) {
+	c := *m
+	c.entered = &enteredState{}
+	return &c, c.entered
+}
+
+// enter updates scheduled events of object which enters state, unless it's deferred by deferSchedule
+func (m *Machine) enter(o Object, state string) error {
+	if m.entered != nil {
+		*m.entered = enteredState{state: state, ok: true}
+		return nil
+	}
+	return m.reschedule(o, state)
+}
+
+// scheduleEntered updates scheduled events of saved object if it has entered a state
+func (m *Machine) scheduleEntered(o Object, entered *enteredState) error {
+	if !entered.ok {
+		return nil
+	}
+	if err := m.reschedule(o, entered.state); err != nil {
+		return fmt.Errorf("object is saved, but %w", err)
+	}
+	return nil
+}
+
+// reschedule cancels pending events of object and records events of timers of the state
+// which object is going to enter. It does nothing if machine has no ScheduleStore.
+// Event which is being delivered by DurableScheduler isn't cancelled, scheduler removes it after object is saved.
+func (m *Machine) reschedule(o Object, state string) error {
+	if m.scheduleStore == nil {
+		return nil
+	}
+
+	id, err := objectID(o)
+	if err != nil {
+		return err
+	}
+
+	var keep []string
+	if m.delivering != "" {
+		keep = append(keep, m.delivering)
+	}
+	if err := m.scheduleStore.Cancel(m.ctx, id, keep...); err != nil {
+		return fmt.Errorf("failed to cancel scheduled events of object %s: %w", id, err)
+	}
+
+	timers := m.md.getTimers(state)
+	if len(timers) == 0 {
+		return nil
+	}
+
+	now := m.clock.Now()
+	events := make([]ScheduledEvent, len(timers))
+	for i, tm := range timers {
+		due := now.Add(tm.After)
+		events[i] = ScheduledEvent{
+			ID:       fmt.Sprintf("%s/%s/%s/%d", id, state, tm.Event, due.UnixNano()),
+			ObjectID: id,
+			State:    state,
+			Event:    tm.Event,
+			Due:      due,
+		}
+	}
+
+	if err := m.scheduleStore.Schedule(m.ctx, events...); err != nil {
+		return fmt.Errorf("failed to schedule events of object %s: %w", id, err)
+	}
+	return nil
+}
+
+// ObjectLoader loads object by its identity
+type ObjectLoader func(ctx context.Context, id string) (Object, error)
+
+// ObjectSaver persists object after transition
+type ObjectSaver func(ctx context.Context, o Object) error
+
+// DurableScheduler delivers events recorded in machine's ScheduleStore when they are due,
+// including events which were scheduled before restart of process. Objects are loaded from
+// and saved to machine's Repository, as with Machine.SendEventByID, unless ObjectLoader or ObjectSaver
+// are passed to NewDurableScheduler.
+//
+// Delivery is at-least-once: events of object are rescheduled and delivered event is removed from store
+// only after object is saved. Therefore events which failed to be delivered, e.g. because process crashed
+// before object was saved, are retried on next Poll, and events of the state which object stays in are kept.
+// An event is dropped without delivery if object isn't in the event's state anymore or if event is
+// rejected by machine because there is no transition for it.
+type DurableScheduler struct {
+	m    *Machine
+	load ObjectLoader
+	save ObjectSaver
+}
+
+// NewDurableScheduler returns scheduler for machine configured with ScheduleStore.
+// Optional args: ObjectLoader and ObjectSaver, which replace Load and Save of machine's Repository;
+// machine must have Repository unless both of them are passed. Notification about transition is saved
+// along with object only if Repository implements TransitionRecorder and ObjectSaver isn't passed.
+func NewDurableScheduler(m *Machine, args ...interface{}) (*DurableScheduler, error) {
+	s := &DurableScheduler{m: m}
+
+	// handle variadic optional args based on passed types
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case ObjectLoader:
+			s.load = arg
+		case func(context.Context, string) (Object, error):
+			s.load = arg
+		case ObjectSaver:
+			s.save = arg
+		case func(context.Context, Object) error:
+			s.save = arg
+		default:
+			return nil, fmt.Errorf("unknown type %T, value %v in NewDurableScheduler call", arg, arg)
+		}
+	}
+
+	if m.scheduleStore == nil {
+		return nil, fmt.Errorf("machine doesn't have ScheduleStore")
+	}
+	if m.repository == nil && (s.load == nil || s.save == nil) {
+		return nil, fmt.Errorf("machine doesn't have Repository")
+	}
+	return s, nil
+}
+
+// Poll delivers all due events and returns their results. Error is returned only if due events
+// can't be read from store; errors of individual deliveries are returned in results.
+func (s *DurableScheduler) Poll(ctx context.Context) ([]FiredTimer, error) {
+	events, err := s.m.scheduleStore.Due(ctx, s.m.clock.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	var fired []FiredTimer
+	for _, ev := range events {
+		results, delivered, err := s.deliver(ctx, ev)
+		if !delivered && err == nil {
+			continue
+		}
+		fired = append(fired, FiredTimer{
+			ObjectID: ev.ObjectID,
+			Timer:    Timer{State: ev.State, Event: ev.Event},
+			Results:  results,
+			Err:      err,
+		})
+	}
+	return fired, nil
+}
+
+// deliver sends scheduled event to object. It returns delivered == false without error if event is stale.
+// Context of Poll is passed to guards, actions and stores.
+func (s *DurableScheduler) deliver(ctx context.Context, ev ScheduledEvent) ([]ActionResult, bool, error) {
+	m := s.m.WithContext(ctx)
+	m.delivering = ev.ID
+
+	load := s.load
+	if load == nil {
+		load = m.repository.Load
+	}
+	o, err := load(ctx, ev.ObjectID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if o.Status() != ev.State {
+		return nil, false, m.scheduleStore.Done(ctx, ev.ID)
+	}
+
+	dm, entered := m.deferSchedule()
+	results, err := dm.SendEvent(o, ev.Event)
+	if errors.Is(err, ErrNoTransition) {
+		return nil, false, m.scheduleStore.Done(ctx, ev.ID)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	// event is kept in store until object is saved, so it's retried if save fails
+	if s.save != nil {
+		err = s.save(ctx, o)
+	} else {
+		err = m.SaveTransition(m.repository, TransitionInfo{Object: o, Event: ev.Event, From: ev.State, To: o.Status(), Results: results})
+	}
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to save object: %w", err)
+	}
+	// delivered event isn't cancelled, it's removed after events of object are rescheduled
+	if err := m.scheduleEntered(o, entered); err != nil {
+		return results, true, err
+	}
+
+	return results, true, m.scheduleStore.Done(ctx, ev.ID)
+}
+
+// Run polls scheduler with provided interval until context is cancelled.
+// Results of deliveries are passed to optional callback.
+func (s *DurableScheduler) Run(ctx context.Context, interval time.Duration, callback func(FiredTimer)) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			fired, err := s.Poll(ctx)
+			if err != nil {
+				return err
+			}
+			for _, f := range fired {
+				if callback != nil {
+					callback(f)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,403 @@
+package core
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	md, err := NewMachineDefinition(Schema{
+		InitialState: State{Name: "awaiting_payment"},
+		FinalStates:  []State{State{Name: "expired"}},
+		States:       []State{State{Name: "awaiting_payment"}, State{Name: "paid"}, State{Name: "expired"}},
+		Transitions: []Transition{
+			Transition{From: "awaiting_payment", To: "paid", Event: "pay"},
+			Transition{From: "awaiting_payment", Internal: true, Event: "remind"},
+			Transition{From: "awaiting_payment", To: "expired", Event: "expire"},
+		},
+		Timers: []Timer{
+			Timer{State: "awaiting_payment", After: 48 * time.Hour, Event: "expire"},
+			Timer{State: "awaiting_payment", After: 24 * time.Hour, Event: "remind"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	machine := NewMachine(context.Background(), md)
+	scheduler := NewScheduler(machine, clock)
+
+	if err := scheduler.Track(struct{ Object }{&obj{}}); err == nil {
+		t.Error("expected error for object without identity")
+	}
+
+	expiring := &obj{id: "1"}
+	paying := &obj{id: "2"}
+	for _, o := range []*obj{expiring, paying} {
+		machine.Start(o)
+		if err := scheduler.Track(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	clock.Advance(23 * time.Hour)
+	if fired := scheduler.Poll(); len(fired) != 0 {
+		t.Errorf("expected no timers to fire, got %v", fired)
+	}
+
+	// status is changed outside of scheduler: timers of the previous state don't apply anymore
+	if _, err := machine.SendEvent(paying, "pay"); err != nil {
+		t.Fatal(err)
+	}
+
+	clock.Advance(time.Hour)
+	fired := scheduler.Poll()
+	if len(fired) != 1 || fired[0].ObjectID != "1" || fired[0].Timer.Event != "remind" || fired[0].Err != nil {
+		t.Errorf("expected 'remind' to fire for object 1, got %v", fired)
+	}
+
+	// timer fires only once per stay in a state
+	clock.Advance(time.Hour)
+	if fired := scheduler.Poll(); len(fired) != 0 {
+		t.Errorf("expected no timers to fire, got %v", fired)
+	}
+
+	clock.Advance(23 * time.Hour)
+	fired = scheduler.Poll()
+	if len(fired) != 1 || fired[0].Timer.Event != "expire" || fired[0].Err != nil || expiring.Status() != "expired" {
+		t.Errorf("expected object 1 to expire, got %v and status %s", fired, expiring.Status())
+	}
+	if paying.Status() != "paid" {
+		t.Errorf("expected object 2 to stay paid, got %s", paying.Status())
+	}
+
+	// object in final state is not tracked anymore
+	scheduler.mu.Lock()
+	_, tracked := scheduler.entries["1"]
+	scheduler.mu.Unlock()
+	if tracked {
+		t.Error("expected object in final state not to be tracked")
+	}
+
+	// both timers are due at once: they fire in order of duration
+	late := &obj{id: "3"}
+	machine.Start(late)
+	scheduler.Track(late)
+	scheduler.Untrack("2")
+
+	clock.Advance(72 * time.Hour)
+	fired = scheduler.Poll()
+	if len(fired) != 2 || fired[0].Timer.Event != "remind" || fired[1].Timer.Event != "expire" || late.Status() != "expired" {
+		t.Errorf("expected 'remind' and 'expire' to fire for object 3, got %v", fired)
+	}
+}
+
+func TestScheduler_Run(t *testing.T) {
+	md, err := NewMachineDefinition(Schema{
+		States:      []State{State{Name: "a"}, State{Name: "b"}},
+		Transitions: []Transition{Transition{From: "a", To: "b", Event: "timeout"}},
+		Timers:      []Timer{Timer{State: "a", After: time.Millisecond, Event: "timeout"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scheduler := NewScheduler(NewMachine(context.Background(), md), nil)
+	scheduler.Track(&obj{id: "1", status: "a"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scheduler.Run(ctx, time.Millisecond, func(f FiredTimer) {
+			if f.Err == nil {
+				cancel()
+			}
+		})
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		cancel()
+		t.Fatal("timer didn't fire")
+	}
+}
+
+// memScheduleStore is an in-memory ScheduleStore for tests, it keeps pending transitions too
+type memScheduleStore struct {
+	*memoryPending
+	mu     sync.Mutex
+	events map[string]ScheduledEvent
+}
+
+func newMemScheduleStore() *memScheduleStore {
+	return &memScheduleStore{memoryPending: newMemoryPending(), events: make(map[string]ScheduledEvent)}
+}
+
+func (s *memScheduleStore) Schedule(ctx context.Context, events ...ScheduledEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, ev := range events {
+		s.events[ev.ID] = ev
+	}
+	return nil
+}
+
+func (s *memScheduleStore) Cancel(ctx context.Context, objectID string, keep ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, ev := range s.events {
+		if ev.ObjectID == objectID && !contains(keep, id) {
+			delete(s.events, id)
+		}
+	}
+	return nil
+}
+
+func contains(ids []string, id string) bool {
+	for _, i := range ids {
+		if i == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *memScheduleStore) Due(ctx context.Context, now time.Time) ([]ScheduledEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []ScheduledEvent
+	for _, ev := range s.events {
+		if !ev.Due.After(now) {
+			due = append(due, ev)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Due.Before(due[j].Due) })
+	return due, nil
+}
+
+func (s *memScheduleStore) Done(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.events, id)
+	return nil
+}
+
+func ids(events []ScheduledEvent) []string {
+	ids := make([]string, len(events))
+	for i, ev := range events {
+		ids[i] = ev.ID
+	}
+	return ids
+}
+
+func (s *memScheduleStore) pending(objectID string) []ScheduledEvent {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []ScheduledEvent
+	for _, ev := range s.events {
+		if ev.ObjectID == objectID {
+			events = append(events, ev)
+		}
+	}
+	return events
+}
+
+func TestDurableScheduler(t *testing.T) {
+	md, err := NewMachineDefinition(Schema{
+		InitialState: State{Name: "awaiting_payment"},
+		States:       []State{State{Name: "awaiting_payment"}, State{Name: "paid"}, State{Name: "expired"}},
+		Transitions: []Transition{
+			Transition{From: "awaiting_payment", To: "paid", Event: "pay"},
+			Transition{From: "awaiting_payment", To: "expired", Event: "expire"},
+			Transition{From: "paid", To: "paid", Event: "renew"},
+		},
+		Timers: []Timer{
+			Timer{State: "awaiting_payment", After: 48 * time.Hour, Event: "expire"},
+			Timer{State: "paid", After: time.Hour, Event: "renew"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	clock := newFakeClock()
+	store := newMemScheduleStore()
+
+	repo := newMemRepository()
+	machine := NewMachine(context.Background(), md, clock, ScheduleStore(store), repo)
+
+	// machine requires object identity for scheduling
+	if err := machine.Schedule(struct{ Object }{&obj{status: "new"}}); err == nil {
+		t.Error("expected error for object without identity")
+	}
+
+	for _, id := range []string{"1", "2"} {
+		o := &obj{id: id}
+		machine.Start(o)
+		repo.Save(ctx, o)
+		if err := machine.Schedule(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if events := store.pending("1"); len(events) != 1 || events[0].Event != "expire" {
+		t.Fatalf("expected 'expire' to be scheduled on start, got %v", events)
+	}
+
+	// leaving state cancels its events and schedules events of the new state
+	if _, _, err := machine.SendEventByID("2", "pay"); err != nil {
+		t.Fatal(err)
+	}
+	if events := store.pending("2"); len(events) != 1 || events[0].Event != "renew" {
+		t.Fatalf("expected only 'renew' to be scheduled after payment, got %v", events)
+	}
+
+	// process restarts: new machine and scheduler with the same store
+	type ctxKey struct{}
+	var delivered []interface{}
+	hooks := Hooks{AfterTransition: func(ctx context.Context, info TransitionInfo) {
+		delivered = append(delivered, ctx.Value(ctxKey{}))
+	}}
+	machine = NewMachine(context.Background(), md, clock, ScheduleStore(store), repo, hooks)
+	scheduler, err := NewDurableScheduler(machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewDurableScheduler(NewMachine(context.Background(), md, repo)); err == nil {
+		t.Error("expected error for machine without ScheduleStore")
+	}
+	if _, err := NewDurableScheduler(NewMachine(context.Background(), md, ScheduleStore(store))); err == nil {
+		t.Error("expected error for machine without Repository")
+	}
+
+	// failed save keeps the event for redelivery: machine doesn't cancel event which is being delivered
+	clock.Advance(time.Hour)
+	renewal := store.pending("2")[0]
+	repo.setFailSave(true)
+	fired, err := scheduler.Poll(ctx)
+	if err != nil || len(fired) != 1 || fired[0].Err == nil {
+		t.Fatalf("expected failed delivery, got %v, %v", fired, err)
+	}
+	if o, _ := repo.Load(ctx, "2"); o.Status() != "paid" {
+		t.Errorf("expected object 2 to stay paid in storage, got %s", o.Status())
+	}
+	if events := store.pending("2"); len(events) != 1 || events[0].ID != renewal.ID {
+		t.Errorf("expected only event %s to be kept, got %v", renewal.ID, events)
+	}
+
+	// events of object are rescheduled only after it's saved, so they are kept if save fails
+	if _, _, err := NewMachine(ctx, md, clock, ScheduleStore(store), repo).SendEventByID("1", "pay"); err == nil {
+		t.Error("expected SendEventByID to fail")
+	}
+	if events := store.pending("1"); len(events) != 1 || events[0].Event != "expire" {
+		t.Errorf("expected 'expire' to stay scheduled after failed save, got %v", events)
+	}
+
+	repo.setFailSave(false)
+	fired, err = scheduler.Poll(context.WithValue(ctx, ctxKey{}, "poll"))
+	if err != nil || len(fired) != 1 || fired[0].Err != nil || fired[0].Timer.Event != "renew" {
+		t.Fatalf("expected 'renew' to be redelivered, got %v, %v", fired, err)
+	}
+	// self-transition schedules the next renewal
+	if events := store.pending("2"); len(events) != 1 || !events[0].Due.Equal(clock.Now().Add(time.Hour)) {
+		t.Errorf("expected next 'renew' to be scheduled, got %v", events)
+	}
+	if len(delivered) != 2 || delivered[1] != "poll" {
+		t.Errorf("expected context of Poll to be passed to machine, got %v", delivered)
+	}
+
+	clock.Advance(47 * time.Hour)
+	fired, err = scheduler.Poll(ctx)
+	if err != nil || len(fired) != 2 {
+		t.Fatalf("expected 'expire' and 'renew' to be delivered, got %v, %v", fired, err)
+	}
+	if o, _ := repo.Load(ctx, "1"); o.Status() != "expired" {
+		t.Errorf("expected object 1 to expire, got %s", o.Status())
+	}
+
+	// stale event is dropped: object has left the state while event was pending
+	store.Schedule(ctx, ScheduledEvent{ID: "stale", ObjectID: "1", State: "awaiting_payment", Event: "expire", Due: clock.Now()})
+	fired, err = scheduler.Poll(ctx)
+	if err != nil || len(fired) != 0 || len(store.pending("1")) != 0 {
+		t.Errorf("expected stale event to be dropped, got %v, %v", fired, err)
+	}
+}
+
+func TestDurableScheduler_saving(t *testing.T) {
+	md, err := NewMachineDefinition(Schema{
+		Name:         "invoice",
+		InitialState: State{Name: "issued"},
+		States:       []State{{Name: "issued"}, {Name: "overdue"}},
+		Transitions:  []Transition{{From: "issued", To: "overdue", Event: "expire"}},
+		Timers:       []Timer{{State: "issued", After: time.Hour, Event: "expire"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	clock := newFakeClock()
+	store := newMemScheduleStore()
+	repo := &recordingRepository{memRepository: newMemRepository()}
+	machine := NewMachine(ctx, md, clock, ScheduleStore(store), repo)
+	for _, id := range []string{"1", "2"} {
+		o := &obj{id: id}
+		machine.Start(o)
+		repo.Save(ctx, o)
+		if err := machine.Schedule(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// notification about transition is saved along with object if Repository is TransitionRecorder
+	scheduler, err := NewDurableScheduler(machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(time.Hour)
+	store.Done(ctx, store.pending("2")[0].ID)
+	if fired, err := scheduler.Poll(ctx); err != nil || len(fired) != 1 || fired[0].Err != nil {
+		t.Fatalf("expected event to be delivered, got %v, %v", fired, err)
+	}
+	expected := []TransitionEvent{{Machine: "invoice", ObjectID: "1", From: "issued", To: "overdue", Event: "expire", Time: clock.Now()}}
+	if !reflect.DeepEqual(repo.events, expected) {
+		t.Errorf("expected %+v, got %+v", expected, repo.events)
+	}
+
+	// loader and saver replace Repository
+	var loaded, saved []string
+	load := func(ctx context.Context, id string) (Object, error) {
+		loaded = append(loaded, id)
+		return &obj{id: id, status: "issued"}, nil
+	}
+	save := func(ctx context.Context, o Object) error {
+		saved = append(saved, o.Status())
+		return nil
+	}
+	scheduler, err = NewDurableScheduler(NewMachine(ctx, md, clock, ScheduleStore(store)), load, ObjectSaver(save))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.Schedule(ctx, ScheduledEvent{ID: "2/expire", ObjectID: "2", State: "issued", Event: "expire", Due: clock.Now()})
+	if fired, err := scheduler.Poll(ctx); err != nil || len(fired) != 1 || fired[0].Err != nil {
+		t.Fatalf("expected event to be delivered, got %v, %v", fired, err)
+	}
+	if !reflect.DeepEqual(loaded, []string{"2"}) || !reflect.DeepEqual(saved, []string{"overdue"}) || len(repo.events) != 1 {
+		t.Errorf("expected object to be loaded and saved by functions, got %v and %v", loaded, saved)
+	}
+
+	if _, err := NewDurableScheduler(NewMachine(ctx, md, ScheduleStore(store)), load); err == nil {
+		t.Error("expected error for machine without Repository and ObjectSaver")
+	}
+	if _, err := NewDurableScheduler(machine, "string arg is not expected"); err == nil {
+		t.Error("expected error for argument of unknown type")
+	}
+}
@@ -0,0 +1,236 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"github.com/estambakio/go-fsm/pkg/grpcapi/fsmpb"
+	"google.golang.org/grpc"
+)
+
+// Client calls machine registered on remote Server under particular name.
+// Errors returned by its methods are *RemoteError unless call fails locally.
+type Client struct {
+	c       fsmpb.MachinesClient
+	machine string
+}
+
+// NewClient returns client of machine using gRPC connection
+func NewClient(conn grpc.ClientConnInterface, machine string) *Client {
+	return &Client{c: fsmpb.NewMachinesClient(conn), machine: machine}
+}
+
+// TransitionEvent describes transition performed by remote machine
+type TransitionEvent struct {
+	ObjectID string
+	From     string
+	To       string
+	Event    core.Event
+	Time     time.Time
+	Results  []ActionResult
+}
+
+// ActionResult is a result of action performed by remote machine, Output is encoded as JSON
+type ActionResult struct {
+	Name   string
+	Output json.RawMessage
+}
+
+// ObjectState is a state of object in remote machine
+type ObjectState struct {
+	State   core.State
+	Final   bool
+	Running bool
+}
+
+// SendEvent sends event to object. Payload is encoded as JSON unless it's nil or []byte, which is sent as is.
+// If transition waits for completion of asynchronous action then event is returned along with *core.PendingError,
+// as with core.Machine.SendEvent; status of object stays the same.
+func (c *Client) SendEvent(ctx context.Context, id string, e core.Event, payload interface{}) (TransitionEvent, error) {
+	req := &fsmpb.SendEventRequest{Machine: c.machine, ObjectId: id, Event: string(e)}
+	switch p := payload.(type) {
+	case nil:
+	case []byte:
+		req.Payload = p
+	default:
+		data, err := json.Marshal(p)
+		if err != nil {
+			return TransitionEvent{}, fmt.Errorf("failed to encode payload: %w", err)
+		}
+		req.Payload = data
+	}
+
+	resp, err := c.c.SendEvent(ctx, req)
+	if err != nil {
+		return TransitionEvent{}, fromStatus(err)
+	}
+	if resp.Pending != nil {
+		return transitionEventFromProto(resp), &core.PendingError{Token: resp.Pending.Token, Action: resp.Pending.Action}
+	}
+	return transitionEventFromProto(resp), nil
+}
+
+// AvailableTransitions returns transitions available for object.
+// Event can be passed as optional argument to narrow search down to particular Event.
+// Params of guards and actions are not transferred.
+func (c *Client) AvailableTransitions(ctx context.Context, id string, args ...interface{}) ([]core.Transition, error) {
+	req := &fsmpb.AvailableTransitionsRequest{Machine: c.machine, ObjectId: id}
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case core.Event:
+			req.Event = string(arg)
+		default:
+			return nil, fmt.Errorf("unknown type %T, value %v in AvailableTransitions call", arg, arg)
+		}
+	}
+
+	resp, err := c.c.AvailableTransitions(ctx, req)
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+
+	trs := make([]core.Transition, len(resp.Transitions))
+	for i, pt := range resp.Transitions {
+		trs[i] = transitionFromProto(pt)
+	}
+	return trs, nil
+}
+
+// Can indicates whether object can perform transition according to event
+func (c *Client) Can(ctx context.Context, id string, e core.Event) (bool, error) {
+	resp, err := c.c.Can(ctx, &fsmpb.CanRequest{Machine: c.machine, ObjectId: id, Event: string(e)})
+	if err != nil {
+		return false, fromStatus(err)
+	}
+	return resp.Can, nil
+}
+
+// CurrentState returns state of object
+func (c *Client) CurrentState(ctx context.Context, id string) (ObjectState, error) {
+	resp, err := c.c.CurrentState(ctx, &fsmpb.CurrentStateRequest{Machine: c.machine, ObjectId: id})
+	if err != nil {
+		return ObjectState{}, fromStatus(err)
+	}
+	return ObjectState{State: core.State{Name: resp.State}, Final: resp.Final, Running: resp.Running}, nil
+}
+
+// Completion is a result of completion of pending transition by remote machine
+type Completion struct {
+	ObjectID string
+	State    string
+	Results  []ActionResult
+}
+
+// Complete resumes pending transition with output of asynchronous action. Output is encoded as JSON unless
+// it's nil or []byte, which is sent as is. If transition is suspended again by another asynchronous action
+// then completion is returned along with *core.PendingError, as with core.Machine.Complete.
+func (c *Client) Complete(ctx context.Context, token string, output interface{}) (Completion, error) {
+	req := &fsmpb.CompleteRequest{Machine: c.machine, Token: token}
+	switch out := output.(type) {
+	case nil:
+	case []byte:
+		req.Output = out
+	default:
+		data, err := json.Marshal(out)
+		if err != nil {
+			return Completion{}, fmt.Errorf("failed to encode output: %w", err)
+		}
+		req.Output = data
+	}
+
+	resp, err := c.c.Complete(ctx, req)
+	if err != nil {
+		return Completion{}, fromStatus(err)
+	}
+	completion := Completion{ObjectID: resp.ObjectId, State: resp.State, Results: resultsFromProto(resp.Results)}
+	if resp.Pending != nil {
+		return completion, &core.PendingError{Token: resp.Pending.Token, Action: resp.Pending.Action}
+	}
+	return completion, nil
+}
+
+// Fail fails pending transition with message of error of asynchronous action, status of object stays the same
+func (c *Client) Fail(ctx context.Context, token, message string) error {
+	if _, err := c.c.Fail(ctx, &fsmpb.FailRequest{Machine: c.machine, Token: token, Error: message}); err != nil {
+		return fromStatus(err)
+	}
+	return nil
+}
+
+// TransitionStream receives transitions from WatchTransitions call
+type TransitionStream struct {
+	stream fsmpb.Machines_WatchTransitionsClient
+}
+
+// Recv blocks until next transition is received. Stream is closed when context of Watch call is cancelled.
+func (s *TransitionStream) Recv() (TransitionEvent, error) {
+	event, err := s.stream.Recv()
+	if err != nil {
+		return TransitionEvent{}, fromStatus(err)
+	}
+	return transitionEventFromProto(event), nil
+}
+
+// WatchTransitions subscribes to transitions of machine, or of particular object if id isn't empty.
+// It returns when subscription is established, so transitions performed afterwards are received.
+func (c *Client) WatchTransitions(ctx context.Context, id string) (*TransitionStream, error) {
+	stream, err := c.c.WatchTransitions(ctx, &fsmpb.WatchTransitionsRequest{Machine: c.machine, ObjectId: id})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	// server sends header after subscription; stream which failed before it ends without header
+	header, err := stream.Header()
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	if len(header.Get(subscribedHeader)) == 0 {
+		_, err := stream.Recv()
+		return nil, fromStatus(err)
+	}
+	return &TransitionStream{stream: stream}, nil
+}
+
+func transitionEventFromProto(pe *fsmpb.TransitionEvent) TransitionEvent {
+	e := TransitionEvent{
+		ObjectID: pe.ObjectId,
+		From:     pe.From,
+		To:       pe.To,
+		Event:    core.Event(pe.Event),
+		Time:     pe.Time.AsTime(),
+		Results:  resultsFromProto(pe.Results),
+	}
+	return e
+}
+
+func resultsFromProto(prs []*fsmpb.ActionResult) []ActionResult {
+	var results []ActionResult
+	for _, r := range prs {
+		results = append(results, ActionResult{Name: r.Name, Output: r.Output})
+	}
+	return results
+}
+
+func transitionFromProto(pt *fsmpb.Transition) core.Transition {
+	t := core.Transition{
+		To:       pt.To,
+		Event:    core.Event(pt.Event),
+		Internal: pt.Internal,
+		Priority: int(pt.Priority),
+	}
+	if len(pt.From) > 0 {
+		t.From = pt.From[0]
+	}
+	if len(pt.From) > 1 {
+		t.FromStates = pt.From[1:]
+	}
+	for _, g := range pt.Guards {
+		t.Guards = append(t.Guards, core.Guard{Name: g.Name, Negate: g.Negate})
+	}
+	for _, a := range pt.Actions {
+		t.Actions = append(t.Actions, core.ActionDefinition{Name: a})
+	}
+	return t
+}
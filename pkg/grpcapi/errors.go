@@ -0,0 +1,143 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errorDomain is a domain of errdetails.ErrorInfo attached to errors of core package
+const errorDomain = "fsm"
+
+// Reasons of errdetails.ErrorInfo attached to statuses, they tell apart errors of core package which share a code
+const (
+	ReasonNoTransition       = "NO_TRANSITION"
+	ReasonTransitionConflict = "TRANSITION_CONFLICT"
+	ReasonVetoed             = "VETOED"
+	ReasonCircuitOpen        = "CIRCUIT_OPEN"
+	ReasonStatusConflict     = "STATUS_CONFLICT"
+	ReasonInFlight           = "IN_FLIGHT"
+	ReasonPendingNotFound    = "PENDING_NOT_FOUND"
+	ReasonPendingTimeout     = "PENDING_TIMEOUT"
+)
+
+// statusCode returns gRPC code and reason which correspond to error returned by core.Machine or core.Repository.
+// Reason is empty for errors which are identified by code alone.
+func statusCode(err error) (codes.Code, string) {
+	var conflict *core.TransitionConflictError
+	switch {
+	case errors.Is(err, core.ErrObjectNotFound):
+		return codes.NotFound, ""
+	case errors.Is(err, core.ErrPendingNotFound):
+		// pending transition is completed or expired already
+		return codes.NotFound, ReasonPendingNotFound
+	case errors.Is(err, core.ErrPendingTimeout):
+		// pending transition wasn't completed before deadline and failed
+		return codes.FailedPrecondition, ReasonPendingTimeout
+	case errors.Is(err, core.ErrNoTransition):
+		return codes.FailedPrecondition, ReasonNoTransition
+	case errors.Is(err, core.ErrStatusConflict):
+		// concurrent modification, client can reload object and retry
+		return codes.Aborted, ReasonStatusConflict
+	case errors.Is(err, core.ErrInFlight):
+		// object waits for completion of asynchronous action, client can retry after it
+		return codes.Aborted, ReasonInFlight
+	case errors.Is(err, core.ErrCircuitOpen):
+		// action fails fast, client can retry after cooldown of breaker
+		return codes.Unavailable, ReasonCircuitOpen
+	case errors.As(err, &conflict):
+		// several transitions compete for event, object isn't in a state where event can be handled
+		return codes.FailedPrecondition, ReasonTransitionConflict
+	case errors.Is(err, core.ErrVetoed):
+		// hook rejected transition in current state of object
+		return codes.FailedPrecondition, ReasonVetoed
+	case errors.Is(err, context.Canceled):
+		return codes.Canceled, ""
+	case errors.Is(err, context.DeadlineExceeded):
+		return codes.DeadlineExceeded, ""
+	default:
+		return codes.Unknown, ""
+	}
+}
+
+// toStatus converts error to gRPC status error
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code, reason := statusCode(err)
+	s := status.New(code, err.Error())
+	if reason != "" {
+		if withInfo, err := s.WithDetails(&errdetails.ErrorInfo{Reason: reason, Domain: errorDomain}); err == nil {
+			s = withInfo
+		}
+	}
+	return s.Err()
+}
+
+// RemoteError is returned by Client for failed calls. It matches errors of core package with errors.Is:
+// core.ErrObjectNotFound, core.ErrNoTransition, core.ErrVetoed, core.ErrStatusConflict, core.ErrInFlight,
+// core.ErrCircuitOpen, core.ErrPendingNotFound and core.ErrPendingTimeout.
+type RemoteError struct {
+	Code    codes.Code
+	Message string
+	// Reason is one of Reason constants if server attached it to status
+	Reason string
+}
+
+func (e *RemoteError) Error() string {
+	return "remote machine: " + e.Code.String() + ": " + e.Message
+}
+
+// Is makes RemoteError match errors of core package which are transferred as its code and reason
+func (e *RemoteError) Is(target error) bool {
+	switch target {
+	case core.ErrObjectNotFound:
+		return e.Code == codes.NotFound && e.Reason != ReasonPendingNotFound
+	case core.ErrPendingNotFound:
+		return e.Code == codes.NotFound && e.Reason == ReasonPendingNotFound
+	case core.ErrPendingTimeout:
+		return e.Code == codes.FailedPrecondition && e.Reason == ReasonPendingTimeout
+	case core.ErrNoTransition:
+		return e.Code == codes.FailedPrecondition && e.Reason == ReasonNoTransition
+	case core.ErrVetoed:
+		return e.Code == codes.FailedPrecondition && e.Reason == ReasonVetoed
+	case core.ErrStatusConflict:
+		return e.Code == codes.Aborted && e.Reason == ReasonStatusConflict
+	case core.ErrInFlight:
+		return e.Code == codes.Aborted && e.Reason == ReasonInFlight
+	case core.ErrCircuitOpen:
+		return e.Code == codes.Unavailable && e.Reason == ReasonCircuitOpen
+	}
+	return false
+}
+
+// GRPCStatus makes RemoteError compatible with status.FromError
+func (e *RemoteError) GRPCStatus() *status.Status {
+	s := status.New(e.Code, e.Message)
+	if e.Reason != "" {
+		if withInfo, err := s.WithDetails(&errdetails.ErrorInfo{Reason: e.Reason, Domain: errorDomain}); err == nil {
+			s = withInfo
+		}
+	}
+	return s
+}
+
+// fromStatus converts error returned by gRPC call to RemoteError
+func fromStatus(err error) error {
+	s, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	e := &RemoteError{Code: s.Code(), Message: s.Message()}
+	for _, detail := range s.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == errorDomain {
+			e.Reason = info.Reason
+		}
+	}
+	return e
+}
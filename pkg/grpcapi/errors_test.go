@@ -0,0 +1,62 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+		is   error
+	}{
+		{fmt.Errorf("load: %w", core.ErrObjectNotFound), codes.NotFound, core.ErrObjectNotFound},
+		{fmt.Errorf("SendEvent: %w", core.ErrNoTransition), codes.FailedPrecondition, core.ErrNoTransition},
+		{&core.StatusConflictError{}, codes.Aborted, core.ErrStatusConflict},
+		{fmt.Errorf("SendEvent: %w by BeforeGuard hook: %w", core.ErrVetoed, errors.New("forbidden")), codes.FailedPrecondition, core.ErrVetoed},
+		{&core.TransitionConflictError{}, codes.FailedPrecondition, nil},
+		{fmt.Errorf("SendEvent: %w: object 1, token abc", core.ErrInFlight), codes.Aborted, core.ErrInFlight},
+		{fmt.Errorf("action 'charge': %w", core.ErrCircuitOpen), codes.Unavailable, core.ErrCircuitOpen},
+		{fmt.Errorf("Complete: %w: token abc", core.ErrPendingNotFound), codes.NotFound, core.ErrPendingNotFound},
+		{fmt.Errorf("action 'charge': %w after 1m0s", core.ErrPendingTimeout), codes.FailedPrecondition, core.ErrPendingTimeout},
+		{status.Error(codes.Unavailable, "connection refused"), codes.Unavailable, nil},
+		{context.DeadlineExceeded, codes.DeadlineExceeded, nil},
+		{errors.New("action failed"), codes.Unknown, nil},
+		{status.Error(codes.InvalidArgument, "bad"), codes.InvalidArgument, nil},
+	}
+
+	for _, tt := range tests {
+		err := fromStatus(toStatus(tt.err))
+		if (tt.code == codes.FailedPrecondition || tt.code == codes.Aborted) && err.(*RemoteError).Reason == "" {
+			t.Errorf("expected reason for %v", tt.err)
+		}
+		if status.Code(err) != tt.code {
+			t.Errorf("expected code %s for %v, got %v", tt.code, tt.err, err)
+		}
+		if tt.is != nil && !errors.Is(err, tt.is) {
+			t.Errorf("expected %v to match %v", err, tt.is)
+		}
+		if errors.Is(err, core.ErrStatusConflict) && tt.is != core.ErrStatusConflict {
+			t.Errorf("expected %v not to match ErrStatusConflict", err)
+		}
+		if errors.Is(err, core.ErrInFlight) && tt.is != core.ErrInFlight {
+			t.Errorf("expected %v not to match ErrInFlight", err)
+		}
+		if errors.Is(err, core.ErrCircuitOpen) && tt.is != core.ErrCircuitOpen {
+			t.Errorf("expected %v not to match ErrCircuitOpen", err)
+		}
+		if errors.Is(err, core.ErrNoTransition) && tt.is != core.ErrNoTransition {
+			t.Errorf("expected %v not to match ErrNoTransition", err)
+		}
+		if errors.Is(err, core.ErrObjectNotFound) && tt.is != core.ErrObjectNotFound {
+			t.Errorf("expected %v not to match ErrObjectNotFound", err)
+		}
+	}
+}
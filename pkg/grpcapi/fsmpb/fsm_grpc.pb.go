@@ -0,0 +1,373 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: fsm.proto
+
+package fsmpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	Machines_SendEvent_FullMethodName            = "/fsm.v1.Machines/SendEvent"
+	Machines_AvailableTransitions_FullMethodName = "/fsm.v1.Machines/AvailableTransitions"
+	Machines_Can_FullMethodName                  = "/fsm.v1.Machines/Can"
+	Machines_CurrentState_FullMethodName         = "/fsm.v1.Machines/CurrentState"
+	Machines_WatchTransitions_FullMethodName     = "/fsm.v1.Machines/WatchTransitions"
+	Machines_Complete_FullMethodName             = "/fsm.v1.Machines/Complete"
+	Machines_Fail_FullMethodName                 = "/fsm.v1.Machines/Fail"
+)
+
+// MachinesClient is the client API for Machines service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// Machines executes workflows of machines registered on server.
+// Objects are identified by name of machine and ID of object in machine's repository.
+type MachinesClient interface {
+	// SendEvent loads object, performs transition and saves object
+	SendEvent(ctx context.Context, in *SendEventRequest, opts ...grpc.CallOption) (*TransitionEvent, error)
+	// AvailableTransitions returns transitions available for object, optionally narrowed down to event
+	AvailableTransitions(ctx context.Context, in *AvailableTransitionsRequest, opts ...grpc.CallOption) (*AvailableTransitionsResponse, error)
+	// Can indicates whether object can perform transition according to event
+	Can(ctx context.Context, in *CanRequest, opts ...grpc.CallOption) (*CanResponse, error)
+	// CurrentState returns state of object
+	CurrentState(ctx context.Context, in *CurrentStateRequest, opts ...grpc.CallOption) (*CurrentStateResponse, error)
+	// WatchTransitions streams transitions which machine publishes to its bus
+	WatchTransitions(ctx context.Context, in *WatchTransitionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TransitionEvent], error)
+	// Complete resumes pending transition with output of asynchronous action
+	Complete(ctx context.Context, in *CompleteRequest, opts ...grpc.CallOption) (*CompleteResponse, error)
+	// Fail fails pending transition with error of asynchronous action, status of object stays the same
+	Fail(ctx context.Context, in *FailRequest, opts ...grpc.CallOption) (*FailResponse, error)
+}
+
+type machinesClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMachinesClient(cc grpc.ClientConnInterface) MachinesClient {
+	return &machinesClient{cc}
+}
+
+func (c *machinesClient) SendEvent(ctx context.Context, in *SendEventRequest, opts ...grpc.CallOption) (*TransitionEvent, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TransitionEvent)
+	err := c.cc.Invoke(ctx, Machines_SendEvent_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *machinesClient) AvailableTransitions(ctx context.Context, in *AvailableTransitionsRequest, opts ...grpc.CallOption) (*AvailableTransitionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(AvailableTransitionsResponse)
+	err := c.cc.Invoke(ctx, Machines_AvailableTransitions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *machinesClient) Can(ctx context.Context, in *CanRequest, opts ...grpc.CallOption) (*CanResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CanResponse)
+	err := c.cc.Invoke(ctx, Machines_Can_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *machinesClient) CurrentState(ctx context.Context, in *CurrentStateRequest, opts ...grpc.CallOption) (*CurrentStateResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CurrentStateResponse)
+	err := c.cc.Invoke(ctx, Machines_CurrentState_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *machinesClient) WatchTransitions(ctx context.Context, in *WatchTransitionsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TransitionEvent], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &Machines_ServiceDesc.Streams[0], Machines_WatchTransitions_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchTransitionsRequest, TransitionEvent]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Machines_WatchTransitionsClient = grpc.ServerStreamingClient[TransitionEvent]
+
+func (c *machinesClient) Complete(ctx context.Context, in *CompleteRequest, opts ...grpc.CallOption) (*CompleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CompleteResponse)
+	err := c.cc.Invoke(ctx, Machines_Complete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *machinesClient) Fail(ctx context.Context, in *FailRequest, opts ...grpc.CallOption) (*FailResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FailResponse)
+	err := c.cc.Invoke(ctx, Machines_Fail_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MachinesServer is the server API for Machines service.
+// All implementations must embed UnimplementedMachinesServer
+// for forward compatibility.
+//
+// Machines executes workflows of machines registered on server.
+// Objects are identified by name of machine and ID of object in machine's repository.
+type MachinesServer interface {
+	// SendEvent loads object, performs transition and saves object
+	SendEvent(context.Context, *SendEventRequest) (*TransitionEvent, error)
+	// AvailableTransitions returns transitions available for object, optionally narrowed down to event
+	AvailableTransitions(context.Context, *AvailableTransitionsRequest) (*AvailableTransitionsResponse, error)
+	// Can indicates whether object can perform transition according to event
+	Can(context.Context, *CanRequest) (*CanResponse, error)
+	// CurrentState returns state of object
+	CurrentState(context.Context, *CurrentStateRequest) (*CurrentStateResponse, error)
+	// WatchTransitions streams transitions which machine publishes to its bus
+	WatchTransitions(*WatchTransitionsRequest, grpc.ServerStreamingServer[TransitionEvent]) error
+	// Complete resumes pending transition with output of asynchronous action
+	Complete(context.Context, *CompleteRequest) (*CompleteResponse, error)
+	// Fail fails pending transition with error of asynchronous action, status of object stays the same
+	Fail(context.Context, *FailRequest) (*FailResponse, error)
+	mustEmbedUnimplementedMachinesServer()
+}
+
+// UnimplementedMachinesServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMachinesServer struct{}
+
+func (UnimplementedMachinesServer) SendEvent(context.Context, *SendEventRequest) (*TransitionEvent, error) {
+	return nil, status.Error(codes.Unimplemented, "method SendEvent not implemented")
+}
+func (UnimplementedMachinesServer) AvailableTransitions(context.Context, *AvailableTransitionsRequest) (*AvailableTransitionsResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method AvailableTransitions not implemented")
+}
+func (UnimplementedMachinesServer) Can(context.Context, *CanRequest) (*CanResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Can not implemented")
+}
+func (UnimplementedMachinesServer) CurrentState(context.Context, *CurrentStateRequest) (*CurrentStateResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CurrentState not implemented")
+}
+func (UnimplementedMachinesServer) WatchTransitions(*WatchTransitionsRequest, grpc.ServerStreamingServer[TransitionEvent]) error {
+	return status.Error(codes.Unimplemented, "method WatchTransitions not implemented")
+}
+func (UnimplementedMachinesServer) Complete(context.Context, *CompleteRequest) (*CompleteResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Complete not implemented")
+}
+func (UnimplementedMachinesServer) Fail(context.Context, *FailRequest) (*FailResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Fail not implemented")
+}
+func (UnimplementedMachinesServer) mustEmbedUnimplementedMachinesServer() {}
+func (UnimplementedMachinesServer) testEmbeddedByValue()                  {}
+
+// UnsafeMachinesServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MachinesServer will
+// result in compilation errors.
+type UnsafeMachinesServer interface {
+	mustEmbedUnimplementedMachinesServer()
+}
+
+func RegisterMachinesServer(s grpc.ServiceRegistrar, srv MachinesServer) {
+	// If the following call panics, it indicates UnimplementedMachinesServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&Machines_ServiceDesc, srv)
+}
+
+func _Machines_SendEvent_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendEventRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MachinesServer).SendEvent(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Machines_SendEvent_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MachinesServer).SendEvent(ctx, req.(*SendEventRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Machines_AvailableTransitions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AvailableTransitionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MachinesServer).AvailableTransitions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Machines_AvailableTransitions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MachinesServer).AvailableTransitions(ctx, req.(*AvailableTransitionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Machines_Can_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CanRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MachinesServer).Can(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Machines_Can_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MachinesServer).Can(ctx, req.(*CanRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Machines_CurrentState_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CurrentStateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MachinesServer).CurrentState(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Machines_CurrentState_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MachinesServer).CurrentState(ctx, req.(*CurrentStateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Machines_WatchTransitions_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchTransitionsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MachinesServer).WatchTransitions(m, &grpc.GenericServerStream[WatchTransitionsRequest, TransitionEvent]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type Machines_WatchTransitionsServer = grpc.ServerStreamingServer[TransitionEvent]
+
+func _Machines_Complete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MachinesServer).Complete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Machines_Complete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MachinesServer).Complete(ctx, req.(*CompleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _Machines_Fail_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FailRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MachinesServer).Fail(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: Machines_Fail_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MachinesServer).Fail(ctx, req.(*FailRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// Machines_ServiceDesc is the grpc.ServiceDesc for Machines service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var Machines_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "fsm.v1.Machines",
+	HandlerType: (*MachinesServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "SendEvent",
+			Handler:    _Machines_SendEvent_Handler,
+		},
+		{
+			MethodName: "AvailableTransitions",
+			Handler:    _Machines_AvailableTransitions_Handler,
+		},
+		{
+			MethodName: "Can",
+			Handler:    _Machines_Can_Handler,
+		},
+		{
+			MethodName: "CurrentState",
+			Handler:    _Machines_CurrentState_Handler,
+		},
+		{
+			MethodName: "Complete",
+			Handler:    _Machines_Complete_Handler,
+		},
+		{
+			MethodName: "Fail",
+			Handler:    _Machines_Fail_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchTransitions",
+			Handler:       _Machines_WatchTransitions_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "fsm.proto",
+}
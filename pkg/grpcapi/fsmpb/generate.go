@@ -0,0 +1,4 @@
+// Package fsmpb contains protobuf messages and gRPC service generated from fsm.proto.
+package fsmpb
+
+//go:generate buf generate
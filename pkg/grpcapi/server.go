@@ -0,0 +1,387 @@
+// Package grpcapi exposes registered machines as gRPC service fsm.v1.Machines (see fsmpb/fsm.proto)
+// and provides Client for it.
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"github.com/estambakio/go-fsm/pkg/grpcapi/fsmpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// WatchBufferSize is a number of transitions buffered for a single WatchTransitions stream, 64 by default.
+// If client doesn't keep up and buffer overflows then stream is terminated with ResourceExhausted code.
+// The buffer is shared by all objects of machine, even if stream watches one of them.
+type WatchBufferSize int
+
+const defaultWatchBufferSize = 64
+
+// subscribedHeader is sent by WatchTransitions when stream is subscribed
+const subscribedHeader = "fsm-subscribed"
+
+// Server implements fsmpb.MachinesServer for registered machines
+type Server struct {
+	fsmpb.UnimplementedMachinesServer
+
+	clock      core.Clock
+	bufferSize int
+
+	mu       sync.RWMutex
+	machines map[string]*registration
+}
+
+// registration is a machine served by Server
+type registration struct {
+	machine    *core.Machine
+	repository core.Repository
+}
+
+// NewServer returns server without machines. Optional args: core.Clock for timestamps of transitions,
+// WatchBufferSize.
+func NewServer(args ...interface{}) (*Server, error) {
+	s := &Server{
+		clock:      core.SystemClock,
+		bufferSize: defaultWatchBufferSize,
+		machines:   make(map[string]*registration),
+	}
+
+	// handle variadic optional args based on passed types
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case core.Clock:
+			s.clock = arg
+		case WatchBufferSize:
+			if arg <= 0 {
+				return nil, fmt.Errorf("watch buffer size must be positive, got %d", arg)
+			}
+			s.bufferSize = int(arg)
+		default:
+			return nil, fmt.Errorf("unknown type %T, value %v in NewServer call", arg, arg)
+		}
+	}
+
+	return s, nil
+}
+
+// Register makes machine available under name. Objects are loaded from and saved to repository;
+// if it implements core.TransitionRecorder then notifications about transitions are saved along with objects.
+// WatchTransitions streams notifications from machine's core.Bus, so machine should be created with one.
+//
+// Pending transitions are completed by machine, which loads and saves objects with its own Repository, so it
+// should be created with the same repository. Machine without Repository keeps objects of pending transitions
+// in memory, server saves them to repository after completion.
+func (s *Server) Register(name string, m *core.Machine, repository core.Repository) error {
+	if name == "" {
+		return fmt.Errorf("machine name is required")
+	}
+	if repository == nil {
+		return fmt.Errorf("repository is required for machine %s", name)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.machines[name]; ok {
+		return fmt.Errorf("machine %s is already registered", name)
+	}
+	s.machines[name] = &registration{machine: m, repository: repository}
+	return nil
+}
+
+// RegisterService registers server in gRPC server
+func (s *Server) RegisterService(gs grpc.ServiceRegistrar) {
+	fsmpb.RegisterMachinesServer(gs, s)
+}
+
+func (s *Server) registration(name string) (*registration, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	reg, ok := s.machines[name]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "machine '%s' is not registered", name)
+	}
+	return reg, nil
+}
+
+// load returns machine bound to ctx and object loaded from its repository
+func (s *Server) load(ctx context.Context, machine, id string) (*core.Machine, core.Object, error) {
+	reg, err := s.registration(machine)
+	if err != nil {
+		return nil, nil, err
+	}
+	o, err := reg.repository.Load(ctx, id)
+	if err != nil {
+		return nil, nil, toStatus(fmt.Errorf("failed to load object %s: %w", id, err))
+	}
+	return reg.machine.WithContext(ctx), o, nil
+}
+
+// SendEvent implements fsmpb.MachinesServer
+func (s *Server) SendEvent(ctx context.Context, req *fsmpb.SendEventRequest) (*fsmpb.TransitionEvent, error) {
+	if req.Event == "" {
+		return nil, status.Error(codes.InvalidArgument, "event is required")
+	}
+	reg, err := s.registration(req.Machine)
+	if err != nil {
+		return nil, err
+	}
+
+	o, err := reg.repository.Load(ctx, req.ObjectId)
+	if err != nil {
+		return nil, toStatus(fmt.Errorf("failed to load object %s: %w", req.ObjectId, err))
+	}
+
+	machineCtx := ctx
+	if len(req.Payload) > 0 {
+		if !json.Valid(req.Payload) {
+			return nil, status.Error(codes.InvalidArgument, "payload is not a valid JSON")
+		}
+		machineCtx = core.WithPayload(ctx, json.RawMessage(req.Payload))
+	}
+
+	m := reg.machine.WithContext(machineCtx)
+	from := o.Status()
+	results, err := m.SendEvent(o, core.Event(req.Event))
+	var pending *core.PendingError
+	if err != nil && !errors.As(err, &pending) {
+		return nil, toStatus(err)
+	}
+
+	// suspended transition doesn't change status, it's saved when it's completed
+	if pending == nil {
+		info := core.TransitionInfo{Object: o, Event: core.Event(req.Event), From: from, To: o.Status(), Results: results}
+		if err := m.SaveTransition(reg.repository, info); err != nil {
+			return nil, toStatus(fmt.Errorf("failed to save object %s: %w", req.ObjectId, err))
+		}
+	}
+
+	event := &fsmpb.TransitionEvent{
+		Machine:  req.Machine,
+		ObjectId: req.ObjectId,
+		From:     from,
+		To:       o.Status(),
+		Event:    req.Event,
+		Time:     timestamppb.New(s.clock.Now()),
+	}
+	if pending != nil {
+		event.Pending = &fsmpb.Pending{Token: pending.Token, Action: pending.Action}
+	}
+	if event.Results, err = resultsToProto(results); err != nil {
+		return nil, status.Errorf(codes.Internal, "transition is done, but %v", err)
+	}
+	return event, nil
+}
+
+// AvailableTransitions implements fsmpb.MachinesServer
+func (s *Server) AvailableTransitions(ctx context.Context, req *fsmpb.AvailableTransitionsRequest) (*fsmpb.AvailableTransitionsResponse, error) {
+	m, o, err := s.load(ctx, req.Machine, req.ObjectId)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []interface{}
+	if req.Event != "" {
+		args = append(args, core.Event(req.Event))
+	}
+	trs, err := m.AvailableTransitions(o, args...)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	resp := &fsmpb.AvailableTransitionsResponse{}
+	for _, t := range trs {
+		resp.Transitions = append(resp.Transitions, transitionToProto(t))
+	}
+	return resp, nil
+}
+
+// Can implements fsmpb.MachinesServer
+func (s *Server) Can(ctx context.Context, req *fsmpb.CanRequest) (*fsmpb.CanResponse, error) {
+	m, o, err := s.load(ctx, req.Machine, req.ObjectId)
+	if err != nil {
+		return nil, err
+	}
+	return &fsmpb.CanResponse{Can: m.Can(o, core.Event(req.Event))}, nil
+}
+
+// CurrentState implements fsmpb.MachinesServer
+func (s *Server) CurrentState(ctx context.Context, req *fsmpb.CurrentStateRequest) (*fsmpb.CurrentStateResponse, error) {
+	m, o, err := s.load(ctx, req.Machine, req.ObjectId)
+	if err != nil {
+		return nil, err
+	}
+	state, err := m.CurrentState(o)
+	if err != nil {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return &fsmpb.CurrentStateResponse{State: state.Name, Final: m.IsInFinalState(o), Running: m.IsRunning(o)}, nil
+}
+
+// WatchTransitions implements fsmpb.MachinesServer. Transitions are received from machine's core.Bus,
+// so transitions performed by any caller of machine are streamed, not only by SendEvent of Server.
+// Header is sent as soon as stream is subscribed, so that client can wait for it before sending events.
+// Stream is closed with codes.ResourceExhausted as soon as a transition is dropped because client doesn't keep up.
+func (s *Server) WatchTransitions(req *fsmpb.WatchTransitionsRequest, stream fsmpb.Machines_WatchTransitionsServer) error {
+	reg, err := s.registration(req.Machine)
+	if err != nil {
+		return err
+	}
+	bus := reg.machine.Bus()
+	if bus == nil {
+		return status.Errorf(codes.FailedPrecondition, "machine '%s' doesn't publish transitions to core.Bus", req.Machine)
+	}
+
+	sub, err := bus.Subscribe(core.Filter{}, s.bufferSize)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	defer sub.Unsubscribe()
+
+	if err := stream.SendHeader(metadata.Pairs(subscribedHeader, "true")); err != nil {
+		return err
+	}
+
+	// bus can be shared by several machines
+	schema := reg.machine.Schema().Name
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-sub.Overflow():
+			return status.Errorf(codes.ResourceExhausted, "client doesn't keep up with transitions, %d dropped", sub.Dropped())
+		case e := <-sub.C:
+			if sub.Dropped() > 0 {
+				return status.Errorf(codes.ResourceExhausted, "client doesn't keep up with transitions, %d dropped", sub.Dropped())
+			}
+			if e.Machine != schema || (req.ObjectId != "" && e.ObjectID != req.ObjectId) {
+				continue
+			}
+			event := &fsmpb.TransitionEvent{
+				Machine:  req.Machine,
+				ObjectId: e.ObjectID,
+				From:     e.From,
+				To:       e.To,
+				Event:    string(e.Event),
+				Time:     timestamppb.New(e.Time),
+			}
+			if event.Results, err = resultsToProto(e.Results); err != nil {
+				return status.Errorf(codes.Internal, "transition of object %s can't be streamed: %v", e.ObjectID, err)
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Complete implements fsmpb.MachinesServer. If transition is suspended again then response has pending set.
+func (s *Server) Complete(ctx context.Context, req *fsmpb.CompleteRequest) (*fsmpb.CompleteResponse, error) {
+	reg, err := s.registration(req.Machine)
+	if err != nil {
+		return nil, err
+	}
+	var output interface{}
+	if len(req.Output) > 0 {
+		if !json.Valid(req.Output) {
+			return nil, status.Error(codes.InvalidArgument, "output is not a valid JSON")
+		}
+		output = json.RawMessage(req.Output)
+	}
+
+	// machine without Repository doesn't save object, server saves it as after SendEvent
+	m := reg.machine.WithContext(ctx)
+	var pending core.PendingTransition
+	save := m.Repository() == nil
+	if save {
+		all, err := m.PendingTransitions()
+		if err != nil {
+			return nil, toStatus(err)
+		}
+		for _, p := range all {
+			if p.Token == req.Token {
+				pending = p
+			}
+		}
+	}
+
+	o, results, err := m.Complete(req.Token, output)
+	var suspended *core.PendingError
+	if err != nil && !errors.As(err, &suspended) {
+		return nil, toStatus(err)
+	}
+
+	resp := &fsmpb.CompleteResponse{ObjectId: pending.ObjectID, State: o.Status()}
+	if identifiable, ok := o.(core.Identifiable); ok {
+		resp.ObjectId = identifiable.ID()
+	}
+	if suspended != nil {
+		resp.Pending = &fsmpb.Pending{Token: suspended.Token, Action: suspended.Action}
+	} else if save {
+		info := core.TransitionInfo{Object: o, Event: pending.Event, From: pending.From, To: o.Status(), Results: results}
+		if err := m.SaveTransition(reg.repository, info); err != nil {
+			return nil, toStatus(fmt.Errorf("failed to save object %s: %w", resp.ObjectId, err))
+		}
+	}
+	if resp.Results, err = resultsToProto(results); err != nil {
+		return nil, status.Errorf(codes.Internal, "transition is done, but %v", err)
+	}
+	return resp, nil
+}
+
+// Fail implements fsmpb.MachinesServer
+func (s *Server) Fail(ctx context.Context, req *fsmpb.FailRequest) (*fsmpb.FailResponse, error) {
+	if req.Error == "" {
+		return nil, status.Error(codes.InvalidArgument, "error is required")
+	}
+	reg, err := s.registration(req.Machine)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fail returns cause when transition is failed
+	cause := errors.New(req.Error)
+	if err := reg.machine.WithContext(ctx).Fail(req.Token, cause); err != nil && !errors.Is(err, cause) {
+		return nil, toStatus(err)
+	}
+	return &fsmpb.FailResponse{}, nil
+}
+
+// resultsToProto encodes outputs of actions as JSON
+func resultsToProto(results []core.ActionResult) ([]*fsmpb.ActionResult, error) {
+	var prs []*fsmpb.ActionResult
+	for _, result := range results {
+		output, err := json.Marshal(result.Output)
+		if err != nil {
+			return nil, fmt.Errorf("output of action %s can't be encoded: %w", result.Name, err)
+		}
+		prs = append(prs, &fsmpb.ActionResult{Name: result.Name, Output: output})
+	}
+	return prs, nil
+}
+
+func transitionToProto(t core.Transition) *fsmpb.Transition {
+	pt := &fsmpb.Transition{
+		From:     t.Sources(),
+		To:       t.To,
+		Event:    string(t.Event),
+		Internal: t.Internal,
+		Priority: int32(t.Priority),
+	}
+	for _, g := range t.Guards {
+		pt.Guards = append(pt.Guards, &fsmpb.Guard{Name: g.Name, Negate: g.Negate})
+	}
+	for _, a := range t.Actions {
+		pt.Actions = append(pt.Actions, a.Name)
+	}
+	return pt
+}
@@ -0,0 +1,471 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"github.com/estambakio/go-fsm/pkg/grpcapi/fsmpb"
+	"github.com/estambakio/go-fsm/pkg/outbox"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type order struct {
+	id     string
+	status string
+}
+
+func (o *order) ID() string         { return o.id }
+func (o *order) Status() string     { return o.status }
+func (o *order) SetStatus(s string) { o.status = s }
+
+// memRepository stores copies of orders
+type memRepository struct {
+	mu     sync.Mutex
+	orders map[string]order
+}
+
+func (r *memRepository) Load(ctx context.Context, id string) (core.Object, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[id]
+	if !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	return &o, nil
+}
+
+func (r *memRepository) Save(ctx context.Context, o core.Object) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders[o.(*order).id] = *o.(*order)
+	return nil
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+var now = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newTestClient starts server on in-process listener and returns client of "order" machine.
+// Args are passed to core.NewMachine.
+func newTestClient(t *testing.T, args ...interface{}) (*Client, *memRepository) {
+	t.Helper()
+
+	md, err := core.NewMachineDefinition(
+		core.Schema{
+			Name:         "order",
+			InitialState: core.State{Name: "new"},
+			FinalStates:  []core.State{{Name: "paid"}},
+			States:       []core.State{{Name: "new"}, {Name: "paid"}},
+			Transitions: []core.Transition{
+				{From: "new", To: "paid", Event: "pay", Guards: []core.Guard{{Name: "hasAmount"}}, Actions: []core.ActionDefinition{{Name: "charge"}}},
+				{From: "new", Event: "remind", Internal: true},
+			},
+		},
+		[]core.Condition{{
+			Name: "hasAmount",
+			F: func(ctx context.Context, o core.Object, p []core.Param) bool {
+				payload, ok := core.PayloadFrom(ctx)
+				if !ok {
+					return false
+				}
+				var body struct{ Amount int }
+				return json.Unmarshal(payload.(json.RawMessage), &body) == nil && body.Amount > 0
+			},
+		}},
+		[]core.Action{{
+			Name: "charge",
+			F: func(ctx context.Context, o core.Object, p []core.Param, r []core.ActionResult) core.ActionResult {
+				return core.ActionResult{Name: "charge", Output: map[string]string{"receipt": o.(*order).id}}
+			},
+		}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &memRepository{orders: map[string]order{"1": {id: "1", status: "new"}, "2": {id: "2", status: "new"}}}
+
+	server, err := NewServer(core.Clock(fixedClock(now)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := core.NewMachine(context.Background(), md, args...)
+	if err := server.Register("order", machine, repo); err != nil {
+		t.Fatal(err)
+	}
+	return NewClient(dial(t, server), "order"), repo
+}
+
+// dial starts server on in-process listener and returns connection to it
+func dial(t *testing.T, server *Server) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	gs := grpc.NewServer()
+	server.RegisterService(gs)
+	go gs.Serve(lis)
+	t.Cleanup(gs.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func TestClient(t *testing.T) {
+	client, repo := newTestClient(t)
+	ctx := context.Background()
+
+	state, err := client.CurrentState(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state != (ObjectState{State: core.State{Name: "new"}, Running: true}) {
+		t.Errorf("unexpected state %+v", state)
+	}
+
+	trs, err := client.AvailableTransitions(ctx, "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []core.Transition{{From: "new", Event: "remind", Internal: true}}
+	if !reflect.DeepEqual(trs, expected) {
+		t.Errorf("expected %+v, got %+v", expected, trs)
+	}
+
+	if can, err := client.Can(ctx, "1", "pay"); err != nil || can {
+		t.Errorf("expected pay to be unavailable without payload, got %v %v", can, err)
+	}
+
+	if _, err := client.SendEvent(ctx, "1", "pay", nil); !errors.Is(err, core.ErrNoTransition) {
+		t.Errorf("expected ErrNoTransition, got %v", err)
+	}
+
+	event, err := client.SendEvent(ctx, "1", "pay", map[string]int{"amount": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedEvent := TransitionEvent{
+		ObjectID: "1",
+		From:     "new",
+		To:       "paid",
+		Event:    "pay",
+		Time:     now,
+		Results:  []ActionResult{{Name: "charge", Output: json.RawMessage(`{"receipt":"1"}`)}},
+	}
+	if !reflect.DeepEqual(event, expectedEvent) {
+		t.Errorf("expected %+v, got %+v", expectedEvent, event)
+	}
+	if repo.orders["1"].status != "paid" {
+		t.Errorf("expected object to be saved, got %v", repo.orders["1"])
+	}
+
+	state, _ = client.CurrentState(ctx, "1")
+	if state != (ObjectState{State: core.State{Name: "paid"}, Final: true}) {
+		t.Errorf("unexpected state %+v", state)
+	}
+}
+
+func TestClient_errors(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+
+	if _, err := client.CurrentState(ctx, "3"); !errors.Is(err, core.ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+	if _, err := client.SendEvent(ctx, "1", "", nil); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for empty event, got %v", err)
+	}
+	if _, err := client.SendEvent(ctx, "1", "pay", []byte("{")); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for invalid payload, got %v", err)
+	}
+	if _, err := client.AvailableTransitions(ctx, "1", 1); err == nil {
+		t.Error("expected error for unknown argument")
+	}
+
+	if _, err := client.WatchTransitions(ctx, ""); status.Code(err) != codes.FailedPrecondition {
+		t.Errorf("expected FailedPrecondition for machine without bus, got %v", err)
+	}
+
+	unknown := &Client{c: client.c, machine: "unknown"}
+	if _, err := unknown.Can(ctx, "1", "pay"); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for unknown machine, got %v", err)
+	}
+	if _, err := unknown.WatchTransitions(ctx, ""); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for unknown machine, got %v", err)
+	}
+}
+
+func TestClient_WatchTransitions(t *testing.T) {
+	bus := core.NewBus()
+	client, _ := newTestClient(t, bus)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	all, err := client.WatchTransitions(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := client.WatchTransitions(ctx, "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, id := range []string{"1", "2"} {
+		if _, err := client.SendEvent(ctx, id, "remind", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, id := range []string{"1", "2"} {
+		event, err := all.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.ObjectID != id || event.Event != "remind" || event.From != "new" || event.To != "new" {
+			t.Errorf("unexpected event %+v", event)
+		}
+	}
+
+	event, err := second.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.ObjectID != "2" {
+		t.Errorf("expected event of object 2, got %+v", event)
+	}
+
+	// transitions performed by other callers of machine, e.g. schedulers, are streamed too;
+	// transitions of other machines sharing the bus are not
+	bus.Publish(core.TransitionEvent{Machine: "invoice", ObjectID: "2", From: "new", To: "sent", Event: "send", Time: now})
+	bus.Publish(core.TransitionEvent{Machine: "order", ObjectID: "2", From: "new", To: "paid", Event: "timeout", Time: now})
+	event, err = second.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := TransitionEvent{ObjectID: "2", From: "new", To: "paid", Event: "timeout", Time: now}
+	if !reflect.DeepEqual(event, expected) {
+		t.Errorf("expected %+v, got %+v", expected, event)
+	}
+}
+
+// blockingStream is a WatchTransitions stream whose Send blocks until it's released
+type blockingStream struct {
+	fsmpb.Machines_WatchTransitionsServer
+	ctx        context.Context
+	subscribed chan struct{}
+	sending    chan *fsmpb.TransitionEvent
+	release    chan struct{}
+}
+
+func (s *blockingStream) Context() context.Context { return s.ctx }
+
+func (s *blockingStream) SendHeader(metadata.MD) error {
+	close(s.subscribed)
+	return nil
+}
+
+func (s *blockingStream) Send(event *fsmpb.TransitionEvent) error {
+	s.sending <- event
+	<-s.release
+	return nil
+}
+
+func TestServer_WatchTransitions_overflow(t *testing.T) {
+	md, err := core.NewMachineDefinition(core.Schema{Name: "order", States: []core.State{{Name: "new"}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus := core.NewBus()
+	machine := core.NewMachine(context.Background(), md, bus)
+	s, _ := NewServer(WatchBufferSize(3))
+	if err := s.Register("order", machine, &memRepository{}); err != nil {
+		t.Fatal(err)
+	}
+
+	stream := &blockingStream{
+		ctx:        context.Background(),
+		subscribed: make(chan struct{}),
+		sending:    make(chan *fsmpb.TransitionEvent),
+		release:    make(chan struct{}),
+	}
+	done := make(chan error)
+	go func() {
+		done <- s.WatchTransitions(&fsmpb.WatchTransitionsRequest{Machine: "order", ObjectId: "1"}, stream)
+	}()
+	<-stream.subscribed
+
+	// events of other machines and objects are skipped, but take place in buffer
+	bus.Publish(core.TransitionEvent{Machine: "invoice", ObjectID: "1"})
+	bus.Publish(core.TransitionEvent{Machine: "order", ObjectID: "2"})
+	bus.Publish(core.TransitionEvent{Machine: "order", ObjectID: "1", Event: "first"})
+	if event := <-stream.sending; event.ObjectId != "1" || event.Event != "first" {
+		t.Errorf("unexpected event %+v", event)
+	}
+
+	// publishing doesn't block while client is slow, the stream is terminated instead
+	for i := 0; i < 4; i++ {
+		bus.Publish(core.TransitionEvent{Machine: "order", ObjectID: "1"})
+	}
+	close(stream.release)
+	if err := <-done; status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("expected ResourceExhausted, got %v", err)
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	if _, err := NewServer(WatchBufferSize(0)); err == nil {
+		t.Error("expected error for empty buffer")
+	}
+	if _, err := NewServer("unknown"); err == nil {
+		t.Error("expected error for unknown argument")
+	}
+
+	s, _ := NewServer()
+	if err := s.Register("order", nil, nil); err == nil {
+		t.Error("expected error without repository")
+	}
+}
+
+func TestServer_SendEvent_outbox(t *testing.T) {
+	md, err := core.NewMachineDefinition(core.Schema{
+		Name:        "order",
+		States:      []core.State{{Name: "new"}, {Name: "paid"}},
+		Transitions: []core.Transition{{From: "new", To: "paid", Event: "pay"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := core.NewMachine(context.Background(), md, core.Clock(fixedClock(now)))
+	store, err := outbox.NewFileStore(t.TempDir() + "/outbox.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	server, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &memRepository{orders: map[string]order{"1": {id: "1", status: "new"}}}
+	if err := server.Register("order", machine, outbox.Repository{Repository: repo, Store: store}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := server.SendEvent(context.Background(), &fsmpb.SendEventRequest{Machine: "order", ObjectId: "1", Event: "pay"}); err != nil {
+		t.Fatal(err)
+	}
+	pending, err := store.Pending(context.Background(), 0)
+	if err != nil || len(pending) != 1 || pending[0].ObjectID != "1" || pending[0].To != "paid" {
+		t.Errorf("expected message about transition in outbox, got %+v, %v", pending, err)
+	}
+	if repo.orders["1"].status != "paid" {
+		t.Errorf("expected object to be saved, got %v", repo.orders["1"])
+	}
+}
+
+func TestClient_pending(t *testing.T) {
+	md, err := core.NewMachineDefinition(
+		core.Schema{
+			Name:   "order",
+			States: []core.State{{Name: "new"}, {Name: "paid"}},
+			Transitions: []core.Transition{
+				{From: "new", To: "paid", Event: "pay", Actions: []core.ActionDefinition{{Name: "charge"}}},
+			},
+		},
+		[]core.Action{{
+			Name: "charge",
+			F: func(ctx context.Context, o core.Object, p []core.Param, r []core.ActionResult) core.ActionResult {
+				return core.ActionResult{Name: "charge", Pending: true, Token: "payment-" + o.(*order).id}
+			},
+		}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := core.NewMachine(context.Background(), md)
+	server, err := NewServer(core.Clock(fixedClock(now)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &memRepository{orders: map[string]order{"1": {id: "1", status: "new"}}}
+	if err := server.Register("order", machine, repo); err != nil {
+		t.Fatal(err)
+	}
+	client := NewClient(dial(t, server), "order")
+	ctx := context.Background()
+
+	event, err := client.SendEvent(ctx, "1", "pay", nil)
+	var pending *core.PendingError
+	if !errors.As(err, &pending) || pending.Token != "payment-1" || pending.Action != "charge" {
+		t.Fatalf("expected pending error with token, got %v", err)
+	}
+	expected := TransitionEvent{
+		ObjectID: "1",
+		From:     "new",
+		To:       "new",
+		Event:    "pay",
+		Time:     now,
+		Results:  []ActionResult{{Name: "charge", Output: json.RawMessage("null")}},
+	}
+	if !reflect.DeepEqual(event, expected) {
+		t.Errorf("expected %+v, got %+v", expected, event)
+	}
+
+	// object in flight rejects events until transition is completed
+	if _, err := client.SendEvent(ctx, "1", "pay", nil); !errors.Is(err, core.ErrInFlight) || status.Code(err) != codes.Aborted {
+		t.Errorf("expected Aborted for object in flight, got %v", err)
+	}
+
+	completion, err := client.Complete(ctx, "payment-1", map[string]string{"id": "ch_1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedCompletion := Completion{ObjectID: "1", State: "paid", Results: []ActionResult{{Name: "charge", Output: json.RawMessage(`{"id":"ch_1"}`)}}}
+	if !reflect.DeepEqual(completion, expectedCompletion) {
+		t.Errorf("expected %+v, got %+v", expectedCompletion, completion)
+	}
+	if repo.orders["1"].status != "paid" {
+		t.Errorf("expected completed object to be saved, got %v", repo.orders["1"])
+	}
+	if _, err := client.Complete(ctx, "payment-1", nil); !errors.Is(err, core.ErrPendingNotFound) || status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for completed transition, got %v", err)
+	}
+
+	// failed transition doesn't change status of object
+	repo.orders["2"] = order{id: "2", status: "new"}
+	if _, err := client.SendEvent(ctx, "2", "pay", nil); !errors.As(err, &pending) {
+		t.Fatalf("expected pending error, got %v", err)
+	}
+	if err := client.Fail(ctx, "payment-2", ""); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument without error message, got %v", err)
+	}
+	if err := client.Fail(ctx, "payment-2", "declined"); err != nil {
+		t.Fatal(err)
+	}
+	if repo.orders["2"].status != "new" {
+		t.Errorf("expected status of object to stay the same, got %v", repo.orders["2"])
+	}
+	if err := client.Fail(ctx, "payment-2", "declined"); !errors.Is(err, core.ErrPendingNotFound) {
+		t.Errorf("expected ErrPendingNotFound for failed transition, got %v", err)
+	}
+}
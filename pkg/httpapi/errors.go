@@ -0,0 +1,115 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// ErrorCode is a machine-readable reason of failed request
+type ErrorCode string
+
+const (
+	// CodeInvalidRequest means that request body or query is malformed
+	CodeInvalidRequest ErrorCode = "invalid_request"
+	// CodeMachineNotFound means that machine with provided name isn't registered
+	CodeMachineNotFound ErrorCode = "machine_not_found"
+	// CodeObjectNotFound means that Repository returned core.ErrObjectNotFound
+	CodeObjectNotFound ErrorCode = "object_not_found"
+	// CodeNoTransition means that event isn't acceptable in current state of object, see core.ErrNoTransition
+	CodeNoTransition ErrorCode = "no_transition"
+	// CodeTransitionConflict means that several transitions compete for event, see core.TransitionConflictError
+	CodeTransitionConflict ErrorCode = "transition_conflict"
+	// CodeVetoed means that a hook rejected transition, see core.ErrVetoed
+	CodeVetoed ErrorCode = "vetoed"
+	// CodeStatusConflict means that object was modified concurrently, see core.ErrStatusConflict.
+	// Request can be retried.
+	CodeStatusConflict ErrorCode = "status_conflict"
+	// CodePending means that transition waits for completion of asynchronous action, see core.ErrPending.
+	// Response to event has PendingView in body instead of Error.
+	CodePending ErrorCode = "pending"
+	// CodeInFlight means that object has pending transition and rejects events until it's completed,
+	// see core.ErrInFlight
+	CodeInFlight ErrorCode = "in_flight"
+	// CodePendingNotFound means that there is no pending transition with provided token,
+	// e.g. it's completed or expired already, see core.ErrPendingNotFound
+	CodePendingNotFound ErrorCode = "pending_not_found"
+	// CodePendingTimeout means that pending transition wasn't completed before deadline and failed,
+	// see core.ErrPendingTimeout
+	CodePendingTimeout ErrorCode = "pending_timeout"
+	// CodeCircuitOpen means that action wasn't called because its circuit breaker is open, see core.ErrCircuitOpen.
+	// Request can be retried after cooldown of breaker.
+	CodeCircuitOpen ErrorCode = "circuit_open"
+	// CodeNotImplemented means that machine doesn't provide requested data, e.g. it has no source of transitions
+	CodeNotImplemented ErrorCode = "not_implemented"
+	// CodeInternal is used for all other errors, e.g. failed actions or storage errors.
+	// Message of such error isn't sent to client.
+	CodeInternal ErrorCode = "internal"
+)
+
+// Error is a body of failed response: {"error": {"code": "...", "message": "..."}}
+type Error struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return string(e.Code) + ": " + e.Message
+}
+
+// CodeOf returns code which corresponds to error returned by core.Machine or core.Repository
+func CodeOf(err error) ErrorCode {
+	var apiErr *Error
+	var conflict *core.TransitionConflictError
+	switch {
+	case errors.As(err, &apiErr):
+		return apiErr.Code
+	case errors.Is(err, core.ErrObjectNotFound):
+		return CodeObjectNotFound
+	case errors.Is(err, core.ErrNoTransition):
+		return CodeNoTransition
+	case errors.As(err, &conflict):
+		return CodeTransitionConflict
+	case errors.Is(err, core.ErrVetoed):
+		return CodeVetoed
+	case errors.Is(err, core.ErrStatusConflict):
+		return CodeStatusConflict
+	case errors.Is(err, core.ErrPendingNotFound):
+		return CodePendingNotFound
+	case errors.Is(err, core.ErrPendingTimeout):
+		return CodePendingTimeout
+	case errors.Is(err, core.ErrPending):
+		return CodePending
+	case errors.Is(err, core.ErrInFlight):
+		return CodeInFlight
+	case errors.Is(err, core.ErrCircuitOpen):
+		return CodeCircuitOpen
+	default:
+		return CodeInternal
+	}
+}
+
+// httpStatus returns HTTP status code of response with error code
+func httpStatus(code ErrorCode) int {
+	switch code {
+	case CodeInvalidRequest:
+		return http.StatusBadRequest
+	case CodeMachineNotFound, CodeObjectNotFound, CodePendingNotFound:
+		return http.StatusNotFound
+	case CodeNoTransition, CodeVetoed:
+		return http.StatusUnprocessableEntity
+	case CodeTransitionConflict, CodeStatusConflict, CodeInFlight:
+		return http.StatusConflict
+	case CodePending:
+		return http.StatusAccepted
+	case CodePendingTimeout:
+		return http.StatusGone
+	case CodeCircuitOpen:
+		return http.StatusServiceUnavailable
+	case CodeNotImplemented:
+		return http.StatusNotImplemented
+	default:
+		return http.StatusInternalServerError
+	}
+}
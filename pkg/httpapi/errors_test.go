@@ -0,0 +1,40 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+func TestCodeOf(t *testing.T) {
+	tests := []struct {
+		err    error
+		code   ErrorCode
+		status int
+	}{
+		{&Error{Code: CodeInvalidRequest}, CodeInvalidRequest, http.StatusBadRequest},
+		{fmt.Errorf("load: %w", core.ErrObjectNotFound), CodeObjectNotFound, http.StatusNotFound},
+		{fmt.Errorf("SendEvent: %w", core.ErrNoTransition), CodeNoTransition, http.StatusUnprocessableEntity},
+		{fmt.Errorf("SendEvent: %w", &core.TransitionConflictError{}), CodeTransitionConflict, http.StatusConflict},
+		{fmt.Errorf("SendEvent: %w by BeforeTransition hook: %w", core.ErrVetoed, errors.New("forbidden")), CodeVetoed, http.StatusUnprocessableEntity},
+		{&core.StatusConflictError{}, CodeStatusConflict, http.StatusConflict},
+		{&core.PendingError{Token: "abc", Action: "charge"}, CodePending, http.StatusAccepted},
+		{fmt.Errorf("SendEvent: %w: object 1, token abc", core.ErrInFlight), CodeInFlight, http.StatusConflict},
+		{fmt.Errorf("Complete: %w: token abc", core.ErrPendingNotFound), CodePendingNotFound, http.StatusNotFound},
+		{fmt.Errorf("action 'charge': %w after 1m0s", core.ErrPendingTimeout), CodePendingTimeout, http.StatusGone},
+		{fmt.Errorf("action 'charge': %w", core.ErrCircuitOpen), CodeCircuitOpen, http.StatusServiceUnavailable},
+		{errors.New("action failed"), CodeInternal, http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		if code := CodeOf(tt.err); code != tt.code {
+			t.Errorf("expected code %s for %v, got %s", tt.code, tt.err, code)
+		}
+		if status := httpStatus(tt.code); status != tt.status {
+			t.Errorf("expected status %d for %s, got %d", tt.status, tt.code, status)
+		}
+	}
+}
@@ -0,0 +1,546 @@
+// Package httpapi exposes registered machines over HTTP with JSON bodies, so that services
+// written in other languages can drive workflows.
+//
+// Routes:
+//
+//	GET  /machines                                    names of registered machines
+//	GET  /machines/{machine}                          schema: states, transitions, choices and timers
+//	GET  /machines/{machine}/transitions              recent transitions of all objects
+//	GET  /machines/{machine}/objects/{id}             status of object and events available in it
+//	POST /machines/{machine}/objects/{id}/events      send event: {"event": "pay", "payload": {...}};
+//	                                                  202 with PendingView if transition is suspended
+//	GET  /machines/{machine}/objects/{id}/transitions recent transitions of object
+//	POST /machines/{machine}/pending/{token}/complete complete pending transition: {"output": {...}};
+//	                                                  202 with PendingView if transition is suspended again
+//	POST /machines/{machine}/pending/{token}/fail     fail pending transition: {"error": "declined"},
+//	                                                  status of object stays the same
+//
+// Transition lists accept "limit" query parameter. Transitions are read from repository of machine
+// if it implements TransitionLister, otherwise they are collected from machine's Bus since registration,
+// including transitions performed by timers or other callers of machine in this process.
+//
+// Failed requests are answered with Error in body and HTTP status derived from its code.
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// HistorySize is a number of recent transitions collected from Bus per machine, 100 by default
+type HistorySize int
+
+const defaultHistorySize = 100
+
+// Handler is an http.Handler which serves registered machines
+type Handler struct {
+	mux         *http.ServeMux
+	clock       core.Clock
+	historySize int
+	// logger is optional, errors which aren't exposed to clients are logged there
+	logger core.Logger
+
+	mu       sync.RWMutex
+	machines map[string]*registration
+}
+
+// registration is a machine served by Handler
+type registration struct {
+	machine    *core.Machine
+	repository core.Repository
+	// history is collected from machine's Bus by sub unless repository implements TransitionLister,
+	// nil if there is no source of transitions
+	history *history
+	sub     *core.Subscription
+}
+
+// TransitionLister is an optional extension of repository passed to Handler.Register. If repository implements it
+// then transitions are listed from it, e.g. from notifications saved by core.TransitionRecorder, so that
+// transitions performed by all processes are listed.
+type TransitionLister interface {
+	// Transitions returns up to limit recent transitions, newest first, filtered by objectID unless it's empty.
+	// limit <= 0 means no limit.
+	Transitions(ctx context.Context, objectID string, limit int) ([]core.TransitionEvent, error)
+}
+
+// NewHandler returns handler without machines. Optional args: core.Clock for timestamps of transitions in responses
+// to events, HistorySize, core.Logger for internal errors, whose details aren't sent to clients.
+func NewHandler(args ...interface{}) (*Handler, error) {
+	h := &Handler{
+		mux:         http.NewServeMux(),
+		clock:       core.SystemClock,
+		historySize: defaultHistorySize,
+		machines:    make(map[string]*registration),
+	}
+
+	// handle variadic optional args based on passed types
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case core.Clock:
+			h.clock = arg
+		case HistorySize:
+			if arg <= 0 {
+				return nil, fmt.Errorf("history size must be positive, got %d", arg)
+			}
+			h.historySize = int(arg)
+		case core.Logger:
+			h.logger = arg
+		default:
+			return nil, fmt.Errorf("unknown type %T, value %v in NewHandler call", arg, arg)
+		}
+	}
+
+	h.mux.HandleFunc("GET /machines", h.listMachines)
+	h.mux.HandleFunc("GET /machines/{machine}", h.describeMachine)
+	h.mux.HandleFunc("GET /machines/{machine}/transitions", h.listTransitions)
+	h.mux.HandleFunc("GET /machines/{machine}/objects/{id}", h.describeObject)
+	h.mux.HandleFunc("POST /machines/{machine}/objects/{id}/events", h.sendEvent)
+	h.mux.HandleFunc("GET /machines/{machine}/objects/{id}/transitions", h.listTransitions)
+	h.mux.HandleFunc("POST /machines/{machine}/pending/{token}/complete", h.completePending)
+	h.mux.HandleFunc("POST /machines/{machine}/pending/{token}/fail", h.failPending)
+
+	return h, nil
+}
+
+// Register makes machine available under name. Objects are loaded from and saved to repository;
+// if it implements core.TransitionRecorder then notifications about transitions are saved along with objects.
+// Unless repository implements TransitionLister, handler subscribes to machine's Bus, if any, to collect
+// recent transitions until it's closed.
+//
+// Pending transitions are completed by machine, which loads and saves objects with its own Repository, so it
+// should be created with the same repository. Machine without Repository keeps objects of pending transitions
+// in memory, handler saves them to repository after completion.
+func (h *Handler) Register(name string, m *core.Machine, repository core.Repository) error {
+	if name == "" {
+		return fmt.Errorf("machine name is required")
+	}
+	if repository == nil {
+		return fmt.Errorf("repository is required for machine %s", name)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.machines[name]; ok {
+		return fmt.Errorf("machine %s is already registered", name)
+	}
+	reg := &registration{machine: m, repository: repository}
+	if _, ok := repository.(TransitionLister); !ok && m.Bus() != nil {
+		sub, err := m.Bus().Subscribe(core.Filter{}, h.historySize)
+		if err != nil {
+			return err
+		}
+		reg.history, reg.sub = newHistory(h.historySize), sub
+		go reg.collect()
+	}
+	h.machines[name] = reg
+	return nil
+}
+
+// collect adds transitions published to machine's Bus to history until subscription is cancelled.
+// Bus can be shared by machines, so transitions of other schemas are skipped.
+func (reg *registration) collect() {
+	schema := reg.machine.Schema().Name
+	for e := range reg.sub.C {
+		if e.Machine == schema {
+			reg.history.add(newTransitionRecord(e))
+		}
+	}
+}
+
+// Close stops collecting transitions from buses of registered machines
+func (h *Handler) Close() {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for _, reg := range h.machines {
+		if reg.sub != nil {
+			reg.sub.Unsubscribe()
+		}
+	}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// registration returns machine named in request path
+func (h *Handler) registration(r *http.Request) (*registration, error) {
+	name := r.PathValue("machine")
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	reg, ok := h.machines[name]
+	if !ok {
+		return nil, &Error{Code: CodeMachineNotFound, Message: fmt.Sprintf("machine '%s' is not registered", name)}
+	}
+	return reg, nil
+}
+
+func (h *Handler) listMachines(w http.ResponseWriter, r *http.Request) {
+	h.mu.RLock()
+	names := make([]string, 0, len(h.machines))
+	for name := range h.machines {
+		names = append(names, name)
+	}
+	h.mu.RUnlock()
+
+	sort.Strings(names)
+	h.writeJSON(w, r, http.StatusOK, map[string][]string{"machines": names})
+}
+
+func (h *Handler) describeMachine(w http.ResponseWriter, r *http.Request) {
+	reg, err := h.registration(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.writeJSON(w, r, http.StatusOK, newSchemaView(reg.machine.Schema()))
+}
+
+// ObjectView is a response for object: its status and events which can be sent to it
+type ObjectView struct {
+	ID     string       `json:"id"`
+	Status string       `json:"status"`
+	Final  bool         `json:"final"`
+	Events []core.Event `json:"events"`
+}
+
+func (h *Handler) describeObject(w http.ResponseWriter, r *http.Request) {
+	reg, err := h.registration(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	id := r.PathValue("id")
+	o, err := reg.repository.Load(r.Context(), id)
+	if err != nil {
+		h.writeError(w, r, fmt.Errorf("failed to load object %s: %w", id, err))
+		return
+	}
+
+	m := reg.machine.WithContext(r.Context())
+	trs, err := m.AvailableTransitions(o)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	events := []core.Event{}
+	seen := map[core.Event]bool{}
+	for _, t := range trs {
+		if !seen[t.Event] {
+			seen[t.Event] = true
+			events = append(events, t.Event)
+		}
+	}
+
+	h.writeJSON(w, r, http.StatusOK, ObjectView{ID: id, Status: o.Status(), Final: m.IsInFinalState(o), Events: events})
+}
+
+// EventRequest is a body of request which sends event to object.
+// Payload is passed to guards and actions as json.RawMessage, see core.PayloadFrom.
+type EventRequest struct {
+	Event   core.Event      `json:"event"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// ActionView is a result of action performed in transition
+type ActionView struct {
+	Name   string      `json:"name"`
+	Output interface{} `json:"output,omitempty"`
+	// Attempts is set for actions which have retry policy
+	Attempts int `json:"attempts,omitempty"`
+}
+
+// PendingView is a body of response to event if transition waits for completion of asynchronous action.
+// Status of object stays the same until transition is completed with Token, see core.Machine.Complete.
+type PendingView struct {
+	ObjectID string       `json:"objectId"`
+	From     string       `json:"from"`
+	Event    core.Event   `json:"event"`
+	Token    string       `json:"token"`
+	Action   string       `json:"action"`
+	Results  []ActionView `json:"results,omitempty"`
+}
+
+func (h *Handler) sendEvent(w http.ResponseWriter, r *http.Request) {
+	reg, err := h.registration(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	var req EventRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, &Error{Code: CodeInvalidRequest, Message: fmt.Sprintf("failed to decode body: %v", err)})
+		return
+	}
+	if req.Event == "" {
+		h.writeError(w, r, &Error{Code: CodeInvalidRequest, Message: "event is required"})
+		return
+	}
+
+	id := r.PathValue("id")
+	o, err := reg.repository.Load(r.Context(), id)
+	if err != nil {
+		h.writeError(w, r, fmt.Errorf("failed to load object %s: %w", id, err))
+		return
+	}
+
+	ctx := r.Context()
+	if len(req.Payload) > 0 {
+		ctx = core.WithPayload(ctx, req.Payload)
+	}
+
+	m := reg.machine.WithContext(ctx)
+	from := o.Status()
+	results, err := m.SendEvent(o, req.Event)
+	var pending *core.PendingError
+	if errors.As(err, &pending) {
+		// suspended transition doesn't change status, it's saved when it's completed
+		h.writeJSON(w, r, httpStatus(CodePending), PendingView{
+			ObjectID: id,
+			From:     from,
+			Event:    req.Event,
+			Token:    pending.Token,
+			Action:   pending.Action,
+			Results:  actionViews(results),
+		})
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	info := core.TransitionInfo{Object: o, Event: req.Event, From: from, To: o.Status(), Results: results}
+	if err := m.SaveTransition(reg.repository, info); err != nil {
+		h.writeError(w, r, fmt.Errorf("failed to save object %s: %w", id, err))
+		return
+	}
+
+	h.writeJSON(w, r, http.StatusOK, TransitionRecord{
+		ObjectID: id,
+		From:     from,
+		To:       o.Status(),
+		Event:    req.Event,
+		Time:     h.clock.Now(),
+		Results:  actionViews(results),
+	})
+}
+
+// newPendingView returns view of pending transition
+func newPendingView(p core.PendingTransition) PendingView {
+	return PendingView{
+		ObjectID: p.ObjectID,
+		From:     p.From,
+		Event:    p.Event,
+		Token:    p.Token,
+		Action:   p.Action,
+		Results:  actionViews(p.Results),
+	}
+}
+
+// CompleteRequest is a body of request which completes pending transition.
+// Output is passed to the rest of actions as a result of pending action, as json.RawMessage.
+type CompleteRequest struct {
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+// FailRequest is a body of request which fails pending transition with error of asynchronous action
+type FailRequest struct {
+	Error string `json:"error"`
+}
+
+// CompletionView is a body of response to completion of pending transition
+type CompletionView struct {
+	ObjectID string       `json:"objectId"`
+	Status   string       `json:"status"`
+	Results  []ActionView `json:"results,omitempty"`
+}
+
+func (h *Handler) completePending(w http.ResponseWriter, r *http.Request) {
+	reg, err := h.registration(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	var req CompleteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		h.writeError(w, r, &Error{Code: CodeInvalidRequest, Message: fmt.Sprintf("failed to decode body: %v", err)})
+		return
+	}
+	var output interface{}
+	if len(req.Output) > 0 {
+		output = req.Output
+	}
+
+	token := r.PathValue("token")
+	m := reg.machine.WithContext(r.Context())
+
+	// machine without Repository doesn't save object, handler saves it as after SendEvent
+	var pending core.PendingTransition
+	save := m.Repository() == nil
+	if save {
+		all, err := m.PendingTransitions()
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		for _, p := range all {
+			if p.Token == token {
+				pending = p
+			}
+		}
+	}
+
+	o, results, err := m.Complete(token, output)
+	if errors.Is(err, core.ErrPending) {
+		p, ok, err := m.Pending(o)
+		if err == nil && !ok {
+			err = errors.New("transition is suspended, but it isn't found")
+		}
+		if err != nil {
+			h.writeError(w, r, fmt.Errorf("failed to get pending transition of object: %w", err))
+			return
+		}
+		h.writeJSON(w, r, httpStatus(CodePending), newPendingView(p))
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	id := pending.ObjectID
+	if identifiable, ok := o.(core.Identifiable); ok {
+		id = identifiable.ID()
+	}
+	if save {
+		info := core.TransitionInfo{Object: o, Event: pending.Event, From: pending.From, To: o.Status(), Results: results}
+		if err := m.SaveTransition(reg.repository, info); err != nil {
+			h.writeError(w, r, fmt.Errorf("failed to save object %s: %w", id, err))
+			return
+		}
+	}
+
+	h.writeJSON(w, r, http.StatusOK, CompletionView{ObjectID: id, Status: o.Status(), Results: actionViews(results)})
+}
+
+func (h *Handler) failPending(w http.ResponseWriter, r *http.Request) {
+	reg, err := h.registration(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	var req FailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		h.writeError(w, r, &Error{Code: CodeInvalidRequest, Message: fmt.Sprintf("failed to decode body: %v", err)})
+		return
+	}
+	if req.Error == "" {
+		h.writeError(w, r, &Error{Code: CodeInvalidRequest, Message: "error is required"})
+		return
+	}
+
+	// Fail returns cause when transition is failed
+	token := r.PathValue("token")
+	cause := errors.New(req.Error)
+	if err := reg.machine.WithContext(r.Context()).Fail(token, cause); err != nil && !errors.Is(err, cause) {
+		h.writeError(w, r, err)
+		return
+	}
+	h.writeJSON(w, r, http.StatusOK, map[string]string{"token": token, "error": req.Error})
+}
+
+// actionViews returns views of results of actions
+func actionViews(results []core.ActionResult) []ActionView {
+	views := make([]ActionView, len(results))
+	for i, result := range results {
+		views[i] = ActionView{Name: result.Name, Output: result.Output, Attempts: result.Attempts}
+	}
+	return views
+}
+
+func (h *Handler) listTransitions(w http.ResponseWriter, r *http.Request) {
+	reg, err := h.registration(r)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			h.writeError(w, r, &Error{Code: CodeInvalidRequest, Message: fmt.Sprintf("invalid limit '%s'", value)})
+			return
+		}
+	}
+
+	var records []TransitionRecord
+	lister, ok := reg.repository.(TransitionLister)
+	switch {
+	case ok:
+		events, err := lister.Transitions(r.Context(), r.PathValue("id"), limit)
+		if err != nil {
+			h.writeError(w, r, fmt.Errorf("failed to list transitions: %w", err))
+			return
+		}
+		records = make([]TransitionRecord, len(events))
+		for i, e := range events {
+			records[i] = newTransitionRecord(e)
+		}
+	case reg.history != nil:
+		records = reg.history.list(r.PathValue("id"), limit)
+	default:
+		h.writeError(w, r, &Error{
+			Code:    CodeNotImplemented,
+			Message: fmt.Sprintf("machine '%s' has neither Bus nor repository which lists transitions", r.PathValue("machine")),
+		})
+		return
+	}
+	h.writeJSON(w, r, http.StatusOK, map[string][]TransitionRecord{"transitions": records})
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, r *http.Request, status int, body interface{}) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		h.writeError(w, r, fmt.Errorf("failed to encode response: %w", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(data, '\n'))
+}
+
+// writeError answers with code of error. Messages of internal errors, e.g. of repository or its driver,
+// aren't sent to clients, they are logged by handler's Logger.
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code := CodeOf(err)
+	message := err.Error()
+	if code == CodeInternal {
+		if h.logger != nil && h.logger.Enabled(r.Context(), core.LevelError) {
+			h.logger.Log(r.Context(), core.LevelError, "request failed",
+				core.Field{Key: "method", Value: r.Method}, core.Field{Key: "path", Value: r.URL.Path}, core.Field{Key: "error", Value: err})
+		}
+		message = "internal error"
+	}
+	data, _ := json.Marshal(map[string]*Error{"error": {Code: code, Message: message}})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus(code))
+	w.Write(append(data, '\n'))
+}
@@ -0,0 +1,525 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"github.com/estambakio/go-fsm/pkg/outbox"
+)
+
+type order struct {
+	id     string
+	status string
+}
+
+func (o *order) ID() string         { return o.id }
+func (o *order) Status() string     { return o.status }
+func (o *order) SetStatus(s string) { o.status = s }
+
+// memRepository stores copies of orders
+type memRepository struct {
+	mu     sync.Mutex
+	orders map[string]order
+}
+
+func (r *memRepository) Load(ctx context.Context, id string) (core.Object, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[id]
+	if !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	return &o, nil
+}
+
+func (r *memRepository) Save(ctx context.Context, o core.Object) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders[o.(*order).id] = *o.(*order)
+	return nil
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+var now = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func newTestServer(t *testing.T) (*httptest.Server, *memRepository) {
+	t.Helper()
+
+	md, err := core.NewMachineDefinition(
+		core.Schema{
+			Name:         "order",
+			InitialState: core.State{Name: "new"},
+			FinalStates:  []core.State{{Name: "paid"}},
+			States:       []core.State{{Name: "new"}, {Name: "paid"}},
+			Transitions: []core.Transition{
+				{From: "new", To: "paid", Event: "pay", Guards: []core.Guard{{Name: "hasAmount"}}, Actions: []core.ActionDefinition{{Name: "charge"}}},
+				{From: "new", Event: "remind", Internal: true},
+			},
+			Timers: []core.Timer{{State: "new", After: time.Hour, Event: "remind"}},
+		},
+		[]core.Condition{{
+			Name: "hasAmount",
+			F: func(ctx context.Context, o core.Object, p []core.Param) bool {
+				payload, ok := core.PayloadFrom(ctx)
+				if !ok {
+					return false
+				}
+				var body struct{ Amount int }
+				return json.Unmarshal(payload.(json.RawMessage), &body) == nil && body.Amount > 0
+			},
+		}},
+		[]core.Action{{
+			Name: "charge",
+			F: func(ctx context.Context, o core.Object, p []core.Param, r []core.ActionResult) core.ActionResult {
+				return core.ActionResult{Name: "charge", Output: "receipt-" + o.(*order).id}
+			},
+		}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &memRepository{orders: map[string]order{"1": {id: "1", status: "new"}, "2": {id: "2", status: "new"}}}
+
+	h, err := NewHandler(core.Clock(fixedClock(now)), HistorySize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(h.Close)
+	machine := core.NewMachine(context.Background(), md, core.NewBus(), core.Clock(fixedClock(now)))
+	if err := h.Register("order", machine, repo); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Register("order", machine, repo); err == nil {
+		t.Error("expected error for duplicate machine")
+	}
+
+	srv := httptest.NewServer(h)
+	t.Cleanup(srv.Close)
+	return srv, repo
+}
+
+// waitTransitions lists transitions from url until there are n of them, as they are collected from Bus asynchronously
+func waitTransitions(t *testing.T, url string, n int) []TransitionRecord {
+	t.Helper()
+
+	var transitions map[string][]TransitionRecord
+	for i := 0; i < 100; i++ {
+		request(t, "GET", url, "", &transitions)
+		if len(transitions["transitions"]) >= n {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return transitions["transitions"]
+}
+
+// request performs request and decodes JSON response into out
+func request(t *testing.T, method, url, body string, out interface{}) int {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected JSON response, got %s", ct)
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode
+}
+
+func TestHandler_machines(t *testing.T) {
+	srv, _ := newTestServer(t)
+
+	var list map[string][]string
+	if status := request(t, "GET", srv.URL+"/machines", "", &list); status != http.StatusOK || !reflect.DeepEqual(list["machines"], []string{"order"}) {
+		t.Errorf("unexpected list of machines %d %v", status, list)
+	}
+
+	var schema SchemaView
+	if status := request(t, "GET", srv.URL+"/machines/order", "", &schema); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	expected := SchemaView{
+		Name:         "order",
+		InitialState: "new",
+		FinalStates:  []string{"paid"},
+		States:       []string{"new", "paid"},
+		Transitions: []TransitionView{
+			{From: []string{"new"}, To: "paid", Event: "pay", Guards: []GuardView{{Name: "hasAmount"}}, Actions: []string{"charge"}},
+			{From: []string{"new"}, Event: "remind", Internal: true},
+		},
+		Timers: []TimerView{{State: "new", After: "1h0m0s", Event: "remind"}},
+	}
+	if !reflect.DeepEqual(schema, expected) {
+		t.Errorf("expected %+v, got %+v", expected, schema)
+	}
+
+	var body map[string]Error
+	if status := request(t, "GET", srv.URL+"/machines/unknown", "", &body); status != http.StatusNotFound || body["error"].Code != CodeMachineNotFound {
+		t.Errorf("unexpected response %d %v", status, body)
+	}
+}
+
+func TestHandler_objects(t *testing.T) {
+	srv, repo := newTestServer(t)
+
+	var object ObjectView
+	if status := request(t, "GET", srv.URL+"/machines/order/objects/1", "", &object); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	// pay requires payload, so it's not available
+	expected := ObjectView{ID: "1", Status: "new", Events: []core.Event{"remind"}}
+	if !reflect.DeepEqual(object, expected) {
+		t.Errorf("expected %+v, got %+v", expected, object)
+	}
+
+	errorTests := []struct {
+		method, path, body string
+		code               ErrorCode
+		status             int
+	}{
+		{"GET", "/machines/order/objects/3", "", CodeObjectNotFound, http.StatusNotFound},
+		{"POST", "/machines/order/objects/3/events", `{"event": "pay"}`, CodeObjectNotFound, http.StatusNotFound},
+		{"POST", "/machines/order/objects/1/events", `{"event": "pay"}`, CodeNoTransition, http.StatusUnprocessableEntity},
+		{"POST", "/machines/order/objects/1/events", `{"event": "pay", "payload": {"amount": 0}}`, CodeNoTransition, http.StatusUnprocessableEntity},
+		{"POST", "/machines/order/objects/1/events", `{}`, CodeInvalidRequest, http.StatusBadRequest},
+		{"POST", "/machines/order/objects/1/events", `{`, CodeInvalidRequest, http.StatusBadRequest},
+		{"GET", "/machines/order/transitions?limit=x", "", CodeInvalidRequest, http.StatusBadRequest},
+	}
+	for _, tt := range errorTests {
+		var body map[string]Error
+		if status := request(t, tt.method, srv.URL+tt.path, tt.body, &body); status != tt.status || body["error"].Code != tt.code {
+			t.Errorf("expected %d %s for %s %s %s, got %d %v", tt.status, tt.code, tt.method, tt.path, tt.body, status, body)
+		}
+	}
+
+	var record TransitionRecord
+	status := request(t, "POST", srv.URL+"/machines/order/objects/1/events", `{"event": "pay", "payload": {"amount": 10}}`, &record)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	expectedRecord := TransitionRecord{
+		ObjectID: "1",
+		From:     "new",
+		To:       "paid",
+		Event:    "pay",
+		Time:     now,
+		Results:  []ActionView{{Name: "charge", Output: "receipt-1"}},
+	}
+	if !reflect.DeepEqual(record, expectedRecord) {
+		t.Errorf("expected %+v, got %+v", expectedRecord, record)
+	}
+	if repo.orders["1"].status != "paid" {
+		t.Errorf("expected object to be saved, got %v", repo.orders["1"])
+	}
+
+	request(t, "POST", srv.URL+"/machines/order/objects/2/events", `{"event": "remind"}`, &record)
+
+	if list := waitTransitions(t, srv.URL+"/machines/order/transitions", 2); len(list) != 2 || list[0].ObjectID != "2" || list[1].ObjectID != "1" {
+		t.Errorf("expected transitions of both objects newest first, got %+v", list)
+	}
+	if list := waitTransitions(t, srv.URL+"/machines/order/objects/1/transitions?limit=5", 1); !reflect.DeepEqual(list, []TransitionRecord{expectedRecord}) {
+		t.Errorf("expected transition of object 1, got %+v", list)
+	}
+}
+
+// listingRepository lists transitions saved by core.TransitionRecorder
+type listingRepository struct {
+	*memRepository
+	events []core.TransitionEvent
+}
+
+func (r *listingRepository) SaveTransition(ctx context.Context, o core.Object, e core.TransitionEvent) error {
+	r.events = append([]core.TransitionEvent{e}, r.events...)
+	return r.Save(ctx, o)
+}
+
+func (r *listingRepository) Transitions(ctx context.Context, objectID string, limit int) ([]core.TransitionEvent, error) {
+	var events []core.TransitionEvent
+	for _, e := range r.events {
+		if objectID == "" || e.ObjectID == objectID {
+			events = append(events, e)
+		}
+	}
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return events, nil
+}
+
+func TestHandler_transitions(t *testing.T) {
+	md, err := core.NewMachineDefinition(core.Schema{
+		Name:        "order",
+		States:      []core.State{{Name: "new"}, {Name: "paid"}},
+		Transitions: []core.Transition{{From: "new", To: "paid", Event: "pay"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := NewHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer h.Close()
+	// transitions performed by machine outside of handler are listed too
+	repo := &listingRepository{memRepository: &memRepository{orders: map[string]order{"1": {id: "1", status: "new"}}}}
+	machine := core.NewMachine(context.Background(), md, core.NewBus(), core.Clock(fixedClock(now)), repo)
+	if err := h.Register("order", machine, repo); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Register("plain", core.NewMachine(context.Background(), md), repo.memRepository); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	if _, _, err := machine.SendEventByID("1", "pay"); err != nil {
+		t.Fatal(err)
+	}
+	var transitions map[string][]TransitionRecord
+	request(t, "GET", srv.URL+"/machines/order/objects/1/transitions", "", &transitions)
+	expected := []TransitionRecord{{ObjectID: "1", From: "new", To: "paid", Event: "pay", Time: now}}
+	if list := transitions["transitions"]; !reflect.DeepEqual(list, expected) {
+		t.Errorf("expected %+v, got %+v", expected, list)
+	}
+
+	var body struct{ Error Error }
+	if status := request(t, "GET", srv.URL+"/machines/plain/transitions", "", &body); status != http.StatusNotImplemented || body.Error.Code != CodeNotImplemented {
+		t.Errorf("expected not_implemented error without Bus, got %d %+v", status, body)
+	}
+}
+
+// failingRepository fails to load objects
+type failingRepository struct {
+	memRepository
+}
+
+func (r *failingRepository) Load(ctx context.Context, id string) (core.Object, error) {
+	return nil, errors.New("dial tcp 10.0.0.1:5432: connection refused")
+}
+
+func TestHandler_internalError(t *testing.T) {
+	md, err := core.NewMachineDefinition(core.Schema{
+		Name:        "order",
+		States:      []core.State{{Name: "new"}, {Name: "paid"}},
+		Transitions: []core.Transition{{From: "new", To: "paid", Event: "pay"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	h, err := NewHandler(core.NewSlogLogger(slog.New(slog.NewTextHandler(&buf, nil))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Register("order", core.NewMachine(context.Background(), md), &failingRepository{}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	var body struct{ Error Error }
+	status := request(t, "GET", srv.URL+"/machines/order/objects/1", "", &body)
+	if status != http.StatusInternalServerError || body.Error != (Error{Code: CodeInternal, Message: "internal error"}) {
+		t.Errorf("expected generic internal error, got %d %+v", status, body)
+	}
+	if !strings.Contains(buf.String(), "connection refused") {
+		t.Errorf("expected error to be logged, got %q", buf.String())
+	}
+}
+
+func TestNewHandler(t *testing.T) {
+	if _, err := NewHandler(HistorySize(0)); err == nil {
+		t.Error("expected error for empty history")
+	}
+	if _, err := NewHandler("unknown"); err == nil {
+		t.Error("expected error for unknown argument")
+	}
+
+	h, _ := NewHandler()
+	if err := h.Register("order", nil, nil); err == nil {
+		t.Error("expected error without repository")
+	}
+	if err := h.Register("", nil, &memRepository{}); err == nil {
+		t.Error("expected error without name")
+	}
+}
+
+func TestHandler_outbox(t *testing.T) {
+	md, err := core.NewMachineDefinition(core.Schema{
+		Name:        "order",
+		States:      []core.State{{Name: "new"}, {Name: "paid"}},
+		Transitions: []core.Transition{{From: "new", To: "paid", Event: "pay"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := core.NewMachine(context.Background(), md, core.Clock(fixedClock(now)))
+	store, err := outbox.NewFileStore(t.TempDir() + "/outbox.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	h, err := NewHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &memRepository{orders: map[string]order{"1": {id: "1", status: "new"}}}
+	if err := h.Register("order", machine, outbox.Repository{Repository: repo, Store: store}); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	var record TransitionRecord
+	if status := request(t, "POST", srv.URL+"/machines/order/objects/1/events", `{"event": "pay"}`, &record); status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	pending, err := store.Pending(context.Background(), 0)
+	if err != nil || len(pending) != 1 || pending[0].ObjectID != "1" || pending[0].To != "paid" {
+		t.Errorf("expected message about transition in outbox, got %+v, %v", pending, err)
+	}
+	if repo.orders["1"].status != "paid" {
+		t.Errorf("expected object to be saved, got %v", repo.orders["1"])
+	}
+}
+
+func TestHandler_pending(t *testing.T) {
+	md, err := core.NewMachineDefinition(
+		core.Schema{
+			Name:        "order",
+			States:      []core.State{{Name: "new"}, {Name: "paid"}},
+			Transitions: []core.Transition{{From: "new", To: "paid", Event: "pay", Actions: []core.ActionDefinition{{Name: "charge"}}}},
+		},
+		[]core.Action{{Name: "charge", F: func(ctx context.Context, o core.Object, p []core.Param, r []core.ActionResult) core.ActionResult {
+			return core.ActionResult{Name: "charge", Pending: true, Token: "payment-" + o.(*order).id}
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := core.NewMachine(context.Background(), md)
+	h, err := NewHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &memRepository{orders: map[string]order{"1": {id: "1", status: "new"}}}
+	if err := h.Register("order", machine, repo); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	var view PendingView
+	if status := request(t, "POST", srv.URL+"/machines/order/objects/1/events", `{"event": "pay"}`, &view); status != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", status)
+	}
+	expected := PendingView{ObjectID: "1", From: "new", Event: "pay", Token: "payment-1", Action: "charge", Results: []ActionView{{Name: "charge"}}}
+	if !reflect.DeepEqual(view, expected) {
+		t.Errorf("expected %+v, got %+v", expected, view)
+	}
+
+	// object in flight rejects events until transition is completed
+	var body struct{ Error Error }
+	if status := request(t, "POST", srv.URL+"/machines/order/objects/1/events", `{"event": "pay"}`, &body); status != http.StatusConflict || body.Error.Code != CodeInFlight {
+		t.Errorf("expected in_flight error, got %d %+v", status, body)
+	}
+
+	var completion CompletionView
+	if status := request(t, "POST", srv.URL+"/machines/order/pending/payment-1/complete", `{"output": {"id": "ch_1"}}`, &completion); status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	expectedCompletion := CompletionView{ObjectID: "1", Status: "paid", Results: []ActionView{{Name: "charge", Output: map[string]interface{}{"id": "ch_1"}}}}
+	if !reflect.DeepEqual(completion, expectedCompletion) {
+		t.Errorf("expected %+v, got %+v", expectedCompletion, completion)
+	}
+	if repo.orders["1"].status != "paid" {
+		t.Errorf("expected completed object to be saved, got %v", repo.orders["1"])
+	}
+
+	body.Error = Error{}
+	if status := request(t, "POST", srv.URL+"/machines/order/pending/payment-1/complete", `{}`, &body); status != http.StatusNotFound || body.Error.Code != CodePendingNotFound {
+		t.Errorf("expected pending_not_found error, got %d %+v", status, body)
+	}
+}
+
+func TestHandler_failPending(t *testing.T) {
+	md, err := core.NewMachineDefinition(
+		core.Schema{
+			Name:        "order",
+			States:      []core.State{{Name: "new"}, {Name: "paid"}},
+			Transitions: []core.Transition{{From: "new", To: "paid", Event: "pay", Actions: []core.ActionDefinition{{Name: "charge"}}}},
+		},
+		[]core.Action{{Name: "charge", F: func(ctx context.Context, o core.Object, p []core.Param, r []core.ActionResult) core.ActionResult {
+			return core.ActionResult{Name: "charge", Pending: true, Token: "payment-" + o.(*order).id}
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repo := &memRepository{orders: map[string]order{"1": {id: "1", status: "new"}}}
+	machine := core.NewMachine(context.Background(), md)
+	h, err := NewHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Register("order", machine, repo); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	var view PendingView
+	if status := request(t, "POST", srv.URL+"/machines/order/objects/1/events", `{"event": "pay"}`, &view); status != http.StatusAccepted {
+		t.Fatalf("expected status 202, got %d", status)
+	}
+
+	var body struct{ Error Error }
+	if status := request(t, "POST", srv.URL+"/machines/order/pending/payment-1/fail", `{}`, &body); status != http.StatusBadRequest || body.Error.Code != CodeInvalidRequest {
+		t.Errorf("expected invalid_request error, got %d %+v", status, body)
+	}
+
+	var failed map[string]string
+	if status := request(t, "POST", srv.URL+"/machines/order/pending/payment-1/fail", `{"error": "declined"}`, &failed); status != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", status)
+	}
+	if expected := map[string]string{"token": "payment-1", "error": "declined"}; !reflect.DeepEqual(failed, expected) {
+		t.Errorf("expected %v, got %v", expected, failed)
+	}
+	if pending, err := machine.PendingTransitions(); err != nil || len(pending) != 0 {
+		t.Errorf("expected no pending transitions, got %+v, %v", pending, err)
+	}
+	if repo.orders["1"].status != "new" {
+		t.Errorf("expected status of object to stay the same, got %v", repo.orders["1"])
+	}
+
+	body.Error = Error{}
+	if status := request(t, "POST", srv.URL+"/machines/order/pending/payment-1/fail", `{"error": "declined"}`, &body); status != http.StatusNotFound || body.Error.Code != CodePendingNotFound {
+		t.Errorf("expected pending_not_found error, got %d %+v", status, body)
+	}
+}
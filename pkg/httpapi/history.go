@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"sync"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// TransitionRecord describes a transition of object
+type TransitionRecord struct {
+	ObjectID string       `json:"objectId"`
+	From     string       `json:"from"`
+	To       string       `json:"to"`
+	Event    core.Event   `json:"event"`
+	Time     time.Time    `json:"time"`
+	Results  []ActionView `json:"results,omitempty"`
+}
+
+// newTransitionRecord returns record of transition described by notification
+func newTransitionRecord(e core.TransitionEvent) TransitionRecord {
+	return TransitionRecord{
+		ObjectID: e.ObjectID,
+		From:     e.From,
+		To:       e.To,
+		Event:    e.Event,
+		Time:     e.Time,
+		Results:  actionViews(e.Results),
+	}
+}
+
+// history keeps the most recent transitions of a machine in a ring buffer
+type history struct {
+	mu      sync.Mutex
+	records []TransitionRecord
+	// next is a position in records where the next record is written
+	next int
+	full bool
+}
+
+func newHistory(size int) *history {
+	return &history{records: make([]TransitionRecord, size)}
+}
+
+func (h *history) add(r TransitionRecord) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records[h.next] = r
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns up to limit records, newest first. Records are filtered by objectID unless it's empty.
+// limit <= 0 means no limit.
+func (h *history) list(objectID string, limit int) []TransitionRecord {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	n := h.next
+	if h.full {
+		n = len(h.records)
+	}
+
+	records := []TransitionRecord{}
+	for i := 1; i <= n; i++ {
+		r := h.records[(h.next-i+len(h.records))%len(h.records)]
+		if objectID != "" && r.ObjectID != objectID {
+			continue
+		}
+		records = append(records, r)
+		if limit > 0 && len(records) == limit {
+			break
+		}
+	}
+	return records
+}
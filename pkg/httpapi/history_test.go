@@ -0,0 +1,34 @@
+package httpapi
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	h := newHistory(3)
+
+	if records := h.list("", 0); len(records) != 0 {
+		t.Errorf("expected empty history, got %v", records)
+	}
+
+	for _, r := range []TransitionRecord{
+		{ObjectID: "1", To: "a"},
+		{ObjectID: "2", To: "a"},
+		{ObjectID: "1", To: "b"},
+		{ObjectID: "1", To: "c"},
+	} {
+		h.add(r)
+	}
+
+	// the oldest record is evicted, the rest is listed newest first
+	expected := []TransitionRecord{{ObjectID: "1", To: "c"}, {ObjectID: "1", To: "b"}, {ObjectID: "2", To: "a"}}
+	if records := h.list("", 0); !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected %v, got %v", expected, records)
+	}
+
+	expected = []TransitionRecord{{ObjectID: "1", To: "c"}}
+	if records := h.list("1", 1); !reflect.DeepEqual(records, expected) {
+		t.Errorf("expected %v, got %v", expected, records)
+	}
+}
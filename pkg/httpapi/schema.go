@@ -0,0 +1,110 @@
+package httpapi
+
+import "github.com/estambakio/go-fsm/pkg/core"
+
+// SchemaView is a JSON representation of core.Schema
+type SchemaView struct {
+	Name         string           `json:"name"`
+	InitialState string           `json:"initialState"`
+	FinalStates  []string         `json:"finalStates"`
+	States       []string         `json:"states"`
+	Transitions  []TransitionView `json:"transitions"`
+	Choices      []ChoiceView     `json:"choices,omitempty"`
+	Timers       []TimerView      `json:"timers,omitempty"`
+}
+
+// TransitionView is a JSON representation of core.Transition.
+// From contains all source states of transition, core.AnyState included.
+type TransitionView struct {
+	From     []string    `json:"from"`
+	To       string      `json:"to,omitempty"`
+	Event    core.Event  `json:"event"`
+	Internal bool        `json:"internal,omitempty"`
+	Guards   []GuardView `json:"guards,omitempty"`
+	Actions  []string    `json:"actions,omitempty"`
+	Priority int         `json:"priority,omitempty"`
+}
+
+// GuardView is a JSON representation of core.Guard, params are omitted
+type GuardView struct {
+	Name   string `json:"name"`
+	Negate bool   `json:"negate,omitempty"`
+}
+
+// ChoiceView is a JSON representation of core.Choice
+type ChoiceView struct {
+	Name     string       `json:"name"`
+	Branches []BranchView `json:"branches"`
+	Else     string       `json:"else,omitempty"`
+	Junction bool         `json:"junction,omitempty"`
+}
+
+// BranchView is a JSON representation of core.Branch
+type BranchView struct {
+	To      string      `json:"to"`
+	Guards  []GuardView `json:"guards,omitempty"`
+	Actions []string    `json:"actions,omitempty"`
+}
+
+// TimerView is a JSON representation of core.Timer, After is formatted as Go duration
+type TimerView struct {
+	State string     `json:"state"`
+	After string     `json:"after"`
+	Event core.Event `json:"event"`
+}
+
+func newSchemaView(s core.Schema) SchemaView {
+	v := SchemaView{
+		Name:         s.Name,
+		InitialState: s.InitialState.Name,
+		FinalStates:  stateNames(s.FinalStates),
+		States:       stateNames(s.States),
+		Transitions:  make([]TransitionView, len(s.Transitions)),
+	}
+	for i, t := range s.Transitions {
+		v.Transitions[i] = TransitionView{
+			From:     t.Sources(),
+			To:       t.To,
+			Event:    t.Event,
+			Internal: t.Internal,
+			Guards:   guardViews(t.Guards),
+			Actions:  actionNames(t.Actions),
+			Priority: t.Priority,
+		}
+	}
+	for _, c := range s.Choices {
+		cv := ChoiceView{Name: c.Name, Branches: make([]BranchView, len(c.Branches)), Else: c.Else, Junction: c.Junction}
+		for i, b := range c.Branches {
+			cv.Branches[i] = BranchView{To: b.To, Guards: guardViews(b.Guards), Actions: actionNames(b.Actions)}
+		}
+		v.Choices = append(v.Choices, cv)
+	}
+	for _, tm := range s.Timers {
+		v.Timers = append(v.Timers, TimerView{State: tm.State, After: tm.After.String(), Event: tm.Event})
+	}
+	return v
+}
+
+func stateNames(states []core.State) []string {
+	names := make([]string, len(states))
+	for i, s := range states {
+		names[i] = s.Name
+	}
+	return names
+}
+
+func guardViews(guards []core.Guard) []GuardView {
+	var views []GuardView
+	for _, g := range guards {
+		views = append(views, GuardView{Name: g.Name, Negate: g.Negate})
+	}
+	return views
+}
+
+func actionNames(actions []core.ActionDefinition) []string {
+	var names []string
+	for _, a := range actions {
+		names = append(names, a.Name)
+	}
+	return names
+}
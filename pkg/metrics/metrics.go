@@ -0,0 +1,152 @@
+// Package metrics records Prometheus metrics of machines: transitions, guard evaluations and actions.
+//
+// Metrics is a prometheus.Collector which is fed by core.Hooks:
+//
+//	m, _ := metrics.New()
+//	prometheus.MustRegister(m)
+//	machine := core.NewMachine(ctx, md, m.Hooks())
+//
+// Collected metrics (machine label is a name of machine's schema):
+//
+//	fsm_transitions_total{machine, from, to, event}        successful transitions
+//	fsm_transition_errors_total{machine, from, event}      failed or rejected events
+//	fsm_guard_evaluations_total{machine, guard, result}    guard evaluations, result is "pass", "fail" or "cancelled"
+//	fsm_guard_duration_seconds{machine, guard}             latency of guards
+//	fsm_action_failures_total{machine, action}             actions which returned error
+//	fsm_action_duration_seconds{machine, action}           latency of actions
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace is a prefix of metric names, "fsm" by default
+type Namespace string
+
+// Buckets are upper bounds of latency histograms in seconds, prometheus.DefBuckets by default
+type Buckets []float64
+
+// Metrics collects metrics of all machines which use its hooks
+type Metrics struct {
+	transitions      *prometheus.CounterVec
+	transitionErrors *prometheus.CounterVec
+	guards           *prometheus.CounterVec
+	guardDuration    *prometheus.HistogramVec
+	actionFailures   *prometheus.CounterVec
+	actionDuration   *prometheus.HistogramVec
+}
+
+// New returns metrics. Optional args: Namespace, Buckets.
+func New(args ...interface{}) (*Metrics, error) {
+	namespace := "fsm"
+	buckets := prometheus.DefBuckets
+
+	// handle variadic optional args based on passed types
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case Namespace:
+			namespace = string(arg)
+		case Buckets:
+			if len(arg) == 0 {
+				return nil, fmt.Errorf("buckets must not be empty")
+			}
+			buckets = arg
+		default:
+			return nil, fmt.Errorf("unknown type %T, value %v in metrics.New call", arg, arg)
+		}
+	}
+
+	return &Metrics{
+		transitions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transitions_total",
+			Help:      "Number of successful transitions.",
+		}, []string{"machine", "from", "to", "event"}),
+		transitionErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "transition_errors_total",
+			Help:      "Number of events which failed or were rejected.",
+		}, []string{"machine", "from", "event"}),
+		guards: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "guard_evaluations_total",
+			Help:      "Number of guard evaluations by result: pass, fail or cancelled.",
+		}, []string{"machine", "guard", "result"}),
+		guardDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "guard_duration_seconds",
+			Help:      "Latency of guard evaluations.",
+			Buckets:   buckets,
+		}, []string{"machine", "guard"}),
+		actionFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "action_failures_total",
+			Help:      "Number of actions which returned error.",
+		}, []string{"machine", "action"}),
+		actionDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "action_duration_seconds",
+			Help:      "Latency of actions.",
+			Buckets:   buckets,
+		}, []string{"machine", "action"}),
+	}, nil
+}
+
+// Hooks returns hooks which record metrics of machine
+func (m *Metrics) Hooks() core.Hooks {
+	return core.Hooks{
+		AfterTransition: func(ctx context.Context, info core.TransitionInfo) {
+			m.transitions.WithLabelValues(info.Machine, info.From, info.To, string(info.Event)).Inc()
+		},
+		OnError: func(ctx context.Context, info core.TransitionInfo) {
+			m.transitionErrors.WithLabelValues(info.Machine, info.From, string(info.Event)).Inc()
+		},
+		AroundGuard: func(ctx context.Context, info core.GuardInfo, next func(context.Context) bool) bool {
+			start := time.Now()
+			passed := next(ctx)
+			m.guardDuration.WithLabelValues(info.Machine, info.Guard.Name).Observe(time.Since(start).Seconds())
+
+			result := "fail"
+			switch {
+			case ctx.Err() != nil:
+				result = "cancelled"
+			case passed:
+				result = "pass"
+			}
+			m.guards.WithLabelValues(info.Machine, info.Guard.Name, result).Inc()
+			return passed
+		},
+		AroundAction: func(ctx context.Context, info core.ActionInfo, next func(context.Context) core.ActionResult) core.ActionResult {
+			start := time.Now()
+			result := next(ctx)
+			m.actionDuration.WithLabelValues(info.Machine, info.Action.Name).Observe(time.Since(start).Seconds())
+			if result.Err != nil {
+				m.actionFailures.WithLabelValues(info.Machine, info.Action.Name).Inc()
+			}
+			return result
+		},
+	}
+}
+
+// Describe implements prometheus.Collector
+func (m *Metrics) Describe(ch chan<- *prometheus.Desc) {
+	for _, c := range m.collectors() {
+		c.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector
+func (m *Metrics) Collect(ch chan<- prometheus.Metric) {
+	for _, c := range m.collectors() {
+		c.Collect(ch)
+	}
+}
+
+func (m *Metrics) collectors() []prometheus.Collector {
+	return []prometheus.Collector{m.transitions, m.transitionErrors, m.guards, m.guardDuration, m.actionFailures, m.actionDuration}
+}
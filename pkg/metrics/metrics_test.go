@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type order struct{ status string }
+
+func (o *order) Status() string     { return o.status }
+func (o *order) SetStatus(s string) { o.status = s }
+
+func TestMetrics(t *testing.T) {
+	md, err := core.NewMachineDefinition(
+		core.Schema{
+			Name:         "order",
+			InitialState: core.State{Name: "new"},
+			States:       []core.State{{Name: "new"}, {Name: "paid"}, {Name: "failed"}},
+			Transitions: []core.Transition{
+				{From: "new", To: "paid", Event: "pay", Guards: []core.Guard{{Name: "valid"}}, Actions: []core.ActionDefinition{{Name: "charge"}}},
+				{From: "new", To: "failed", Event: "fail", Actions: []core.ActionDefinition{{Name: "broken"}}},
+				{From: "new", To: "failed", Event: "reject", Guards: []core.Guard{{Name: "valid", Negate: true}}},
+			},
+		},
+		[]core.Condition{{Name: "valid", F: func(ctx context.Context, o core.Object, p []core.Param) bool { return true }}},
+		[]core.Action{
+			{Name: "charge", F: func(ctx context.Context, o core.Object, p []core.Param, r []core.ActionResult) core.ActionResult {
+				return core.ActionResult{Name: "charge"}
+			}},
+			{Name: "broken", F: func(ctx context.Context, o core.Object, p []core.Param, r []core.ActionResult) core.ActionResult {
+				return core.ActionResult{Name: "broken", Err: errors.New("failed")}
+			}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(m)
+
+	machine := core.NewMachine(context.Background(), md, m.Hooks())
+	for _, e := range []core.Event{"pay", "fail", "reject"} {
+		machine.SendEvent(&order{status: "new"}, e)
+	}
+
+	expected := `
+# HELP fsm_transitions_total Number of successful transitions.
+# TYPE fsm_transitions_total counter
+fsm_transitions_total{event="pay",from="new",machine="order",to="paid"} 1
+# HELP fsm_transition_errors_total Number of events which failed or were rejected.
+# TYPE fsm_transition_errors_total counter
+fsm_transition_errors_total{event="fail",from="new",machine="order"} 1
+fsm_transition_errors_total{event="reject",from="new",machine="order"} 1
+# HELP fsm_guard_evaluations_total Number of guard evaluations by result: pass, fail or cancelled.
+# TYPE fsm_guard_evaluations_total counter
+fsm_guard_evaluations_total{guard="valid",machine="order",result="fail"} 1
+fsm_guard_evaluations_total{guard="valid",machine="order",result="pass"} 1
+# HELP fsm_action_failures_total Number of actions which returned error.
+# TYPE fsm_action_failures_total counter
+fsm_action_failures_total{action="broken",machine="order"} 1
+`
+	err = testutil.GatherAndCompare(registry, strings.NewReader(expected),
+		"fsm_transitions_total", "fsm_transition_errors_total", "fsm_guard_evaluations_total", "fsm_action_failures_total")
+	if err != nil {
+		t.Error(err)
+	}
+
+	// latency is observed for every guard and action
+	if n := testutil.CollectAndCount(m, "fsm_guard_duration_seconds"); n != 1 {
+		t.Errorf("expected guard latency of a single guard, got %d series", n)
+	}
+	if n := testutil.CollectAndCount(m, "fsm_action_duration_seconds"); n != 2 {
+		t.Errorf("expected latency of 2 actions, got %d series", n)
+	}
+	if problems, err := testutil.GatherAndLint(registry); err != nil || len(problems) > 0 {
+		t.Errorf("unexpected lint problems %v, %v", problems, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	m, err := New(Namespace("workflow"), Buckets{0.1, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Hooks().AfterTransition(context.Background(), core.TransitionInfo{Machine: "m", From: "a", To: "b", Event: "e"})
+	if n := testutil.CollectAndCount(m, "workflow_transitions_total"); n != 1 {
+		t.Errorf("expected metric with namespace, got %d series", n)
+	}
+
+	for _, arg := range []interface{}{Buckets{}, "unknown"} {
+		if _, err := New(arg); err == nil {
+			t.Errorf("expected error for %v", arg)
+		}
+	}
+}
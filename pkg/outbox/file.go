@@ -0,0 +1,212 @@
+package outbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// record is a line of FileStore's log
+type record struct {
+	// Message is set for appended message
+	Message *Message `json:"message,omitempty"`
+	// Ack is a key of delivered message
+	Ack string `json:"ack,omitempty"`
+}
+
+// FileStore keeps messages in append-only log of JSON lines; every change is synced to disk before
+// it's acknowledged. The log is compacted when most of its records refer to delivered messages.
+// Messages can't be written in one unit of work with objects, see Repository for consequences.
+type FileStore struct {
+	path string
+
+	mu      sync.Mutex
+	file    *os.File
+	pending []Message
+	keys    map[string]bool
+	// records is a number of lines in log
+	records int
+}
+
+// compactThreshold is a minimal number of records in log which triggers compaction
+const compactThreshold = 1000
+
+// NewFileStore opens log at provided path, reading pending messages if file exists.
+// Incomplete last line, which can be left by crash, is ignored.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{path: path, keys: make(map[string]bool)}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var r record
+		if err := json.Unmarshal(line, &r); err != nil {
+			if i == len(lines)-1 {
+				break
+			}
+			return nil, fmt.Errorf("outbox log %s is corrupted at line %d: %w", path, i+1, err)
+		}
+		s.apply(r)
+		s.records++
+	}
+
+	// rewrite log to get rid of delivered messages and incomplete line
+	if err := s.compact(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// apply changes in-memory state according to record
+func (s *FileStore) apply(r record) {
+	if r.Message != nil && !s.keys[r.Message.Key] {
+		s.keys[r.Message.Key] = true
+		s.pending = append(s.pending, *r.Message)
+	}
+	if r.Ack != "" && s.keys[r.Ack] {
+		delete(s.keys, r.Ack)
+		for i, m := range s.pending {
+			if m.Key == r.Ack {
+				s.pending = append(s.pending[:i:i], s.pending[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Append implements Store
+func (s *FileStore) Append(ctx context.Context, messages ...Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var records []record
+	for i := range messages {
+		if !s.keys[messages[i].Key] {
+			records = append(records, record{Message: &messages[i]})
+		}
+	}
+	return s.write(records)
+}
+
+// Pending implements Store
+func (s *FileStore) Pending(ctx context.Context, limit int) ([]Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := len(s.pending)
+	if limit > 0 && limit < n {
+		n = limit
+	}
+	return append([]Message(nil), s.pending[:n]...), nil
+}
+
+// Ack implements Store
+func (s *FileStore) Ack(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.keys[key] {
+		return nil
+	}
+	if err := s.write([]record{{Ack: key}}); err != nil {
+		return err
+	}
+	if s.records >= compactThreshold && s.records > 2*len(s.pending) {
+		return s.compact()
+	}
+	return nil
+}
+
+// Close closes log file
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// write appends records to log, syncs it and applies records to in-memory state
+func (s *FileStore) write(records []record) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	for _, r := range records {
+		data, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	if _, err := s.file.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	if err := s.file.Sync(); err != nil {
+		return err
+	}
+
+	for _, r := range records {
+		s.apply(r)
+	}
+	s.records += len(records)
+	return nil
+}
+
+// compact atomically replaces log with records of pending messages and reopens it
+func (s *FileStore) compact() error {
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	for i := range s.pending {
+		data, err := json.Marshal(record{Message: &s.pending[i]})
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		w.Write(data)
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if s.file != nil {
+		s.file.Close()
+	}
+	s.file = file
+	s.records = len(s.pending)
+	return nil
+}
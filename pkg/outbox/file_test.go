@@ -0,0 +1,105 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.log")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []Message{{Key: "1", Machine: "order", Time: now}, {Key: "2"}, {Key: "3"}}
+	if err := store.Append(ctx, messages...); err != nil {
+		t.Fatal(err)
+	}
+	// duplicates are ignored
+	if err := store.Append(ctx, messages[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Ack(ctx, "2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Ack(ctx, "unknown"); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Message{messages[0], messages[2]}
+	if pending, _ := store.Pending(ctx, 0); !reflect.DeepEqual(pending, expected) {
+		t.Errorf("expected %+v, got %+v", expected, pending)
+	}
+	if pending, _ := store.Pending(ctx, 1); !reflect.DeepEqual(pending, expected[:1]) {
+		t.Errorf("expected %+v, got %+v", expected[:1], pending)
+	}
+	store.Close()
+
+	// pending messages survive restart, incomplete line left by crash is ignored
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"message":{"key":"4"`)
+	f.Close()
+
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if pending, _ := store.Pending(ctx, 0); !reflect.DeepEqual(pending, expected) {
+		t.Errorf("expected %+v after restart, got %+v", expected, pending)
+	}
+	if err := store.Append(ctx, Message{Key: "5"}); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := store.Pending(ctx, 0); len(pending) != 3 || pending[2].Key != "5" {
+		t.Errorf("expected message to be appended after restart, got %+v", pending)
+	}
+}
+
+func TestFileStore_corrupted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.log")
+	os.WriteFile(path, []byte("{\n{\"ack\":\"1\"}\n"), 0644)
+	if _, err := NewFileStore(path); err == nil {
+		t.Error("expected error for corrupted log")
+	}
+}
+
+func TestFileStore_compact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "outbox.log")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	for i := 0; i < compactThreshold; i++ {
+		key := fmt.Sprint(i)
+		store.Append(ctx, Message{Key: key})
+		if i%10 != 0 {
+			store.Ack(ctx, key)
+		}
+	}
+
+	if store.records >= compactThreshold {
+		t.Errorf("expected log to be compacted, got %d records", store.records)
+	}
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	pending, _ := reopened.Pending(ctx, 0)
+	if len(pending) != compactThreshold/10 || pending[1].Key != "10" {
+		t.Errorf("expected every tenth message to be pending, got %d messages", len(pending))
+	}
+}
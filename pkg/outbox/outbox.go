@@ -0,0 +1,137 @@
+// Package outbox implements transactional outbox for notifications about transitions.
+//
+// Notifications are written to durable Store along with new status of object, see core.TransitionRecorder,
+// and Relay delivers them to sinks afterwards with retries. Delivery is at-least-once: sinks should
+// drop duplicates using Message.Key.
+//
+// Notification is written in the same unit of work as status only if both are kept in one database,
+// so SQLRepository is the one to start with:
+//
+//	store := outbox.NewSQLStore(db, "outbox", outbox.QuestionPlaceholder)
+//	repo := &outbox.SQLRepository{DB: db, Store: store, LoadObject: loadOrder, SaveObject: saveOrder}
+//	machine := core.NewMachine(ctx, md, repo)
+//	relay, err := outbox.NewRelay(store, sink)
+//
+// Repository with FileStore adds outbox to objects kept elsewhere, see Repository for what it doesn't guarantee.
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// Message is a stored notification about transition
+type Message struct {
+	// Key is an idempotency key, it's unique for transition
+	Key      string     `json:"key"`
+	Machine  string     `json:"machine"`
+	ObjectID string     `json:"objectId"`
+	From     string     `json:"from"`
+	To       string     `json:"to"`
+	Event    core.Event `json:"event"`
+	Actor    string     `json:"actor,omitempty"`
+	Time     time.Time  `json:"time"`
+	Results  []Result   `json:"results,omitempty"`
+}
+
+// Result is an output of action performed in transition, encoded as JSON
+type Result struct {
+	Name   string          `json:"name"`
+	Output json.RawMessage `json:"output,omitempty"`
+}
+
+// NewMessage returns message for notification. Outputs of actions must be encodable as JSON.
+func NewMessage(e core.TransitionEvent) (Message, error) {
+	m := Message{
+		Key:      fmt.Sprintf("%s/%s/%s/%s/%s/%d", e.Machine, e.ObjectID, e.From, e.Event, e.To, e.Time.UnixNano()),
+		Machine:  e.Machine,
+		ObjectID: e.ObjectID,
+		From:     e.From,
+		To:       e.To,
+		Event:    e.Event,
+		Actor:    e.Actor,
+		Time:     e.Time,
+	}
+	for _, r := range e.Results {
+		result := Result{Name: r.Name}
+		if r.Output != nil {
+			output, err := json.Marshal(r.Output)
+			if err != nil {
+				return Message{}, fmt.Errorf("failed to encode output of action %s: %w", r.Name, err)
+			}
+			result.Output = output
+		}
+		m.Results = append(m.Results, result)
+	}
+	return m, nil
+}
+
+// TransitionEvent converts message back to notification, outputs of actions are json.RawMessage
+func (m Message) TransitionEvent() core.TransitionEvent {
+	e := core.TransitionEvent{
+		Machine:  m.Machine,
+		ObjectID: m.ObjectID,
+		From:     m.From,
+		To:       m.To,
+		Event:    m.Event,
+		Actor:    m.Actor,
+		Time:     m.Time,
+	}
+	for _, r := range m.Results {
+		result := core.ActionResult{Name: r.Name}
+		if r.Output != nil {
+			result.Output = r.Output
+		}
+		e.Results = append(e.Results, result)
+	}
+	return e
+}
+
+// Store keeps messages until they are delivered
+type Store interface {
+	// Append stores messages; message with key of pending message isn't duplicated
+	Append(ctx context.Context, messages ...Message) error
+	// Pending returns up to limit undelivered messages in order of appending
+	Pending(ctx context.Context, limit int) ([]Message, error)
+	// Ack removes delivered message
+	Ack(ctx context.Context, key string) error
+}
+
+// Repository adds outbox to any core.Repository: it implements core.TransitionRecorder by appending
+// notification to Store and then saving object. If object can't be saved then notification is removed.
+//
+// Object and notification are stored in different storages, e.g. with FileStore, so it's not a single unit
+// of work and Repository doesn't guarantee that only committed transitions are delivered:
+//   - Relay which runs concurrently can deliver notification after it's appended but before object is saved;
+//     if saving fails then removing notification doesn't undo its delivery;
+//   - if process crashes after notification is appended, then notification is delivered although transition
+//     isn't saved.
+//
+// Every committed transition is still delivered. Consumers can check status of object if it matters;
+// use SQLRepository to store object and notification in one transaction.
+type Repository struct {
+	core.Repository
+	Store Store
+}
+
+// SaveTransition implements core.TransitionRecorder
+func (r Repository) SaveTransition(ctx context.Context, o core.Object, e core.TransitionEvent) error {
+	m, err := NewMessage(e)
+	if err != nil {
+		return err
+	}
+	if err := r.Store.Append(ctx, m); err != nil {
+		return fmt.Errorf("failed to append message to outbox: %w", err)
+	}
+	if err := r.Repository.Save(ctx, o); err != nil {
+		if ackErr := r.Store.Ack(ctx, m.Key); ackErr != nil {
+			return fmt.Errorf("%w (message %s stays in outbox: %v)", err, m.Key, ackErr)
+		}
+		return err
+	}
+	return nil
+}
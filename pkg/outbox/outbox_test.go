@@ -0,0 +1,198 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"github.com/estambakio/go-fsm/pkg/schedule"
+)
+
+type order struct {
+	id     string
+	status string
+}
+
+func (o *order) ID() string         { return o.id }
+func (o *order) Status() string     { return o.status }
+func (o *order) SetStatus(s string) { o.status = s }
+
+// memRepository stores copies of orders
+type memRepository struct {
+	mu       sync.Mutex
+	orders   map[string]order
+	failSave bool
+}
+
+func (r *memRepository) Load(ctx context.Context, id string) (core.Object, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[id]
+	if !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	return &o, nil
+}
+
+func (r *memRepository) Save(ctx context.Context, o core.Object) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.failSave {
+		return errors.New("database is down")
+	}
+	r.orders[o.(*order).id] = *o.(*order)
+	return nil
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+var now = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// newTestMachine returns machine of orders: new -> paid by "pay"
+func newTestMachine(t *testing.T, repo core.Repository) *core.Machine {
+	t.Helper()
+
+	md, err := core.NewMachineDefinition(
+		core.Schema{
+			Name:         "order",
+			InitialState: core.State{Name: "new"},
+			States:       []core.State{{Name: "new"}, {Name: "paid"}},
+			Transitions:  []core.Transition{{From: "new", To: "paid", Event: "pay", Actions: []core.ActionDefinition{{Name: "charge"}}}},
+		},
+		[]core.Action{{
+			Name: "charge",
+			F: func(ctx context.Context, o core.Object, p []core.Param, r []core.ActionResult) core.ActionResult {
+				return core.ActionResult{Name: "charge", Output: map[string]int{"amount": 10}}
+			},
+		}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := core.NewMachine(context.Background(), md, repo, core.Clock(fixedClock(now)))
+	return machine
+}
+
+func TestNewMessage(t *testing.T) {
+	e := core.TransitionEvent{
+		Machine:  "order",
+		ObjectID: "1",
+		From:     "new",
+		To:       "paid",
+		Event:    "pay",
+		Actor:    "bob",
+		Time:     now,
+		Results:  []core.ActionResult{{Name: "charge", Output: 10}, {Name: "notify"}},
+	}
+
+	m, err := NewMessage(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := Message{
+		Key:      "order/1/new/pay/paid/1577934245000000000",
+		Machine:  "order",
+		ObjectID: "1",
+		From:     "new",
+		To:       "paid",
+		Event:    "pay",
+		Actor:    "bob",
+		Time:     now,
+		Results:  []Result{{Name: "charge", Output: json.RawMessage("10")}, {Name: "notify"}},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("expected %+v, got %+v", expected, m)
+	}
+
+	e.Results = []core.ActionResult{{Name: "charge", Output: json.RawMessage("10")}, {Name: "notify"}}
+	if back := m.TransitionEvent(); !reflect.DeepEqual(back, e) {
+		t.Errorf("expected %+v, got %+v", e, back)
+	}
+
+	e.Results = []core.ActionResult{{Name: "charge", Output: func() {}}}
+	if _, err := NewMessage(e); err == nil {
+		t.Error("expected error for output which can't be encoded")
+	}
+}
+
+func TestRepository(t *testing.T) {
+	store, err := NewFileStore(t.TempDir() + "/outbox.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	repo := &memRepository{orders: map[string]order{"1": {id: "1", status: "new"}, "2": {id: "2", status: "new"}}}
+	machine := newTestMachine(t, Repository{Repository: repo, Store: store})
+
+	if _, _, err := machine.SendEventByID("1", "pay"); err != nil {
+		t.Fatal(err)
+	}
+	pending, _ := store.Pending(context.Background(), 0)
+	if len(pending) != 1 || pending[0].ObjectID != "1" || string(pending[0].Results[0].Output) != `{"amount":10}` {
+		t.Errorf("expected message about transition, got %+v", pending)
+	}
+
+	// message is removed if object isn't saved
+	repo.failSave = true
+	if _, _, err := machine.SendEventByID("2", "pay"); err == nil {
+		t.Error("expected error")
+	}
+	if pending, _ := store.Pending(context.Background(), 0); len(pending) != 1 {
+		t.Errorf("expected single message, got %+v", pending)
+	}
+}
+
+func TestRepository_durableScheduler(t *testing.T) {
+	md, err := core.NewMachineDefinition(core.Schema{
+		Name:         "order",
+		InitialState: core.State{Name: "new"},
+		States:       []core.State{{Name: "new"}, {Name: "cancelled"}},
+		Transitions:  []core.Transition{{From: "new", To: "cancelled", Event: "cancel"}},
+		Timers:       []core.Timer{{State: "new", After: time.Hour, Event: "cancel"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := NewFileStore(t.TempDir() + "/outbox.log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	events, err := schedule.NewFileStore(t.TempDir() + "/schedule.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &memRepository{orders: map[string]order{}}
+	machine := core.NewMachine(context.Background(), md, Repository{Repository: repo, Store: store}, core.ScheduleStore(events), core.Clock(fixedClock(now)))
+	o := &order{id: "1"}
+	machine.Start(o)
+	repo.Save(context.Background(), o)
+	if err := machine.Schedule(o); err != nil {
+		t.Fatal(err)
+	}
+
+	// timer's event is delivered by machine of the next hour
+	machine = core.NewMachine(context.Background(), md, Repository{Repository: repo, Store: store}, core.ScheduleStore(events),
+		core.Clock(fixedClock(now.Add(time.Hour))))
+	scheduler, err := core.NewDurableScheduler(machine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fired, err := scheduler.Poll(context.Background()); err != nil || len(fired) != 1 || fired[0].Err != nil {
+		t.Fatalf("expected timer to fire, got %+v, %v", fired, err)
+	}
+	pending, err := store.Pending(context.Background(), 0)
+	if err != nil || len(pending) != 1 || pending[0].To != "cancelled" {
+		t.Errorf("expected message about transition in outbox, got %+v, %v", pending, err)
+	}
+}
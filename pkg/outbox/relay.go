@@ -0,0 +1,188 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// Sink receives messages from Relay. The same message can be delivered more than once,
+// so sink should be idempotent by Message.Key.
+type Sink interface {
+	Deliver(ctx context.Context, m Message) error
+}
+
+// SinkFunc adapts function to Sink
+type SinkFunc func(ctx context.Context, m Message) error
+
+// Deliver implements Sink
+func (f SinkFunc) Deliver(ctx context.Context, m Message) error {
+	return f(ctx, m)
+}
+
+// Fanout returns sink which delivers message to every sink in order.
+// If one of them fails then message is delivered to all of them again on retry.
+func Fanout(sinks ...Sink) Sink {
+	return SinkFunc(func(ctx context.Context, m Message) error {
+		for _, s := range sinks {
+			if err := s.Deliver(ctx, m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// BusSink returns sink which publishes messages to in-process bus
+func BusSink(bus *core.Bus) Sink {
+	return SinkFunc(func(ctx context.Context, m Message) error {
+		bus.Publish(m.TransitionEvent())
+		return nil
+	})
+}
+
+// Backoff defines delays between retries of failed delivery: Initial delay is doubled after every
+// failed attempt up to Max. Default is 100ms up to 1 minute.
+type Backoff struct {
+	Initial time.Duration
+	Max     time.Duration
+}
+
+// delay returns delay before the next attempt after provided number of failed attempts
+func (b Backoff) delay(attempts int) time.Duration {
+	d := b.Initial
+	for i := 1; i < attempts && d < b.Max; i++ {
+		d *= 2
+	}
+	if d > b.Max {
+		d = b.Max
+	}
+	return d
+}
+
+// BatchSize is a number of messages which Relay reads from Store at once, 100 by default
+type BatchSize int
+
+// DeliveryError is returned by Relay.Deliver when sink fails to deliver message
+type DeliveryError struct {
+	Key string
+	// Attempts is a number of failed attempts to deliver the message in a row
+	Attempts int
+	Err      error
+}
+
+func (e *DeliveryError) Error() string {
+	return fmt.Sprintf("failed to deliver message %s (attempt %d): %v", e.Key, e.Attempts, e.Err)
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// Relay delivers messages from Store to Sink in order of appending. Messages are removed from Store
+// after successful delivery. Failed message blocks the following ones, so that order is preserved.
+type Relay struct {
+	store     Store
+	sink      Sink
+	backoff   Backoff
+	batchSize int
+
+	// failedKey and attempts track failed deliveries of the first pending message
+	failedKey string
+	attempts  int
+}
+
+// NewRelay returns relay. Optional args: Backoff, BatchSize.
+func NewRelay(store Store, sink Sink, args ...interface{}) (*Relay, error) {
+	r := &Relay{
+		store:     store,
+		sink:      sink,
+		backoff:   Backoff{Initial: 100 * time.Millisecond, Max: time.Minute},
+		batchSize: 100,
+	}
+
+	// handle variadic optional args based on passed types
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case Backoff:
+			if arg.Initial <= 0 || arg.Max < arg.Initial {
+				return nil, fmt.Errorf("invalid backoff %+v", arg)
+			}
+			r.backoff = arg
+		case BatchSize:
+			if arg <= 0 {
+				return nil, fmt.Errorf("batch size must be positive, got %d", arg)
+			}
+			r.batchSize = int(arg)
+		default:
+			return nil, fmt.Errorf("unknown type %T, value %v in NewRelay call", arg, arg)
+		}
+	}
+
+	return r, nil
+}
+
+// Deliver delivers a batch of pending messages and returns number of delivered ones.
+// It stops at the first failed message and returns *DeliveryError; other errors come from Store.
+// Deliver must not be called concurrently.
+func (r *Relay) Deliver(ctx context.Context) (int, error) {
+	messages, err := r.store.Pending(ctx, r.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read pending messages: %w", err)
+	}
+
+	for i, m := range messages {
+		if err := r.sink.Deliver(ctx, m); err != nil {
+			if r.failedKey != m.Key {
+				r.failedKey, r.attempts = m.Key, 0
+			}
+			r.attempts++
+			return i, &DeliveryError{Key: m.Key, Attempts: r.attempts, Err: err}
+		}
+		r.failedKey, r.attempts = "", 0
+
+		if err := r.store.Ack(ctx, m.Key); err != nil {
+			return i, fmt.Errorf("message %s is delivered, but not removed from outbox: %w", m.Key, err)
+		}
+	}
+	return len(messages), nil
+}
+
+// Run delivers messages until context is cancelled. Store is polled with provided interval;
+// failed delivery is retried according to Backoff. Delivery errors are passed to optional callback;
+// errors of Store stop the relay.
+func (r *Relay) Run(ctx context.Context, interval time.Duration, callback func(error)) error {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+
+		delivered, err := r.Deliver(ctx)
+		var deliveryErr *DeliveryError
+		switch {
+		case errors.As(err, &deliveryErr):
+			if callback != nil {
+				callback(err)
+			}
+			timer.Reset(r.backoff.delay(deliveryErr.Attempts))
+		case err != nil:
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		case delivered == r.batchSize:
+			// there can be more pending messages
+			timer.Reset(0)
+		default:
+			timer.Reset(interval)
+		}
+	}
+}
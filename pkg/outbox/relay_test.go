@@ -0,0 +1,165 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// recordingSink records delivered keys and fails while fail is set
+type recordingSink struct {
+	mu        sync.Mutex
+	delivered []string
+	fail      map[string]int
+}
+
+func (s *recordingSink) Deliver(ctx context.Context, m Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fail[m.Key] > 0 {
+		s.fail[m.Key]--
+		return errors.New("sink is down")
+	}
+	s.delivered = append(s.delivered, m.Key)
+	return nil
+}
+
+func (s *recordingSink) keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.delivered...)
+}
+
+func newTestStore(t *testing.T, keys ...string) *FileStore {
+	t.Helper()
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "outbox.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	for _, key := range keys {
+		store.Append(context.Background(), Message{Key: key})
+	}
+	return store
+}
+
+func TestRelay_Deliver(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t, "1", "2", "3")
+	sink := &recordingSink{fail: map[string]int{"2": 2}}
+
+	relay, err := NewRelay(store, sink, BatchSize(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the failed message blocks the following ones
+	for attempt := 1; attempt <= 2; attempt++ {
+		delivered, err := relay.Deliver(ctx)
+		var deliveryErr *DeliveryError
+		if !errors.As(err, &deliveryErr) || deliveryErr.Key != "2" || deliveryErr.Attempts != attempt {
+			t.Fatalf("expected failed delivery of message 2, got %v", err)
+		}
+		if attempt == 1 && delivered != 1 {
+			t.Errorf("expected 1 delivered message, got %d", delivered)
+		}
+	}
+
+	if delivered, err := relay.Deliver(ctx); err != nil || delivered != 2 {
+		t.Errorf("expected 2 delivered messages, got %d, %v", delivered, err)
+	}
+	if keys := sink.keys(); !reflect.DeepEqual(keys, []string{"1", "2", "3"}) {
+		t.Errorf("expected messages in order, got %v", keys)
+	}
+	if pending, _ := store.Pending(ctx, 0); len(pending) != 0 {
+		t.Errorf("expected delivered messages to be removed, got %+v", pending)
+	}
+}
+
+func TestRelay_Run(t *testing.T) {
+	store := newTestStore(t, "1", "2", "3")
+	sink := &recordingSink{fail: map[string]int{"1": 3}}
+
+	relay, err := NewRelay(store, sink, Backoff{Initial: time.Millisecond, Max: 2 * time.Millisecond}, BatchSize(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var mu sync.Mutex
+	var failures []error
+	done := make(chan error)
+	go func() {
+		done <- relay.Run(ctx, time.Millisecond, func(err error) {
+			mu.Lock()
+			failures = append(failures, err)
+			mu.Unlock()
+		})
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.keys()) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	if keys := sink.keys(); !reflect.DeepEqual(keys, []string{"1", "2", "3"}) {
+		t.Errorf("expected all messages to be delivered in order, got %v", keys)
+	}
+	if len(failures) != 3 {
+		t.Errorf("expected 3 failures, got %v", failures)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Initial: time.Second, Max: 5 * time.Second}
+	for attempts, expected := range map[int]time.Duration{1: time.Second, 2: 2 * time.Second, 3: 4 * time.Second, 4: 5 * time.Second, 100: 5 * time.Second} {
+		if d := b.delay(attempts); d != expected {
+			t.Errorf("expected %s after %d attempts, got %s", expected, attempts, d)
+		}
+	}
+}
+
+func TestNewRelay(t *testing.T) {
+	for _, arg := range []interface{}{Backoff{}, Backoff{Initial: 2, Max: 1}, BatchSize(0), "unknown"} {
+		if _, err := NewRelay(nil, nil, arg); err == nil {
+			t.Errorf("expected error for %v", arg)
+		}
+	}
+}
+
+func TestSinks(t *testing.T) {
+	bus := core.NewBus()
+	s, _ := bus.Subscribe(core.Filter{}, 1)
+
+	first := &recordingSink{}
+	second := &recordingSink{fail: map[string]int{"1": 1}}
+	sink := Fanout(BusSink(bus), first, second)
+
+	m := Message{Key: "1", ObjectID: "42", Event: "pay"}
+	if err := sink.Deliver(context.Background(), m); err == nil {
+		t.Error("expected error of the second sink")
+	}
+	if err := sink.Deliver(context.Background(), m); err != nil {
+		t.Fatal(err)
+	}
+
+	if keys := first.keys(); !reflect.DeepEqual(keys, []string{"1", "1"}) {
+		t.Errorf("expected message to be delivered twice to the first sink, got %v", keys)
+	}
+	if keys := second.keys(); !reflect.DeepEqual(keys, []string{"1"}) {
+		t.Errorf("expected message to be delivered to the second sink, got %v", keys)
+	}
+	if e := <-s.C; e.ObjectID != "42" || e.Event != "pay" {
+		t.Errorf("unexpected notification %+v", e)
+	}
+}
@@ -0,0 +1,176 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/estambakio/go-fsm/internal/sqlquery"
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// Placeholder returns bind parameter for n-th (starting from 1) argument of SQL statement
+type Placeholder = sqlquery.Placeholder
+
+// QuestionPlaceholder is used by MySQL and SQLite
+func QuestionPlaceholder(n int) string {
+	return sqlquery.Question(n)
+}
+
+// DollarPlaceholder is used by PostgreSQL
+func DollarPlaceholder(n int) string {
+	return sqlquery.Dollar(n)
+}
+
+// SQLStore keeps messages in SQL table, e.g. in SQLite database of application.
+// Messages are ordered by time of transition and then by key.
+type SQLStore struct {
+	db          *sql.DB
+	table       string
+	placeholder Placeholder
+}
+
+// NewSQLStore returns store which uses provided table. Placeholder defaults to QuestionPlaceholder if nil.
+func NewSQLStore(db *sql.DB, table string, placeholder Placeholder) *SQLStore {
+	if placeholder == nil {
+		placeholder = QuestionPlaceholder
+	}
+	return &SQLStore{db: db, table: table, placeholder: placeholder}
+}
+
+// CreateTable creates table for messages if it doesn't exist
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, s.query(`CREATE TABLE IF NOT EXISTS {table} (
+	message_key VARCHAR(255) PRIMARY KEY,
+	created BIGINT NOT NULL,
+	message TEXT NOT NULL
+)`))
+	return err
+}
+
+// Append implements Store
+func (s *SQLStore) Append(ctx context.Context, messages ...Message) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err = s.AppendTx(ctx, tx, messages...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AppendTx stores messages in transaction of caller, so that they are committed along with other changes
+func (s *SQLStore) AppendTx(ctx context.Context, tx *sql.Tx, messages ...Message) error {
+	for _, m := range messages {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE message_key = {1}`), m.Key); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			s.query(`INSERT INTO {table} (message_key, created, message) VALUES ({1}, {2}, {3})`),
+			m.Key, m.Time.UnixNano(), string(data),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Pending implements Store
+func (s *SQLStore) Pending(ctx context.Context, limit int) ([]Message, error) {
+	statement := `SELECT message FROM {table} ORDER BY created, message_key`
+	if limit > 0 {
+		statement += fmt.Sprintf(" LIMIT %d", limit)
+	}
+	rows, err := s.db.QueryContext(ctx, s.query(statement))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []Message
+	for rows.Next() {
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var m Message
+		if err := json.Unmarshal([]byte(data), &m); err != nil {
+			return nil, err
+		}
+		messages = append(messages, m)
+	}
+	return messages, rows.Err()
+}
+
+// Ack implements Store
+func (s *SQLStore) Ack(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE message_key = {1}`), key)
+	return err
+}
+
+// query substitutes table name and placeholders {1}, {2}... in statement
+func (s *SQLStore) query(statement string) string {
+	return sqlquery.Render(statement, s.table, s.placeholder, 3)
+}
+
+// SQLRepository is a core.Repository for objects stored in the same database as SQLStore.
+// Object and notification about its transition are saved in a single transaction.
+type SQLRepository struct {
+	DB    *sql.DB
+	Store *SQLStore
+	// LoadObject loads object by ID, it should return core.ErrObjectNotFound if object doesn't exist
+	LoadObject func(ctx context.Context, db *sql.DB, id string) (core.Object, error)
+	// SaveObject saves object in transaction
+	SaveObject func(ctx context.Context, tx *sql.Tx, o core.Object) error
+}
+
+// Load implements core.Repository
+func (r *SQLRepository) Load(ctx context.Context, id string) (core.Object, error) {
+	return r.LoadObject(ctx, r.DB, id)
+}
+
+// Save implements core.Repository
+func (r *SQLRepository) Save(ctx context.Context, o core.Object) error {
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		return r.SaveObject(ctx, tx, o)
+	})
+}
+
+// SaveTransition implements core.TransitionRecorder
+func (r *SQLRepository) SaveTransition(ctx context.Context, o core.Object, e core.TransitionEvent) error {
+	m, err := NewMessage(e)
+	if err != nil {
+		return err
+	}
+	return r.inTx(ctx, func(tx *sql.Tx) error {
+		if err := r.SaveObject(ctx, tx, o); err != nil {
+			return err
+		}
+		return r.Store.AppendTx(ctx, tx, m)
+	})
+}
+
+func (r *SQLRepository) inTx(ctx context.Context, f func(*sql.Tx) error) error {
+	tx, err := r.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err := f(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,171 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/estambakio/go-fsm/internal/fakesql"
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// outboxTables understands statements of SQLStore and of orders table used in tests
+type outboxTables struct {
+	messages map[string][]driver.Value // key -> key, created, message
+	orders   map[string]string         // id -> status
+}
+
+func newOutboxTables() *outboxTables {
+	return &outboxTables{messages: make(map[string][]driver.Value), orders: make(map[string]string)}
+}
+
+func (t *outboxTables) Exec(query string, args []driver.Value) (func(), error) {
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE"):
+		return func() {}, nil
+	case strings.HasPrefix(query, "INSERT INTO"):
+		return func() { t.messages[args[0].(string)] = args }, nil
+	case strings.HasPrefix(query, "DELETE FROM"):
+		return func() { delete(t.messages, args[0].(string)) }, nil
+	case strings.HasPrefix(query, "UPDATE orders"):
+		if args[0] == "fail" {
+			return nil, errors.New("constraint violation")
+		}
+		return func() { t.orders[args[1].(string)] = args[0].(string) }, nil
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", query)
+	}
+}
+
+func (t *outboxTables) Query(query string, args []driver.Value) ([][]driver.Value, error) {
+	switch {
+	case strings.HasPrefix(query, "SELECT status FROM orders"):
+		status, ok := t.orders[args[0].(string)]
+		if !ok {
+			return nil, nil
+		}
+		return [][]driver.Value{{status}}, nil
+	case strings.HasPrefix(query, "SELECT message"):
+		var rows [][]driver.Value
+		for _, row := range t.messages {
+			rows = append(rows, row)
+		}
+		sort.Slice(rows, func(i, j int) bool {
+			if rows[i][1].(int64) == rows[j][1].(int64) {
+				return rows[i][0].(string) < rows[j][0].(string)
+			}
+			return rows[i][1].(int64) < rows[j][1].(int64)
+		})
+		var limit int
+		if _, err := fmt.Sscanf(query[strings.Index(query, "LIMIT")+1:], "IMIT %d", &limit); err == nil && limit < len(rows) {
+			rows = rows[:limit]
+		}
+		result := make([][]driver.Value, len(rows))
+		for i, row := range rows {
+			result[i] = []driver.Value{row[2]}
+		}
+		return result, nil
+	default:
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+}
+
+func TestSQLStore(t *testing.T) {
+	ctx := context.Background()
+	db, fake := fakesql.Open(t, newOutboxTables())
+
+	store := NewSQLStore(db, "outbox", DollarPlaceholder)
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	messages := []Message{{Key: "b", Time: now}, {Key: "a", Time: now}, {Key: "c", Time: now.Add(-1)}}
+	if err := store.Append(ctx, messages...); err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := store.Pending(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 2 || pending[0].Key != "c" || pending[1].Key != "a" || !pending[1].Time.Equal(now) {
+		t.Errorf("expected messages ordered by time and key, got %+v", pending)
+	}
+
+	if err := store.Ack(ctx, "c"); err != nil {
+		t.Fatal(err)
+	}
+	if pending, _ := store.Pending(ctx, 0); len(pending) != 2 || pending[0].Key != "a" {
+		t.Errorf("expected acked message to be removed, got %+v", pending)
+	}
+
+	for _, q := range fake.Queries() {
+		if !strings.Contains(q, "outbox") || strings.Contains(q, "?") || strings.Contains(q, "{") {
+			t.Errorf("statement is not rendered properly: %s", q)
+		}
+	}
+}
+
+func TestSQLRepository(t *testing.T) {
+	ctx := context.Background()
+	fake := newOutboxTables()
+	fake.orders["1"] = "new"
+	fake.orders["2"] = "new"
+	db, _ := fakesql.Open(t, fake)
+
+	store := NewSQLStore(db, "outbox", nil)
+	repo := &SQLRepository{
+		DB:    db,
+		Store: store,
+		LoadObject: func(ctx context.Context, db *sql.DB, id string) (core.Object, error) {
+			o := &order{id: id}
+			err := db.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = ?", id).Scan(&o.status)
+			if err == sql.ErrNoRows {
+				return nil, core.ErrObjectNotFound
+			}
+			return o, err
+		},
+		SaveObject: func(ctx context.Context, tx *sql.Tx, o core.Object) error {
+			status := o.Status()
+			if o.(*order).id == "2" {
+				status = "fail"
+			}
+			_, err := tx.ExecContext(ctx, "UPDATE orders SET status = ? WHERE id = ?", status, o.(*order).id)
+			return err
+		},
+	}
+	machine := newTestMachine(t, repo)
+
+	if _, _, err := machine.SendEventByID("1", "pay"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.orders["1"] != "paid" {
+		t.Errorf("expected object to be saved, got %s", fake.orders["1"])
+	}
+	pending, _ := store.Pending(ctx, 0)
+	if len(pending) != 1 || pending[0].ObjectID != "1" || pending[0].To != "paid" {
+		t.Errorf("expected message about transition, got %+v", pending)
+	}
+
+	// neither object nor message is saved if transaction fails
+	if _, _, err := machine.SendEventByID("2", "pay"); err == nil {
+		t.Error("expected error")
+	}
+	if pending, _ := store.Pending(ctx, 0); len(pending) != 1 || fake.orders["2"] != "new" {
+		t.Errorf("expected transaction to be rolled back, got %+v and status %s", pending, fake.orders["2"])
+	}
+
+	if _, _, err := machine.SendEventByID("3", "pay"); !errors.Is(err, core.ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+
+	// plain Save doesn't produce messages
+	if err := repo.Save(ctx, &order{id: "1", status: "new"}); err != nil || fake.orders["1"] != "new" {
+		t.Errorf("expected object to be saved, got %v", err)
+	}
+}
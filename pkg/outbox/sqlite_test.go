@@ -0,0 +1,91 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// openSQLite returns database in temporary file, test is skipped if driver is built without cgo
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", t.TempDir()+"/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Skipf("sqlite3 isn't available: %v", err)
+	}
+	return db
+}
+
+func TestSQLRepository_sqlite(t *testing.T) {
+	ctx := context.Background()
+	db := openSQLite(t)
+
+	// order 2 can't leave state "new", so that its transaction fails
+	_, err := db.ExecContext(ctx, `CREATE TABLE orders (
+	id TEXT PRIMARY KEY,
+	status TEXT NOT NULL CHECK (id <> '2' OR status = 'new')
+)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO orders VALUES ('1', 'new'), ('2', 'new')"); err != nil {
+		t.Fatal(err)
+	}
+	store := NewSQLStore(db, "outbox", QuestionPlaceholder)
+	if err := store.CreateTable(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &SQLRepository{
+		DB:    db,
+		Store: store,
+		LoadObject: func(ctx context.Context, db *sql.DB, id string) (core.Object, error) {
+			o := &order{id: id}
+			err := db.QueryRowContext(ctx, "SELECT status FROM orders WHERE id = ?", id).Scan(&o.status)
+			if err == sql.ErrNoRows {
+				return nil, core.ErrObjectNotFound
+			}
+			return o, err
+		},
+		SaveObject: func(ctx context.Context, tx *sql.Tx, o core.Object) error {
+			_, err := tx.ExecContext(ctx, "UPDATE orders SET status = ? WHERE id = ?", o.Status(), o.(*order).id)
+			return err
+		},
+	}
+	machine := newTestMachine(t, repo)
+
+	if _, _, err := machine.SendEventByID("1", "pay"); err != nil {
+		t.Fatal(err)
+	}
+	if o, err := repo.Load(ctx, "1"); err != nil || o.Status() != "paid" {
+		t.Errorf("expected object to be saved, got %v, %v", o, err)
+	}
+
+	if _, _, err := machine.SendEventByID("2", "pay"); err == nil {
+		t.Error("expected constraint violation")
+	}
+	if o, err := repo.Load(ctx, "2"); err != nil || o.Status() != "new" {
+		t.Errorf("expected transaction to be rolled back, got %v, %v", o, err)
+	}
+
+	// messages survive reopening of store
+	pending, err := NewSQLStore(db, "outbox", nil).Pending(ctx, 0)
+	if err != nil || len(pending) != 1 || pending[0].ObjectID != "1" || pending[0].To != "paid" || !pending[0].Time.Equal(now) {
+		t.Errorf("expected single message about transition of object 1, got %+v, %v", pending, err)
+	}
+	if err := store.Ack(ctx, pending[0].Key); err != nil {
+		t.Fatal(err)
+	}
+	if pending, err := store.Pending(ctx, 0); err != nil || len(pending) != 0 {
+		t.Errorf("expected no messages after ack, got %+v, %v", pending, err)
+	}
+}
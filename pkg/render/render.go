@@ -0,0 +1,241 @@
+// Package render draws core.Schema as Graphviz DOT, Mermaid or SVG diagrams.
+//
+// Choices are drawn as diamonds, transitions from AnyState start at a separate "any state" node,
+// internal transitions are drawn as dotted self-loops, entry and exit actions and timers are listed
+// in labels of states.
+package render
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// anyStateNode is an identifier of node for transitions from core.AnyState
+const anyStateNode = "any"
+
+// graph assigns stable identifiers to states and choices, so that names don't need escaping
+type graph struct {
+	schema core.Schema
+	ids    map[string]string
+	final  map[string]bool
+	choice map[string]bool
+}
+
+func newGraph(schema core.Schema) *graph {
+	g := &graph{
+		schema: schema,
+		ids:    map[string]string{},
+		final:  map[string]bool{},
+		choice: map[string]bool{},
+	}
+	for i, s := range schema.States {
+		g.ids[s.Name] = fmt.Sprintf("s%d", i)
+	}
+	for i, c := range schema.Choices {
+		g.ids[c.Name] = fmt.Sprintf("c%d", i)
+		g.choice[c.Name] = true
+	}
+	for _, s := range schema.FinalStates {
+		g.final[s.Name] = true
+	}
+	return g
+}
+
+func (g *graph) id(name string) string {
+	if name == core.AnyState {
+		return anyStateNode
+	}
+	return g.ids[name]
+}
+
+// stateLabel returns lines of label of state: its name followed by entry and exit actions and timers
+func (g *graph) stateLabel(name string) []string {
+	lines := []string{name}
+	for _, sa := range g.schema.StateActions {
+		if sa.State != name {
+			continue
+		}
+		if len(sa.OnEntry) > 0 {
+			lines = append(lines, "entry / "+actions(sa.OnEntry))
+		}
+		if len(sa.OnExit) > 0 {
+			lines = append(lines, "exit / "+actions(sa.OnExit))
+		}
+	}
+	for _, tm := range g.schema.Timers {
+		if tm.State == name {
+			lines = append(lines, fmt.Sprintf("after %s: %s", tm.After, tm.Event))
+		}
+	}
+	return lines
+}
+
+// edge is a line of diagram
+type edge struct {
+	from, to string
+	label    string
+	internal bool
+	branch   bool
+}
+
+func (g *graph) edges() []edge {
+	var edges []edge
+	for _, t := range g.schema.Transitions {
+		label := string(t.Event)
+		if len(t.Guards) > 0 {
+			label += " [" + guards(t.Guards) + "]"
+		}
+		for _, from := range t.Sources() {
+			if t.Internal {
+				edges = append(edges, edge{from: g.id(from), to: g.id(from), label: label + " (internal)", internal: true})
+				continue
+			}
+			edges = append(edges, edge{from: g.id(from), to: g.id(t.To), label: label})
+		}
+	}
+	for _, c := range g.schema.Choices {
+		for _, b := range c.Branches {
+			edges = append(edges, edge{from: g.id(c.Name), to: g.id(b.To), label: "[" + guards(b.Guards) + "]", branch: true})
+		}
+		if c.Else != "" {
+			edges = append(edges, edge{from: g.id(c.Name), to: g.id(c.Else), label: "[else]", branch: true})
+		}
+	}
+	return edges
+}
+
+func (g *graph) hasAnyState() bool {
+	for _, t := range g.schema.Transitions {
+		if t.From == core.AnyState {
+			return true
+		}
+	}
+	return false
+}
+
+func actions(defs []core.ActionDefinition) string {
+	names := make([]string, len(defs))
+	for i, a := range defs {
+		names[i] = a.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func guards(gs []core.Guard) string {
+	names := make([]string, len(gs))
+	for i, g := range gs {
+		names[i] = g.Name
+		if g.Negate {
+			names[i] = "!" + g.Name
+		}
+	}
+	return strings.Join(names, " && ")
+}
+
+// DOT returns Graphviz DOT representation of schema
+func DOT(schema core.Schema) string {
+	g := newGraph(schema)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n", schema.Name)
+	b.WriteString("\trankdir=LR;\n")
+	b.WriteString("\tinitial [shape=point];\n")
+
+	for _, s := range schema.States {
+		shape := "ellipse"
+		if g.final[s.Name] {
+			shape = "doublecircle"
+		}
+		fmt.Fprintf(&b, "\t%s [label=%q, shape=%s];\n", g.id(s.Name), strings.Join(g.stateLabel(s.Name), "\n"), shape)
+	}
+	for _, c := range schema.Choices {
+		fmt.Fprintf(&b, "\t%s [label=%q, shape=diamond];\n", g.id(c.Name), c.Name)
+	}
+	if g.hasAnyState() {
+		fmt.Fprintf(&b, "\t%s [label=\"any state\", shape=box, style=dashed];\n", anyStateNode)
+	}
+
+	if schema.InitialState.Name != "" {
+		fmt.Fprintf(&b, "\tinitial -> %s;\n", g.id(schema.InitialState.Name))
+	}
+	for _, e := range g.edges() {
+		attrs := fmt.Sprintf("label=%q", e.label)
+		if e.internal {
+			attrs += ", style=dotted"
+		}
+		if e.branch {
+			attrs += ", style=dashed"
+		}
+		fmt.Fprintf(&b, "\t%s -> %s [%s];\n", e.from, e.to, attrs)
+	}
+
+	b.WriteString("}\n")
+	return b.String()
+}
+
+// Mermaid returns Mermaid state diagram representation of schema
+func Mermaid(schema core.Schema) string {
+	g := newGraph(schema)
+
+	var b strings.Builder
+	b.WriteString("stateDiagram-v2\n")
+
+	for _, s := range schema.States {
+		lines := g.stateLabel(s.Name)
+		for i, line := range lines {
+			lines[i] = mermaidEscaper.Replace(line)
+		}
+		fmt.Fprintf(&b, "\tstate \"%s\" as %s\n", strings.Join(lines, "<br/>"), g.id(s.Name))
+	}
+	for _, c := range schema.Choices {
+		fmt.Fprintf(&b, "\tstate %s <<choice>>\n", g.id(c.Name))
+	}
+	if g.hasAnyState() {
+		fmt.Fprintf(&b, "\tstate \"any state\" as %s\n", anyStateNode)
+	}
+
+	if schema.InitialState.Name != "" {
+		fmt.Fprintf(&b, "\t[*] --> %s\n", g.id(schema.InitialState.Name))
+	}
+	for _, e := range g.edges() {
+		fmt.Fprintf(&b, "\t%s --> %s : %s\n", e.from, e.to, mermaidEscaper.Replace(e.label))
+	}
+	for _, s := range schema.FinalStates {
+		fmt.Fprintf(&b, "\t%s --> [*]\n", g.id(s.Name))
+	}
+	return b.String()
+}
+
+// mermaidEscaper replaces characters which are a part of Mermaid syntax with entity codes:
+// quote ends name of state, colon starts label of transition, angle brackets are HTML in labels
+var mermaidEscaper = strings.NewReplacer(
+	"#", "#35;",
+	`"`, "#quot;",
+	":", "#58;",
+	";", "#59;",
+	"<", "#lt;",
+	">", "#gt;",
+)
+
+// SVG renders schema with Graphviz "dot" command, which must be installed
+func SVG(ctx context.Context, schema core.Schema) ([]byte, error) {
+	path, err := exec.LookPath("dot")
+	if err != nil {
+		return nil, fmt.Errorf("SVG rendering requires Graphviz: %w", err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, "-Tsvg")
+	cmd.Stdin = strings.NewReader(DOT(schema))
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("dot failed: %w: %s", err, stderr.String())
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,108 @@
+package render
+
+import (
+	"bytes"
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+var schema = core.Schema{
+	Name:         "order",
+	InitialState: core.State{Name: "new"},
+	FinalStates:  []core.State{{Name: "done"}, {Name: "cancelled"}},
+	States:       []core.State{{Name: "new"}, {Name: "review"}, {Name: "done"}, {Name: "cancelled"}},
+	Transitions: []core.Transition{
+		{From: "new", To: "check", Event: "submit"},
+		{From: "review", To: "done", Event: "approve", Guards: []core.Guard{{Name: "isManager"}, {Name: "isBlocked", Negate: true}}},
+		{From: "review", Event: "comment", Internal: true},
+		{From: core.AnyState, To: "cancelled", Event: "cancel"},
+	},
+	Choices: []core.Choice{
+		{Name: "check", Branches: []core.Branch{{To: "review", Guards: []core.Guard{{Name: "large"}}}}, Else: "done"},
+	},
+	StateActions: []core.StateActions{
+		{State: "review", OnEntry: []core.ActionDefinition{{Name: "notify"}, {Name: "lock"}}, OnExit: []core.ActionDefinition{{Name: "unlock"}}},
+	},
+	Timers: []core.Timer{{State: "review", After: time.Hour, Event: "cancel"}},
+}
+
+func TestDOT(t *testing.T) {
+	dot := DOT(schema)
+
+	for _, line := range []string{
+		`digraph "order" {`,
+		`initial -> s0;`,
+		`s0 [label="new", shape=ellipse];`,
+		`s1 [label="review\nentry / notify, lock\nexit / unlock\nafter 1h0m0s: cancel", shape=ellipse];`,
+		`s2 [label="done", shape=doublecircle];`,
+		`c0 [label="check", shape=diamond];`,
+		`any [label="any state", shape=box, style=dashed];`,
+		`s0 -> c0 [label="submit"];`,
+		`s1 -> s2 [label="approve [isManager && !isBlocked]"];`,
+		`s1 -> s1 [label="comment (internal)", style=dotted];`,
+		`any -> s3 [label="cancel"];`,
+		`c0 -> s1 [label="[large]", style=dashed];`,
+		`c0 -> s2 [label="[else]", style=dashed];`,
+	} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("expected DOT to contain %s, got:\n%s", line, dot)
+		}
+	}
+}
+
+func TestMermaid(t *testing.T) {
+	mermaid := Mermaid(schema)
+
+	if !strings.HasPrefix(mermaid, "stateDiagram-v2\n") {
+		t.Errorf("expected state diagram, got:\n%s", mermaid)
+	}
+	for _, line := range []string{
+		`state "review<br/>entry / notify, lock<br/>exit / unlock<br/>after 1h0m0s#58; cancel" as s1`,
+		`state c0 <<choice>>`,
+		`state "any state" as any`,
+		`[*] --> s0`,
+		`s1 --> s2 : approve [isManager && !isBlocked]`,
+		`s1 --> s1 : comment (internal)`,
+		`c0 --> s2 : [else]`,
+		`s2 --> [*]`,
+	} {
+		if !strings.Contains(mermaid, line) {
+			t.Errorf("expected Mermaid to contain %s, got:\n%s", line, mermaid)
+		}
+	}
+}
+
+func TestMermaid_escaping(t *testing.T) {
+	mermaid := Mermaid(core.Schema{
+		States:      []core.State{{Name: `say "hi"`}, {Name: "a:b"}},
+		Transitions: []core.Transition{{From: `say "hi"`, To: "a:b", Event: "go", Guards: []core.Guard{{Name: "x<y"}}}},
+	})
+	for _, line := range []string{
+		`state "say #quot;hi#quot;" as s0`,
+		`state "a#58;b" as s1`,
+		`s0 --> s1 : go [x#lt;y]`,
+	} {
+		if !strings.Contains(mermaid, line) {
+			t.Errorf("expected Mermaid to contain %s, got:\n%s", line, mermaid)
+		}
+	}
+}
+
+func TestSVG(t *testing.T) {
+	if _, err := exec.LookPath("dot"); err != nil {
+		t.Skip("Graphviz is not installed")
+	}
+
+	svg, err := SVG(context.Background(), schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(svg, []byte("<svg")) {
+		t.Errorf("expected SVG document, got:\n%s", svg)
+	}
+}
@@ -0,0 +1,259 @@
+// Package schedule provides durable implementations of core.ScheduleStore, which keep pending transitions
+// of asynchronous actions as well, see core.PendingStore.
+package schedule
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// FileStore keeps scheduled events and pending transitions in a JSON file. The whole file is rewritten atomically
+// on every change, so it's suitable for moderate amount of pending events in a single process.
+type FileStore struct {
+	path string
+
+	mu     sync.Mutex
+	events map[string]core.ScheduledEvent
+	// transitions are pending transitions by token
+	transitions map[string]pendingRecord
+}
+
+// fileContent is a content of store's file
+type fileContent struct {
+	Events      []core.ScheduledEvent
+	Transitions []pendingRecord `json:",omitempty"`
+}
+
+// NewFileStore opens store at provided path, reading pending events if file exists.
+// File which contains only a list of events, as written by previous versions, is accepted too.
+func NewFileStore(path string) (*FileStore, error) {
+	s := &FileStore{
+		path:        path,
+		events:      make(map[string]core.ScheduledEvent),
+		transitions: make(map[string]pendingRecord),
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var content fileContent
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("[")) {
+		err = json.Unmarshal(data, &content.Events)
+	} else {
+		err = json.Unmarshal(data, &content)
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, ev := range content.Events {
+		s.events[ev.ID] = ev
+	}
+	for _, r := range content.Transitions {
+		s.transitions[r.Token] = r
+	}
+	return s, nil
+}
+
+// Schedule implements core.ScheduleStore
+func (s *FileStore) Schedule(ctx context.Context, events ...core.ScheduledEvent) error {
+	return s.update(func(pending map[string]core.ScheduledEvent, _ map[string]pendingRecord) error {
+		for _, ev := range events {
+			pending[ev.ID] = ev
+		}
+		return nil
+	})
+}
+
+// Cancel implements core.ScheduleStore
+func (s *FileStore) Cancel(ctx context.Context, objectID string, keep ...string) error {
+	kept := make(map[string]bool, len(keep))
+	for _, id := range keep {
+		kept[id] = true
+	}
+	return s.update(func(pending map[string]core.ScheduledEvent, _ map[string]pendingRecord) error {
+		for id, ev := range pending {
+			if ev.ObjectID == objectID && !kept[id] {
+				delete(pending, id)
+			}
+		}
+		return nil
+	})
+}
+
+// Done implements core.ScheduleStore
+func (s *FileStore) Done(ctx context.Context, id string) error {
+	return s.update(func(pending map[string]core.ScheduledEvent, _ map[string]pendingRecord) error {
+		delete(pending, id)
+		return nil
+	})
+}
+
+// Due implements core.ScheduleStore
+func (s *FileStore) Due(ctx context.Context, now time.Time) ([]core.ScheduledEvent, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []core.ScheduledEvent
+	for _, ev := range s.events {
+		if !ev.Due.After(now) {
+			due = append(due, ev)
+		}
+	}
+	sortEvents(due)
+	return due, nil
+}
+
+// AddPending implements core.PendingStore
+func (s *FileStore) AddPending(ctx context.Context, p core.PendingTransition) error {
+	record, err := newPendingRecord(p)
+	if err != nil {
+		return err
+	}
+	return s.update(func(_ map[string]core.ScheduledEvent, transitions map[string]pendingRecord) error {
+		if _, ok := transitions[p.Token]; ok {
+			return fmt.Errorf("token %s is used by another pending transition", p.Token)
+		}
+		for _, other := range transitions {
+			if other.ObjectID == p.ObjectID {
+				return fmt.Errorf("%w: object %s, token %s", core.ErrInFlight, p.ObjectID, other.Token)
+			}
+		}
+		transitions[p.Token] = record
+		return nil
+	})
+}
+
+// TakePending implements core.PendingStore
+func (s *FileStore) TakePending(ctx context.Context, token string) (core.PendingTransition, error) {
+	var taken pendingRecord
+	err := s.update(func(_ map[string]core.ScheduledEvent, transitions map[string]pendingRecord) error {
+		var ok bool
+		if taken, ok = transitions[token]; !ok {
+			return fmt.Errorf("%w: token %s", core.ErrPendingNotFound, token)
+		}
+		delete(transitions, token)
+		return nil
+	})
+	if err != nil {
+		return core.PendingTransition{}, err
+	}
+	return taken.transition()
+}
+
+// PendingOf implements core.PendingStore
+func (s *FileStore) PendingOf(ctx context.Context, objectID string) (core.PendingTransition, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.transitions {
+		if r.ObjectID == objectID {
+			p, err := r.transition()
+			return p, err == nil, err
+		}
+	}
+	return core.PendingTransition{}, false, nil
+}
+
+// ListPending implements core.PendingStore
+func (s *FileStore) ListPending(ctx context.Context) ([]core.PendingTransition, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := make([]core.PendingTransition, 0, len(s.transitions))
+	for _, r := range s.transitions {
+		p, err := r.transition()
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	core.SortPending(pending)
+	return pending, nil
+}
+
+// update applies change to copies of pending events and transitions and replaces file with the result.
+// In-memory state is updated only if change succeeds and file is written successfully.
+func (s *FileStore) update(change func(map[string]core.ScheduledEvent, map[string]pendingRecord) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := make(map[string]core.ScheduledEvent, len(s.events))
+	for id, ev := range s.events {
+		pending[id] = ev
+	}
+	transitions := make(map[string]pendingRecord, len(s.transitions))
+	for token, r := range s.transitions {
+		transitions[token] = r
+	}
+	if err := change(pending, transitions); err != nil {
+		return err
+	}
+
+	content := fileContent{Events: make([]core.ScheduledEvent, 0, len(pending))}
+	for _, ev := range pending {
+		content.Events = append(content.Events, ev)
+	}
+	sortEvents(content.Events)
+	for _, r := range transitions {
+		content.Transitions = append(content.Transitions, r)
+	}
+	sort.Slice(content.Transitions, func(i, j int) bool { return content.Transitions[i].Token < content.Transitions[j].Token })
+
+	if err := writeFileAtomic(s.path, content); err != nil {
+		return err
+	}
+	s.events, s.transitions = pending, transitions
+	return nil
+}
+
+// writeFileAtomic writes value as JSON to temporary file and renames it to path,
+// so that file is never left partially written
+func writeFileAtomic(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// sortEvents orders events by due time and then by ID to make order deterministic
+func sortEvents(events []core.ScheduledEvent) {
+	sort.Slice(events, func(i, j int) bool {
+		if events[i].Due.Equal(events[j].Due) {
+			return events[i].ID < events[j].ID
+		}
+		return events[i].Due.Before(events[j].Due)
+	})
+}
@@ -0,0 +1,61 @@
+package schedule
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := os.MkdirTemp("", "schedule")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "events.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, store, func() core.ScheduleStore {
+		store, err := NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+
+	testPendingStore(t, store, func() core.PendingStore {
+		store, err := NewFileStore(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	})
+
+	// file written by previous versions contains only events
+	if err := os.WriteFile(path, []byte(`[{"ID": "a1", "ObjectID": "a", "State": "s", "Event": "go", "Due": "2020-01-01T00:00:00Z"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if due, err := store.Due(context.Background(), time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)); err != nil || len(due) != 1 || due[0].ID != "a1" {
+		t.Errorf("expected event from list, got %v, %v", due, err)
+	}
+
+	if err := os.WriteFile(path, []byte("not json"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewFileStore(path); err == nil {
+		t.Error("expected error for corrupted file")
+	}
+}
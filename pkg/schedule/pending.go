@@ -0,0 +1,84 @@
+package schedule
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// pendingRecord is a stored core.PendingTransition, outputs of actions are encoded as JSON
+type pendingRecord struct {
+	Token    string
+	ObjectID string
+	Event    core.Event
+	From     string
+	To       string
+	Action   string
+	Since    time.Time
+	Deadline time.Time
+	Results  []resultRecord
+	Resume   string
+}
+
+// resultRecord is a result of action performed before pending one. Such results don't have errors,
+// otherwise transition wouldn't be suspended.
+type resultRecord struct {
+	Name     string
+	Output   json.RawMessage `json:",omitempty"`
+	Attempts int             `json:",omitempty"`
+	Pending  bool            `json:",omitempty"`
+	Token    string          `json:",omitempty"`
+}
+
+func newPendingRecord(p core.PendingTransition) (pendingRecord, error) {
+	r := pendingRecord{
+		Token:    p.Token,
+		ObjectID: p.ObjectID,
+		Event:    p.Event,
+		From:     p.From,
+		To:       p.To,
+		Action:   p.Action,
+		Since:    p.Since,
+		Deadline: p.Deadline,
+		Resume:   p.Resume,
+	}
+	for _, result := range p.Results {
+		rr := resultRecord{Name: result.Name, Attempts: result.Attempts, Pending: result.Pending, Token: result.Token}
+		if result.Output != nil {
+			output, err := json.Marshal(result.Output)
+			if err != nil {
+				return pendingRecord{}, fmt.Errorf("output of action %s can't be encoded: %w", result.Name, err)
+			}
+			rr.Output = output
+		}
+		r.Results = append(r.Results, rr)
+	}
+	return r, nil
+}
+
+// transition returns pending transition, outputs of actions are decoded into generic values as by json.Unmarshal
+func (r pendingRecord) transition() (core.PendingTransition, error) {
+	p := core.PendingTransition{
+		Token:    r.Token,
+		ObjectID: r.ObjectID,
+		Event:    r.Event,
+		From:     r.From,
+		To:       r.To,
+		Action:   r.Action,
+		Since:    r.Since,
+		Deadline: r.Deadline,
+		Resume:   r.Resume,
+	}
+	for _, rr := range r.Results {
+		result := core.ActionResult{Name: rr.Name, Attempts: rr.Attempts, Pending: rr.Pending, Token: rr.Token}
+		if len(rr.Output) > 0 {
+			if err := json.Unmarshal(rr.Output, &result.Output); err != nil {
+				return core.PendingTransition{}, fmt.Errorf("output of action %s can't be decoded: %w", rr.Name, err)
+			}
+		}
+		p.Results = append(p.Results, result)
+	}
+	return p, nil
+}
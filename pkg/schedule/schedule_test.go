@@ -0,0 +1,150 @@
+package schedule
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// testStore checks behaviour common for all implementations of core.ScheduleStore.
+// Reopen should return a new instance of store backed by the same storage.
+func testStore(t *testing.T, store core.ScheduleStore, reopen func() core.ScheduleStore) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+
+	err := store.Schedule(ctx,
+		core.ScheduledEvent{ID: "a1", ObjectID: "a", State: "s", Event: "late", Due: now.Add(time.Hour)},
+		core.ScheduledEvent{ID: "a2", ObjectID: "a", State: "s", Event: "early", Due: now.Add(time.Minute)},
+		core.ScheduledEvent{ID: "b1", ObjectID: "b", State: "s", Event: "early", Due: now.Add(time.Minute)},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due, err := store.Due(ctx, now)
+	if err != nil || len(due) != 0 {
+		t.Errorf("expected no due events, got %v, %v", due, err)
+	}
+
+	// replacing event with the same ID
+	err = store.Schedule(ctx, core.ScheduledEvent{ID: "b1", ObjectID: "b", State: "s", Event: "early", Due: now.Add(2 * time.Minute)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store = reopen()
+
+	due, err = store.Due(ctx, now.Add(time.Hour))
+	if err != nil || len(due) != 3 || due[0].ID != "a2" || due[1].ID != "b1" || due[2].ID != "a1" {
+		t.Fatalf("expected 3 due events ordered by due time, got %v, %v", due, err)
+	}
+	if due[1].ObjectID != "b" || due[1].State != "s" || due[1].Event != "early" || !due[1].Due.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("event wasn't restored correctly: %v", due[1])
+	}
+
+	// kept event survives cancellation
+	if err := store.Cancel(ctx, "a", "a2"); err != nil {
+		t.Fatal(err)
+	}
+	due, err = store.Due(ctx, now.Add(time.Hour))
+	if err != nil || len(due) != 2 || due[0].ID != "a2" || due[1].ID != "b1" {
+		t.Fatalf("expected event 'a2' to be kept, got %v, %v", due, err)
+	}
+
+	if err := store.Cancel(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Done(ctx, "unknown"); err != nil {
+		t.Errorf("expected Done of unknown event to succeed, got %v", err)
+	}
+
+	store = reopen()
+
+	due, err = store.Due(ctx, now.Add(time.Hour))
+	if err != nil || len(due) != 1 || due[0].ID != "b1" {
+		t.Fatalf("expected only event of object 'b' to remain, got %v, %v", due, err)
+	}
+
+	if err := store.Done(ctx, "b1"); err != nil {
+		t.Fatal(err)
+	}
+
+	due, err = reopen().Due(ctx, now.Add(time.Hour))
+	if err != nil || len(due) != 0 {
+		t.Errorf("expected no events, got %v, %v", due, err)
+	}
+}
+
+// testPendingStore checks behaviour common for all implementations of core.PendingStore.
+// Reopen should return a new instance of store backed by the same storage.
+func testPendingStore(t *testing.T, store core.PendingStore, reopen func() core.PendingStore) {
+	ctx := context.Background()
+	now := time.Unix(1000, 0)
+
+	first := core.PendingTransition{
+		Token: "t1", ObjectID: "a", Event: "sign", From: "draft", To: "signed", Action: "sign",
+		Since: now, Deadline: now.Add(time.Hour), Resume: "0.-1.1.2",
+		Results: []core.ActionResult{
+			{Name: "prepare", Output: map[string]interface{}{"pages": float64(2)}, Attempts: 1},
+			{Name: "sign", Pending: true, Token: "t1"},
+		},
+	}
+	second := core.PendingTransition{Token: "t0", ObjectID: "b", Event: "approve", From: "new", To: "approved", Action: "approve", Since: now,
+		Results: []core.ActionResult{{Name: "approve", Pending: true, Token: "t0"}}}
+	if err := store.AddPending(ctx, first); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddPending(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.AddPending(ctx, core.PendingTransition{Token: "t2", ObjectID: "a"}); !errors.Is(err, core.ErrInFlight) {
+		t.Errorf("expected object to be in flight, got %v", err)
+	}
+	if err := store.AddPending(ctx, core.PendingTransition{Token: "t1", ObjectID: "c"}); err == nil || errors.Is(err, core.ErrInFlight) {
+		t.Errorf("expected error for token which is used, got %v", err)
+	}
+
+	store = reopen()
+
+	p, ok, err := store.PendingOf(ctx, "a")
+	if err != nil || !ok || !equalPending(p, first) {
+		t.Errorf("expected %+v, got %+v, %v", first, p, err)
+	}
+	if _, ok, err := store.PendingOf(ctx, "c"); err != nil || ok {
+		t.Errorf("expected no pending transition of object c, got %v", err)
+	}
+	all, err := store.ListPending(ctx)
+	if err != nil || len(all) != 2 || !equalPending(all[0], second) || !equalPending(all[1], first) {
+		t.Errorf("expected transitions ordered by time and token, got %+v, %v", all, err)
+	}
+
+	p, err = store.TakePending(ctx, "t1")
+	if err != nil || !equalPending(p, first) {
+		t.Errorf("expected %+v, got %+v, %v", first, p, err)
+	}
+	if _, err := store.TakePending(ctx, "t1"); !errors.Is(err, core.ErrPendingNotFound) {
+		t.Errorf("expected taken transition not to be found, got %v", err)
+	}
+
+	store = reopen()
+
+	if all, err := store.ListPending(ctx); err != nil || len(all) != 1 || all[0].Token != "t0" || !all[0].Deadline.IsZero() {
+		t.Errorf("expected only transition of object b to remain, got %+v, %v", all, err)
+	}
+	if err := store.AddPending(ctx, core.PendingTransition{Token: "t2", ObjectID: "a", Since: now}); err != nil {
+		t.Errorf("expected object to accept pending transition after previous one is taken, got %v", err)
+	}
+}
+
+// equalPending compares transitions ignoring location of times
+func equalPending(a, b core.PendingTransition) bool {
+	if !a.Since.Equal(b.Since) || !a.Deadline.Equal(b.Deadline) {
+		return false
+	}
+	a.Since, a.Deadline, b.Since, b.Deadline = time.Time{}, time.Time{}, time.Time{}, time.Time{}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,283 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/estambakio/go-fsm/internal/sqlquery"
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// Placeholder returns bind parameter for n-th (starting from 1) argument of SQL statement
+type Placeholder = sqlquery.Placeholder
+
+// QuestionPlaceholder is used by MySQL and SQLite
+func QuestionPlaceholder(n int) string {
+	return sqlquery.Question(n)
+}
+
+// DollarPlaceholder is used by PostgreSQL
+func DollarPlaceholder(n int) string {
+	return sqlquery.Dollar(n)
+}
+
+// SQLStore keeps scheduled events in SQL table and pending transitions in table with suffix "_pending".
+// Times are stored as Unix time in nanoseconds, outputs of actions performed before pending one are stored as JSON.
+type SQLStore struct {
+	db          *sql.DB
+	table       string
+	placeholder Placeholder
+}
+
+// NewSQLStore returns store which uses provided table. Placeholder defaults to QuestionPlaceholder if nil.
+func NewSQLStore(db *sql.DB, table string, placeholder Placeholder) *SQLStore {
+	if placeholder == nil {
+		placeholder = QuestionPlaceholder
+	}
+	return &SQLStore{db: db, table: table, placeholder: placeholder}
+}
+
+// CreateTable creates tables for scheduled events and pending transitions if they don't exist
+func (s *SQLStore) CreateTable(ctx context.Context) error {
+	_, err := s.db.ExecContext(ctx, s.query(`CREATE TABLE IF NOT EXISTS {table} (
+	id VARCHAR(255) PRIMARY KEY,
+	object_id VARCHAR(255) NOT NULL,
+	state VARCHAR(255) NOT NULL,
+	event VARCHAR(255) NOT NULL,
+	due BIGINT NOT NULL
+)`))
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, s.query(`CREATE TABLE IF NOT EXISTS {table}_pending (
+	token VARCHAR(255) PRIMARY KEY,
+	object_id VARCHAR(255) NOT NULL UNIQUE,
+	event VARCHAR(255) NOT NULL,
+	from_state VARCHAR(255) NOT NULL,
+	to_state VARCHAR(255) NOT NULL,
+	action VARCHAR(255) NOT NULL,
+	since BIGINT NOT NULL,
+	deadline BIGINT NOT NULL,
+	results TEXT NOT NULL,
+	resume VARCHAR(255) NOT NULL
+)`))
+	return err
+}
+
+// Schedule implements core.ScheduleStore
+func (s *SQLStore) Schedule(ctx context.Context, events ...core.ScheduledEvent) (err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	for _, ev := range events {
+		if _, err = tx.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE id = {1}`), ev.ID); err != nil {
+			return err
+		}
+		_, err = tx.ExecContext(ctx,
+			s.query(`INSERT INTO {table} (id, object_id, state, event, due) VALUES ({1}, {2}, {3}, {4}, {5})`),
+			ev.ID, ev.ObjectID, ev.State, string(ev.Event), ev.Due.UnixNano(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// Cancel implements core.ScheduleStore
+func (s *SQLStore) Cancel(ctx context.Context, objectID string, keep ...string) error {
+	statement := `DELETE FROM {table} WHERE object_id = {1}`
+	args := []interface{}{objectID}
+	for _, id := range keep {
+		args = append(args, id)
+		statement += fmt.Sprintf(" AND id <> %s", s.placeholder(len(args)))
+	}
+	_, err := s.db.ExecContext(ctx, s.query(statement), args...)
+	return err
+}
+
+// Done implements core.ScheduleStore
+func (s *SQLStore) Done(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, s.query(`DELETE FROM {table} WHERE id = {1}`), id)
+	return err
+}
+
+// Due implements core.ScheduleStore
+func (s *SQLStore) Due(ctx context.Context, now time.Time) ([]core.ScheduledEvent, error) {
+	rows, err := s.db.QueryContext(ctx,
+		s.query(`SELECT id, object_id, state, event, due FROM {table} WHERE due <= {1} ORDER BY due, id`),
+		now.UnixNano(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []core.ScheduledEvent
+	for rows.Next() {
+		var ev core.ScheduledEvent
+		var event string
+		var due int64
+		if err := rows.Scan(&ev.ID, &ev.ObjectID, &ev.State, &event, &due); err != nil {
+			return nil, err
+		}
+		ev.Event = core.Event(event)
+		ev.Due = time.Unix(0, due)
+		events = append(events, ev)
+	}
+	return events, rows.Err()
+}
+
+// pendingColumns are columns of pending transitions in order of scanPending
+const pendingColumns = `token, object_id, event, from_state, to_state, action, since, deadline, results, resume`
+
+// AddPending implements core.PendingStore
+func (s *SQLStore) AddPending(ctx context.Context, p core.PendingTransition) (err error) {
+	record, err := newPendingRecord(p)
+	if err != nil {
+		return err
+	}
+	results, err := json.Marshal(record.Results)
+	if err != nil {
+		return err
+	}
+	var deadline int64
+	if !p.Deadline.IsZero() {
+		deadline = p.Deadline.UnixNano()
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var token string
+	err = tx.QueryRowContext(ctx, s.query(`SELECT token FROM {table}_pending WHERE object_id = {1}`), p.ObjectID).Scan(&token)
+	if err == nil {
+		return fmt.Errorf("%w: object %s, token %s", core.ErrInFlight, p.ObjectID, token)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	err = tx.QueryRowContext(ctx, s.query(`SELECT token FROM {table}_pending WHERE token = {1}`), p.Token).Scan(&token)
+	if err == nil {
+		return fmt.Errorf("token %s is used by another pending transition", p.Token)
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx,
+		s.query(`INSERT INTO {table}_pending (`+pendingColumns+`) VALUES ({1}, {2}, {3}, {4}, {5}, {6}, {7}, {8}, {9}, {10})`),
+		p.Token, p.ObjectID, string(p.Event), p.From, p.To, p.Action, p.Since.UnixNano(), deadline, string(results), p.Resume,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// TakePending implements core.PendingStore
+func (s *SQLStore) TakePending(ctx context.Context, token string) (p core.PendingTransition, err error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return core.PendingTransition{}, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+
+	p, err = scanPending(tx.QueryRowContext(ctx, s.query(`SELECT `+pendingColumns+` FROM {table}_pending WHERE token = {1}`), token))
+	if errors.Is(err, sql.ErrNoRows) {
+		return core.PendingTransition{}, fmt.Errorf("%w: token %s", core.ErrPendingNotFound, token)
+	}
+	if err != nil {
+		return core.PendingTransition{}, err
+	}
+
+	// transition can be taken concurrently by another process
+	res, err := tx.ExecContext(ctx, s.query(`DELETE FROM {table}_pending WHERE token = {1}`), token)
+	if err != nil {
+		return core.PendingTransition{}, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return core.PendingTransition{}, fmt.Errorf("%w: token %s", core.ErrPendingNotFound, token)
+	}
+	return p, tx.Commit()
+}
+
+// PendingOf implements core.PendingStore
+func (s *SQLStore) PendingOf(ctx context.Context, objectID string) (core.PendingTransition, bool, error) {
+	p, err := scanPending(s.db.QueryRowContext(ctx, s.query(`SELECT `+pendingColumns+` FROM {table}_pending WHERE object_id = {1}`), objectID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return core.PendingTransition{}, false, nil
+	}
+	return p, err == nil, err
+}
+
+// ListPending implements core.PendingStore
+func (s *SQLStore) ListPending(ctx context.Context) ([]core.PendingTransition, error) {
+	rows, err := s.db.QueryContext(ctx, s.query(`SELECT `+pendingColumns+` FROM {table}_pending ORDER BY since, token`))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pending []core.PendingTransition
+	for rows.Next() {
+		p, err := scanPending(rows)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// rowScanner is implemented by *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanPending reads pending transition from row with pendingColumns
+func scanPending(row rowScanner) (core.PendingTransition, error) {
+	var r pendingRecord
+	var event, results string
+	var since, deadline int64
+	if err := row.Scan(&r.Token, &r.ObjectID, &event, &r.From, &r.To, &r.Action, &since, &deadline, &results, &r.Resume); err != nil {
+		return core.PendingTransition{}, err
+	}
+	r.Event = core.Event(event)
+	r.Since = time.Unix(0, since)
+	if deadline != 0 {
+		r.Deadline = time.Unix(0, deadline)
+	}
+	if err := json.Unmarshal([]byte(results), &r.Results); err != nil {
+		return core.PendingTransition{}, fmt.Errorf("results of pending transition %s can't be decoded: %w", r.Token, err)
+	}
+	return r.transition()
+}
+
+// query substitutes table name and placeholders {1}, {2}... in statement
+func (s *SQLStore) query(statement string) string {
+	return sqlquery.Render(statement, s.table, s.placeholder, 10)
+}
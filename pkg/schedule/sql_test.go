@@ -0,0 +1,91 @@
+package schedule
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/estambakio/go-fsm/internal/fakesql"
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// eventsTable understands statements of SQLStore, rows are id, object_id, state, event, due by id
+type eventsTable map[string][]driver.Value
+
+func (t eventsTable) Exec(query string, args []driver.Value) (func(), error) {
+	switch {
+	case strings.HasPrefix(query, "CREATE TABLE"):
+		return func() {}, nil
+	case strings.HasPrefix(query, "INSERT INTO"):
+		return func() { t[args[0].(string)] = args }, nil
+	case strings.Contains(query, "WHERE id ="):
+		return func() { delete(t, args[0].(string)) }, nil
+	case strings.Contains(query, "WHERE object_id ="):
+		// the rest of args are IDs of kept rows
+		return func() {
+		rows:
+			for id, row := range t {
+				for _, keep := range args[1:] {
+					if keep == id {
+						continue rows
+					}
+				}
+				if row[1] == args[0] {
+					delete(t, id)
+				}
+			}
+		}, nil
+	default:
+		return nil, fmt.Errorf("unexpected statement %q", query)
+	}
+}
+
+func (t eventsTable) Query(query string, args []driver.Value) ([][]driver.Value, error) {
+	if !strings.HasPrefix(query, "SELECT") {
+		return nil, fmt.Errorf("unexpected query %q", query)
+	}
+
+	var rows [][]driver.Value
+	for _, row := range t {
+		if row[4].(int64) <= args[0].(int64) {
+			rows = append(rows, row)
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i][4].(int64) == rows[j][4].(int64) {
+			return rows[i][0].(string) < rows[j][0].(string)
+		}
+		return rows[i][4].(int64) < rows[j][4].(int64)
+	})
+	return rows, nil
+}
+
+func TestSQLStore(t *testing.T) {
+	db, fake := fakesql.Open(t, eventsTable{})
+
+	store := NewSQLStore(db, "scheduled_events", DollarPlaceholder)
+	if err := store.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, store, func() core.ScheduleStore {
+		return NewSQLStore(db, "scheduled_events", DollarPlaceholder)
+	})
+
+	for _, q := range fake.Queries() {
+		if !strings.Contains(q, "scheduled_events") || strings.Contains(q, "?") || strings.Contains(q, "{") {
+			t.Errorf("statement is not rendered properly: %s", q)
+		}
+	}
+}
+
+func TestSQLStore_query(t *testing.T) {
+	store := NewSQLStore(nil, "events", nil)
+	q := store.query("SELECT * FROM {table} WHERE a = {1} AND b = {2}")
+	if q != "SELECT * FROM events WHERE a = ? AND b = ?" {
+		t.Errorf("unexpected query: %s", q)
+	}
+}
@@ -0,0 +1,46 @@
+package schedule
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// openSQLite returns database in temporary file, test is skipped if driver is built without cgo
+func openSQLite(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", t.TempDir()+"/test.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.Ping(); err != nil {
+		t.Skipf("sqlite3 isn't available: %v", err)
+	}
+	return db
+}
+
+func TestSQLStore_sqlite(t *testing.T) {
+	db := openSQLite(t)
+
+	store := NewSQLStore(db, "scheduled_events", QuestionPlaceholder)
+	if err := store.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	// table exists already
+	if err := store.CreateTable(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	testStore(t, store, func() core.ScheduleStore {
+		return NewSQLStore(db, "scheduled_events", QuestionPlaceholder)
+	})
+	testPendingStore(t, store, func() core.PendingStore {
+		return NewSQLStore(db, "scheduled_events", QuestionPlaceholder)
+	})
+}
@@ -0,0 +1,252 @@
+// Package schemafile reads core.Schema from JSON and YAML files.
+//
+// Files follow structure of core.Schema with case-insensitive keys. For convenience states
+// can be written as plain names instead of objects with "name" key. Durations of timers, timeouts
+// and backoff of retry policies of actions are written as strings like "48h"; numbers are rejected,
+// so that unit of duration is always explicit:
+//
+//	name: order
+//	initialState: new
+//	finalStates: [shipped]
+//	states: [new, paid, shipped]
+//	transitions:
+//	  - from: new
+//	    to: paid
+//	    event: pay
+//	    actions:
+//	      - {name: charge, timeout: 5s, retry: {maxAttempts: 3, initialBackoff: 100ms}}
+//	timers:
+//	  - {state: new, after: 48h, event: expire}
+package schemafile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"gopkg.in/yaml.v3"
+)
+
+// Format of schema file
+type Format string
+
+const (
+	// JSON format
+	JSON Format = "json"
+	// YAML format
+	YAML Format = "yaml"
+)
+
+// FormatOf returns format of file based on its extension
+func FormatOf(path string) (Format, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON, nil
+	case ".yaml", ".yml":
+		return YAML, nil
+	default:
+		return "", fmt.Errorf("unknown schema format of file %s, expected .json, .yaml or .yml", path)
+	}
+}
+
+// Load reads schema from file, format is detected by extension.
+// Schema isn't validated, use core.NewMachineDefinition for that.
+func Load(path string) (core.Schema, error) {
+	format, err := FormatOf(path)
+	if err != nil {
+		return core.Schema{}, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return core.Schema{}, err
+	}
+
+	schema, err := Parse(data, format)
+	if err != nil {
+		return core.Schema{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return schema, nil
+}
+
+// Parse reads schema from data in provided format. Unknown keys are reported as errors.
+func Parse(data []byte, format Format) (core.Schema, error) {
+	var tree interface{}
+
+	switch format {
+	case JSON:
+		if err := json.Unmarshal(data, &tree); err != nil {
+			return core.Schema{}, err
+		}
+	case YAML:
+		if err := yaml.Unmarshal(data, &tree); err != nil {
+			return core.Schema{}, err
+		}
+	default:
+		return core.Schema{}, fmt.Errorf("unknown schema format %q", format)
+	}
+
+	if _, ok := tree.(map[string]interface{}); !ok {
+		return core.Schema{}, fmt.Errorf("schema must be an object, got %T", tree)
+	}
+
+	// the tree is encoded back to JSON, so that keys are matched case-insensitively in both formats
+	data, err := json.Marshal(tree)
+	if err != nil {
+		return core.Schema{}, err
+	}
+
+	var s schema
+	if err := decodeStrict(data, &s); err != nil {
+		return core.Schema{}, err
+	}
+	return s.toCore(), nil
+}
+
+// decodeStrict decodes JSON data into v reporting unknown keys as errors
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// schema mirrors core.Schema, fields which have shorthand notations in file are replaced
+type schema struct {
+	core.Schema
+	InitialState state
+	FinalStates  []state
+	States       []state
+	Transitions  []transition
+	StateActions []stateActions
+	Choices      []choice
+	Timers       []timer
+}
+
+func (s schema) toCore() core.Schema {
+	result := s.Schema
+	result.InitialState = s.InitialState.State
+	result.FinalStates = states(s.FinalStates)
+	result.States = states(s.States)
+	for _, t := range s.Transitions {
+		t.Transition.Actions = actions(t.Actions)
+		result.Transitions = append(result.Transitions, t.Transition)
+	}
+	for _, sa := range s.StateActions {
+		sa.StateActions.OnEntry = actions(sa.OnEntry)
+		sa.StateActions.OnExit = actions(sa.OnExit)
+		result.StateActions = append(result.StateActions, sa.StateActions)
+	}
+	for _, c := range s.Choices {
+		c.Choice.Branches = nil
+		for _, b := range c.Branches {
+			b.Branch.Actions = actions(b.Actions)
+			c.Choice.Branches = append(c.Choice.Branches, b.Branch)
+		}
+		result.Choices = append(result.Choices, c.Choice)
+	}
+	for _, tm := range s.Timers {
+		tm.Timer.After = time.Duration(tm.After)
+		result.Timers = append(result.Timers, tm.Timer)
+	}
+	return result
+}
+
+// state is core.State which can be written as a plain name
+type state struct {
+	core.State
+}
+
+func (s *state) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &s.Name)
+	}
+	return decodeStrict(data, &s.State)
+}
+
+func states(list []state) []core.State {
+	if list == nil {
+		return nil
+	}
+	result := make([]core.State, len(list))
+	for i, s := range list {
+		result[i] = s.State
+	}
+	return result
+}
+
+type transition struct {
+	core.Transition
+	Actions []actionDefinition
+}
+
+type stateActions struct {
+	core.StateActions
+	OnEntry []actionDefinition
+	OnExit  []actionDefinition
+}
+
+type choice struct {
+	core.Choice
+	Branches []branch
+}
+
+type branch struct {
+	core.Branch
+	Actions []actionDefinition
+}
+
+type timer struct {
+	core.Timer
+	After duration
+}
+
+// actionDefinition is core.ActionDefinition whose timeouts and backoff of retry policy can be written as strings
+type actionDefinition struct {
+	core.ActionDefinition
+	Timeout        duration
+	PendingTimeout duration
+	Retry          retryPolicy
+}
+
+type retryPolicy struct {
+	core.RetryPolicy
+	InitialBackoff duration
+	MaxBackoff     duration
+}
+
+func actions(list []actionDefinition) []core.ActionDefinition {
+	if list == nil {
+		return nil
+	}
+	result := make([]core.ActionDefinition, len(list))
+	for i, a := range list {
+		result[i] = a.ActionDefinition
+		result[i].Timeout = time.Duration(a.Timeout)
+		result[i].PendingTimeout = time.Duration(a.PendingTimeout)
+		result[i].Retry = a.Retry.RetryPolicy
+		result[i].Retry.InitialBackoff = time.Duration(a.Retry.InitialBackoff)
+		result[i].Retry.MaxBackoff = time.Duration(a.Retry.MaxBackoff)
+	}
+	return result
+}
+
+// duration is time.Duration which is written as a string like "48h"
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration %s, expected a string with unit like \"5s\"", data)
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %w", err)
+	}
+	*d = duration(v)
+	return nil
+}
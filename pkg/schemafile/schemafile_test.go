@@ -0,0 +1,162 @@
+package schemafile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+const yamlSchema = `
+name: order
+initialState: new
+finalStates: [shipped]
+states:
+  - new
+  - name: paid
+  - shipped
+transitions:
+  - from: new
+    to: paid
+    event: pay
+    guards:
+      - name: hasTotal
+        params: [{name: min, value: 10}]
+  - {fromStates: [new, paid], to: shipped, event: ship, actions: [{name: notify, timeout: 5s, retry: {maxAttempts: 3, initialBackoff: 100ms, maxBackoff: 1s}}]}
+timers:
+  - {state: new, after: 48h, event: expire}
+`
+
+const jsonSchema = `{
+  "name": "order",
+  "initialState": {"name": "new"},
+  "finalStates": ["shipped"],
+  "states": ["new", "paid", "shipped"],
+  "transitions": [
+    {"from": "new", "to": "paid", "event": "pay", "guards": [{"name": "hasTotal", "params": [{"name": "min", "value": 10}]}]},
+    {"fromStates": ["new", "paid"], "to": "shipped", "event": "ship",
+     "actions": [{"name": "notify", "timeout": "5s", "retry": {"maxAttempts": 3, "initialBackoff": "100ms", "maxBackoff": "1s"}}]}
+  ],
+  "timers": [{"state": "new", "after": "48h", "event": "expire"}]
+}`
+
+func TestParse(t *testing.T) {
+	for _, test := range []struct {
+		format Format
+		data   string
+	}{
+		{YAML, yamlSchema},
+		{JSON, jsonSchema},
+	} {
+		schema, err := Parse([]byte(test.data), test.format)
+		if err != nil {
+			t.Fatalf("%s: %v", test.format, err)
+		}
+
+		if schema.Name != "order" || schema.InitialState.Name != "new" || len(schema.States) != 3 ||
+			schema.States[1].Name != "paid" || schema.FinalStates[0].Name != "shipped" {
+			t.Errorf("%s: states are not parsed: %+v", test.format, schema)
+		}
+		if len(schema.Transitions) != 2 {
+			t.Fatalf("%s: expected 2 transitions, got %+v", test.format, schema.Transitions)
+		}
+		tr := schema.Transitions[0]
+		if tr.From != "new" || tr.To != "paid" || tr.Event != "pay" || tr.Guards[0].Name != "hasTotal" ||
+			tr.Guards[0].Params[0].Value != float64(10) {
+			t.Errorf("%s: transition is not parsed: %+v", test.format, tr)
+		}
+		if tr := schema.Transitions[1]; len(tr.FromStates) != 2 || tr.Actions[0].Name != "notify" {
+			t.Errorf("%s: transition is not parsed: %+v", test.format, tr)
+		}
+		if retry := schema.Transitions[1].Actions[0].Retry; retry.MaxAttempts != 3 ||
+			retry.InitialBackoff != 100*time.Millisecond || retry.MaxBackoff != time.Second ||
+			schema.Transitions[1].Actions[0].Timeout != 5*time.Second {
+			t.Errorf("%s: timeout and retry policy are not parsed: %+v", test.format, schema.Transitions[1].Actions[0])
+		}
+		if len(schema.Timers) != 1 || schema.Timers[0].After != 48*time.Hour {
+			t.Errorf("%s: timers are not parsed: %+v", test.format, schema.Timers)
+		}
+
+		if _, err := core.NewMachineDefinition(schema, []core.Condition{{Name: "hasTotal"}}); err != nil {
+			t.Errorf("%s: parsed schema is not valid: %v", test.format, err)
+		}
+	}
+}
+
+func TestParse_actionDefinitions(t *testing.T) {
+	schema, err := Parse([]byte(`
+stateActions:
+  - state: new
+    onEntry: [{name: notify, timeout: 1s, params: [{name: request, value: {timeout: 5s, retry: {initialBackoff: 1s}}}]}]
+choices:
+  - name: check
+    branches: [{to: paid, actions: [{name: charge, pendingTimeout: 1h}]}]
+`), YAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notify := schema.StateActions[0].OnEntry[0]
+	if notify.Timeout != time.Second {
+		t.Errorf("expected timeout of entry action to be parsed, got %+v", notify)
+	}
+	// durations are parsed only in action definitions, values of params are kept as is
+	expected := map[string]interface{}{"timeout": "5s", "retry": map[string]interface{}{"initialBackoff": "1s"}}
+	if !reflect.DeepEqual(notify.Params[0].Value, expected) {
+		t.Errorf("expected value of param to be kept, got %#v", notify.Params[0].Value)
+	}
+	if charge := schema.Choices[0].Branches[0].Actions[0]; charge.PendingTimeout != time.Hour {
+		t.Errorf("expected pending timeout of branch action to be parsed, got %+v", charge)
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	tests := []struct {
+		format Format
+		data   string
+	}{
+		{YAML, "name: order\nstatez: [new]"},
+		{YAML, "[1, 2]"},
+		{YAML, "timers: [{state: new, after: soon, event: expire}]"},
+		{YAML, "transitions: [{actions: [{name: notify, retry: {initialBackoff: soon}}]}]"},
+		{YAML, "stateActions: [{onEntry: [{name: notify, timeout: soon}]}]"},
+		{YAML, "stateActions: [{onEntry: [{name: notify, pendingTimeout: soon}]}]"},
+		{YAML, "timers: [{state: new, after: 5, event: expire}]"},
+		{JSON, `{"transitions": [{"actions": [{"name": "notify", "timeout": 5000000000}]}]}`},
+		{YAML, "choices: [{branches: [{actions: [{name: notify, timeout: [1]}]}]}]"},
+		{YAML, "transitions: [{actions: [{name: notify, retries: 3}]}]"},
+		{YAML, "states: [{name: new, final: true}]"},
+		{JSON, "{"},
+		{Format("xml"), "<schema/>"},
+	}
+
+	for i, test := range tests {
+		if _, err := Parse([]byte(test.data), test.format); err == nil {
+			t.Errorf("test %d: expected error", i)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "order.yml")
+	if err := os.WriteFile(path, []byte(yamlSchema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	schema, err := Load(path)
+	if err != nil || schema.Name != "order" {
+		t.Errorf("expected schema 'order', got %+v, %v", schema, err)
+	}
+
+	if _, err := Load(filepath.Join(dir, "order.txt")); err == nil {
+		t.Error("expected error for unknown extension")
+	}
+	if _, err := Load(filepath.Join(dir, "missing.json")); err == nil {
+		t.Error("expected error for missing file")
+	}
+}
@@ -0,0 +1,141 @@
+// Package tracing records OpenTelemetry spans of machines: calls of SendEvent, AvailableTransitions,
+// Complete and Fail, guard evaluations and actions.
+//
+// Tracing is fed by core.Hooks:
+//
+//	t, _ := tracing.New(provider)
+//	machine := core.NewMachine(ctx, md, t.Hooks())
+//
+// Calls of machine open spans named after method, e.g. "fsm.SendEvent", which are children of a span in machine's
+// context, if any; suspended transition is marked with "fsm.pending" attribute. Every guard and action gets a child
+// span "fsm.guard <name>" or "fsm.action <name>", span's context is passed to Condition.F and Action.F, so that they
+// can trace their own calls.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName is a name of tracer
+const instrumentationName = "github.com/estambakio/go-fsm"
+
+// Attribute keys of spans
+const (
+	MachineKey   = attribute.Key("fsm.machine")
+	ObjectIDKey  = attribute.Key("fsm.object_id")
+	EventKey     = attribute.Key("fsm.event")
+	FromKey      = attribute.Key("fsm.from")
+	ToKey        = attribute.Key("fsm.to")
+	ConditionKey = attribute.Key("fsm.condition")
+	NegateKey    = attribute.Key("fsm.negate")
+	ResultKey    = attribute.Key("fsm.result")
+	ActionKey    = attribute.Key("fsm.action")
+	ParamsKey    = attribute.Key("fsm.params")
+	PendingKey   = attribute.Key("fsm.pending")
+)
+
+// Tracing creates spans of machines which use its hooks
+type Tracing struct {
+	tracer trace.Tracer
+}
+
+// New returns tracing. Optional args: trace.TracerProvider, global provider is used by default.
+func New(args ...interface{}) (*Tracing, error) {
+	var provider trace.TracerProvider
+
+	// handle variadic optional args based on passed types
+	for _, arg := range args {
+		switch arg := arg.(type) {
+		case trace.TracerProvider:
+			provider = arg
+		default:
+			return nil, fmt.Errorf("unknown type %T, value %v in tracing.New call", arg, arg)
+		}
+	}
+
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return &Tracing{tracer: provider.Tracer(instrumentationName)}, nil
+}
+
+// Hooks returns hooks which create spans of machine
+func (t *Tracing) Hooks() core.Hooks {
+	return core.Hooks{
+		AroundCall: func(ctx context.Context, info core.CallInfo, next func(context.Context) error) error {
+			attrs := []attribute.KeyValue{MachineKey.String(info.Machine), FromKey.String(info.Object.Status())}
+			if info.Event != "" {
+				attrs = append(attrs, EventKey.String(string(info.Event)))
+			}
+			if i, ok := info.Object.(core.Identifiable); ok {
+				attrs = append(attrs, ObjectIDKey.String(i.ID()))
+			}
+
+			ctx, span := t.tracer.Start(ctx, "fsm."+info.Method, trace.WithAttributes(attrs...))
+			defer span.End()
+
+			err := next(ctx)
+			switch {
+			case errors.Is(err, core.ErrPending):
+				// suspended transition isn't failed
+				span.SetAttributes(PendingKey.Bool(true))
+			case err != nil:
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return err
+		},
+		AfterTransition: func(ctx context.Context, info core.TransitionInfo) {
+			trace.SpanFromContext(ctx).SetAttributes(ToKey.String(info.To))
+		},
+		AroundGuard: func(ctx context.Context, info core.GuardInfo, next func(context.Context) bool) bool {
+			ctx, span := t.tracer.Start(ctx, "fsm.guard "+info.Guard.Name, trace.WithAttributes(
+				MachineKey.String(info.Machine),
+				ConditionKey.String(info.Guard.Name),
+				NegateKey.Bool(info.Guard.Negate),
+				ParamsKey.StringSlice(params(info.Guard.Params)),
+			))
+			defer span.End()
+
+			passed := next(ctx)
+			span.SetAttributes(ResultKey.Bool(passed))
+			if err := ctx.Err(); err != nil {
+				span.SetStatus(codes.Error, err.Error())
+			}
+			return passed
+		},
+		AroundAction: func(ctx context.Context, info core.ActionInfo, next func(context.Context) core.ActionResult) core.ActionResult {
+			ctx, span := t.tracer.Start(ctx, "fsm.action "+info.Action.Name, trace.WithAttributes(
+				MachineKey.String(info.Machine),
+				EventKey.String(string(info.Event)),
+				ActionKey.String(info.Action.Name),
+				ParamsKey.StringSlice(params(info.Action.Params)),
+			))
+			defer span.End()
+
+			result := next(ctx)
+			if result.Err != nil {
+				span.RecordError(result.Err)
+				span.SetStatus(codes.Error, result.Err.Error())
+			}
+			return result
+		},
+	}
+}
+
+// params formats params as "name=value"
+func params(ps []core.Param) []string {
+	s := make([]string, len(ps))
+	for i, p := range ps {
+		s[i] = fmt.Sprintf("%s=%v", p.Name, p.Value)
+	}
+	return s
+}
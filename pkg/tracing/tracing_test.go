@@ -0,0 +1,160 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type order struct{ status string }
+
+func (o *order) Status() string     { return o.status }
+func (o *order) SetStatus(s string) { o.status = s }
+func (o *order) ID() string         { return "42" }
+
+func newMachine(t *testing.T, tr *Tracing) *core.Machine {
+	md, err := core.NewMachineDefinition(
+		core.Schema{
+			Name:         "order",
+			InitialState: core.State{Name: "new"},
+			States:       []core.State{{Name: "new"}, {Name: "paid"}, {Name: "failed"}},
+			Transitions: []core.Transition{
+				{
+					From: "new", To: "paid", Event: "pay",
+					Guards:  []core.Guard{{Name: "valid", Params: []core.Param{{Name: "min", Value: 10}}}},
+					Actions: []core.ActionDefinition{{Name: "charge"}},
+				},
+				{From: "new", To: "failed", Event: "fail", Actions: []core.ActionDefinition{{Name: "broken"}}},
+			},
+		},
+		[]core.Condition{{Name: "valid", F: func(ctx context.Context, o core.Object, p []core.Param) bool {
+			// span of guard is passed to condition
+			return trace.SpanFromContext(ctx).SpanContext().IsValid()
+		}}},
+		[]core.Action{
+			{Name: "charge", F: func(ctx context.Context, o core.Object, p []core.Param, r []core.ActionResult) core.ActionResult {
+				return core.ActionResult{Name: "charge"}
+			}},
+			{Name: "broken", F: func(ctx context.Context, o core.Object, p []core.Param, r []core.ActionResult) core.ActionResult {
+				return core.ActionResult{Name: "broken", Err: errors.New("failed")}
+			}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := core.NewMachine(context.Background(), md, tr.Hooks())
+	return machine
+}
+
+func attributes(s sdktrace.ReadOnlySpan) map[attribute.Key]attribute.Value {
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, kv := range s.Attributes() {
+		attrs[kv.Key] = kv.Value
+	}
+	return attrs
+}
+
+func TestTracing_SendEvent(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tr, err := New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := newMachine(t, tr)
+
+	if _, err := machine.SendEvent(&order{status: "new"}, "pay"); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := recorder.Ended()
+	var names []string
+	byName := map[string]sdktrace.ReadOnlySpan{}
+	for _, s := range spans {
+		names = append(names, s.Name())
+		byName[s.Name()] = s
+	}
+	expected := []string{"fsm.guard valid", "fsm.AvailableTransitions", "fsm.action charge", "fsm.SendEvent"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Fatalf("expected spans %v, got %v", expected, names)
+	}
+
+	send := byName["fsm.SendEvent"]
+	available := byName["fsm.AvailableTransitions"]
+	guard := byName["fsm.guard valid"]
+	action := byName["fsm.action charge"]
+
+	if send.Parent().IsValid() {
+		t.Error("expected SendEvent span to be a root span")
+	}
+	if available.Parent().SpanID() != send.SpanContext().SpanID() {
+		t.Error("expected AvailableTransitions span to be a child of SendEvent span")
+	}
+	if guard.Parent().SpanID() != available.SpanContext().SpanID() {
+		t.Error("expected guard span to be a child of AvailableTransitions span")
+	}
+	if action.Parent().SpanID() != send.SpanContext().SpanID() {
+		t.Error("expected action span to be a child of SendEvent span")
+	}
+
+	attrs := attributes(send)
+	if attrs[MachineKey].AsString() != "order" || attrs[EventKey].AsString() != "pay" ||
+		attrs[FromKey].AsString() != "new" || attrs[ToKey].AsString() != "paid" || attrs[ObjectIDKey].AsString() != "42" {
+		t.Errorf("unexpected attributes of SendEvent span: %v", send.Attributes())
+	}
+
+	attrs = attributes(guard)
+	if attrs[ConditionKey].AsString() != "valid" || attrs[NegateKey].AsBool() || !attrs[ResultKey].AsBool() ||
+		!reflect.DeepEqual(attrs[ParamsKey].AsStringSlice(), []string{"min=10"}) {
+		t.Errorf("unexpected attributes of guard span: %v", guard.Attributes())
+	}
+
+	if attributes(action)[ActionKey].AsString() != "charge" {
+		t.Errorf("unexpected attributes of action span: %v", action.Attributes())
+	}
+}
+
+func TestTracing_error(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tr, err := New(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	machine := newMachine(t, tr)
+
+	if _, err := machine.SendEvent(&order{status: "new"}, "fail"); err == nil {
+		t.Fatal("expected error")
+	}
+
+	for _, s := range recorder.Ended() {
+		if s.Name() == "fsm.AvailableTransitions" {
+			continue
+		}
+		if s.Status().Code != codes.Error {
+			t.Errorf("expected error status of span %s, got %v", s.Name(), s.Status())
+		}
+		if len(s.Events()) != 1 || s.Events()[0].Name != "exception" {
+			t.Errorf("expected error to be recorded in span %s, got %v", s.Name(), s.Events())
+		}
+		if _, ok := attributes(s)[ToKey]; ok {
+			t.Errorf("unexpected target state in span %s", s.Name())
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, err := New(); err != nil {
+		t.Error(err)
+	}
+	if _, err := New(42); err == nil {
+		t.Error("expected error for unknown argument")
+	}
+}
@@ -0,0 +1,182 @@
+package typed
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// Condition is a typed counterpart of core.Condition
+type Condition[O any] struct {
+	Name string
+	F    func(context.Context, O, []core.Param) bool
+}
+
+// Action is a typed counterpart of core.Action
+type Action[O any] struct {
+	Name string
+	F    func(context.Context, O, []core.Param, []core.ActionResult) core.ActionResult
+}
+
+// Definition is a typed counterpart of core.MachineDefinition
+type Definition[S ~string, E ~string, O Object[S]] struct {
+	md *core.MachineDefinition
+}
+
+// NewDefinition creates core.MachineDefinition from typed schema, conditions and actions.
+// Optional args are passed to core.NewMachineDefinition. Typed conditions and actions get objects passed to
+// Machine or loaded by repository created by NewRepository; for other objects conditions are not satisfied
+// and actions fail.
+func NewDefinition[S ~string, E ~string, O Object[S]](
+	schema Schema[S, E], conditions []Condition[O], actions []Action[O], args ...interface{},
+) (*Definition[S, E, O], error) {
+	coreConditions := make([]core.Condition, len(conditions))
+	for i, c := range conditions {
+		f := c.F
+		coreConditions[i] = core.Condition{
+			Name: c.Name,
+			F: func(ctx context.Context, o core.Object, params []core.Param) bool {
+				typed, err := unwrap[S, O](o)
+				return err == nil && f(ctx, typed, params)
+			},
+		}
+	}
+
+	coreActions := make([]core.Action, len(actions))
+	for i, a := range actions {
+		name, f := a.Name, a.F
+		coreActions[i] = core.Action{
+			Name: a.Name,
+			F: func(ctx context.Context, o core.Object, params []core.Param, prev []core.ActionResult) core.ActionResult {
+				typed, err := unwrap[S, O](o)
+				if err != nil {
+					return core.ActionResult{Name: name, Err: fmt.Errorf("action '%s': %w", name, err)}
+				}
+				return f(ctx, typed, params, prev)
+			},
+		}
+	}
+
+	md, err := core.NewMachineDefinition(schema.Core(), append([]interface{}{coreConditions, coreActions}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &Definition[S, E, O]{md}, nil
+}
+
+// Core returns underlying core.MachineDefinition
+func (d *Definition[S, E, O]) Core() *core.MachineDefinition {
+	return d.md
+}
+
+// Machine is a typed counterpart of core.Machine
+type Machine[S ~string, E ~string, O Object[S]] struct {
+	m *core.Machine
+}
+
+// NewMachine returns new machine instance. Optional args are passed to core.NewMachine, it panics if they are invalid.
+func NewMachine[S ~string, E ~string, O Object[S]](ctx context.Context, d *Definition[S, E, O], args ...interface{}) *Machine[S, E, O] {
+	return &Machine[S, E, O]{core.NewMachine(ctx, d.md, args...)}
+}
+
+// NewMachineWithOptions returns new machine instance. Optional args are passed to core.NewMachineWithOptions.
+func NewMachineWithOptions[S ~string, E ~string, O Object[S]](ctx context.Context, d *Definition[S, E, O], args ...interface{}) (*Machine[S, E, O], error) {
+	m, err := core.NewMachineWithOptions(ctx, d.md, args...)
+	if err != nil {
+		return nil, err
+	}
+	return &Machine[S, E, O]{m}, nil
+}
+
+// Core returns underlying core.Machine. Typed guards and actions get objects which are passed to it directly
+// only if they are loaded by repository created by NewRepository.
+func (m *Machine[S, E, O]) Core() *core.Machine {
+	return m.m
+}
+
+// Start sets object status to initial state, see core.Machine.Start
+func (m *Machine[S, E, O]) Start(o O) {
+	m.m.Start(wrap[S](o))
+}
+
+// Schedule records events of timers of object's current state, see core.Machine.Schedule
+func (m *Machine[S, E, O]) Schedule(o O) error {
+	return m.m.Schedule(wrap[S](o))
+}
+
+// SendEvent triggers transition according to event
+func (m *Machine[S, E, O]) SendEvent(o O, e E) ([]core.ActionResult, error) {
+	return m.m.SendEvent(wrap[S](o), core.Event(e))
+}
+
+// Can indicates whether object can perform transition according to event
+func (m *Machine[S, E, O]) Can(o O, e E) bool {
+	return m.m.Can(wrap[S](o), core.Event(e))
+}
+
+// AvailableEvents returns events of transitions available for object, without duplicates,
+// in order of declaration
+func (m *Machine[S, E, O]) AvailableEvents(o O) ([]E, error) {
+	trs, err := m.m.AvailableTransitions(wrap[S](o))
+	if err != nil {
+		return nil, err
+	}
+
+	var events []E
+	seen := map[core.Event]bool{}
+	for _, t := range trs {
+		if !seen[t.Event] {
+			seen[t.Event] = true
+			events = append(events, E(t.Event))
+		}
+	}
+	return events, nil
+}
+
+// CurrentState returns object's status if it's a known state
+func (m *Machine[S, E, O]) CurrentState(o O) (S, error) {
+	s, err := m.m.CurrentState(wrap[S](o))
+	return S(s.Name), err
+}
+
+// IsInFinalState returns true if object's status is a final state
+func (m *Machine[S, E, O]) IsInFinalState(o O) bool {
+	return m.m.IsInFinalState(wrap[S](o))
+}
+
+// IsRunning returns true if object's status is a non-final state
+func (m *Machine[S, E, O]) IsRunning(o O) bool {
+	return m.m.IsRunning(wrap[S](o))
+}
+
+// SendEventByID loads object from repository passed to NewMachine, sends event to it and saves it,
+// see core.Machine.SendEventByID. Repository should be created by NewRepository.
+func (m *Machine[S, E, O]) SendEventByID(id string, e E) (O, []core.ActionResult, error) {
+	o, results, err := m.m.SendEventByID(id, core.Event(e))
+	return typedResult[S, O](o, results, err)
+}
+
+// Complete resumes pending transition with output of asynchronous action, see core.Machine.Complete
+func (m *Machine[S, E, O]) Complete(token string, output interface{}) (O, []core.ActionResult, error) {
+	o, results, err := m.m.Complete(token, output)
+	return typedResult[S, O](o, results, err)
+}
+
+// Fail fails pending transition with cause as error of asynchronous action, see core.Machine.Fail
+func (m *Machine[S, E, O]) Fail(token string, cause error) error {
+	return m.m.Fail(token, cause)
+}
+
+// typedResult unwraps object returned by core.Machine along with results and error
+func typedResult[S ~string, O Object[S]](o core.Object, results []core.ActionResult, err error) (O, []core.ActionResult, error) {
+	var typed O
+	if o == nil {
+		return typed, results, err
+	}
+	typed, unwrapErr := unwrap[S, O](o)
+	if err == nil {
+		err = unwrapErr
+	}
+	return typed, results, err
+}
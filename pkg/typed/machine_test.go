@@ -0,0 +1,188 @@
+package typed
+
+import (
+	"context"
+	"testing"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+type orderState string
+
+type orderEvent string
+
+const (
+	stateNew     orderState = "new"
+	statePaid    orderState = "paid"
+	stateShipped orderState = "shipped"
+
+	eventPay  orderEvent = "pay"
+	eventShip orderEvent = "ship"
+)
+
+type order struct {
+	id      string
+	state   orderState
+	total   int
+	shipped bool
+}
+
+func (o *order) Status() orderState     { return o.state }
+func (o *order) SetStatus(s orderState) { o.state = s }
+
+type identifiableOrder struct{ order }
+
+func (o *identifiableOrder) ID() string { return o.id }
+
+// swappingOrder is an order whose status is set with compare-and-set
+type swappingOrder struct {
+	identifiableOrder
+	swaps int
+}
+
+func (o *swappingOrder) CompareAndSetStatus(expected, status orderState) (bool, error) {
+	o.swaps++
+	if o.state != expected {
+		return false, nil
+	}
+	o.state = status
+	return true, nil
+}
+
+// plainObject is a core.Object which isn't passed through typed machine
+type plainObject struct{ status string }
+
+func (o *plainObject) Status() string     { return o.status }
+func (o *plainObject) SetStatus(s string) { o.status = s }
+
+func newDefinition(t *testing.T) *Definition[orderState, orderEvent, *order] {
+	d, err := NewDefinition(
+		Schema[orderState, orderEvent]{
+			Name:         "order",
+			InitialState: stateNew,
+			FinalStates:  []orderState{stateShipped},
+			States:       []orderState{stateNew, statePaid, stateShipped},
+			Transitions: []Transition[orderState, orderEvent]{
+				{From: stateNew, To: statePaid, Event: eventPay, Guards: []core.Guard{{Name: "hasTotal"}}},
+				{From: statePaid, To: stateShipped, Event: eventShip, Actions: []core.ActionDefinition{{Name: "ship"}}},
+			},
+		},
+		[]Condition[*order]{
+			{Name: "hasTotal", F: func(ctx context.Context, o *order, params []core.Param) bool { return o.total > 0 }},
+		},
+		[]Action[*order]{
+			{Name: "ship", F: func(ctx context.Context, o *order, params []core.Param, prev []core.ActionResult) core.ActionResult {
+				o.shipped = true
+				return core.ActionResult{Name: "ship"}
+			}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestMachine(t *testing.T) {
+	m := NewMachine(context.Background(), newDefinition(t))
+
+	o := &order{}
+	m.Start(o)
+	if o.state != stateNew {
+		t.Fatalf("expected initial state, got %s", o.state)
+	}
+
+	if m.Can(o, eventPay) {
+		t.Error("expected guard to reject payment of empty order")
+	}
+
+	o.total = 10
+	events, err := m.AvailableEvents(o)
+	if err != nil || len(events) != 1 || events[0] != eventPay {
+		t.Errorf("expected [pay], got %v, %v", events, err)
+	}
+
+	for _, e := range []orderEvent{eventPay, eventShip} {
+		if _, err := m.SendEvent(o, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := m.CurrentState(o)
+	if err != nil || s != stateShipped || !o.shipped || !m.IsInFinalState(o) || m.IsRunning(o) {
+		t.Errorf("expected shipped order, got %s, %v, %+v", s, err, o)
+	}
+}
+
+func TestMachine_identifiable(t *testing.T) {
+	// identity of typed object is visible to core components
+	var object core.Object = wrap[orderState](&identifiableOrder{order{id: "1"}})
+	if i, ok := object.(core.Identifiable); !ok || i.ID() != "1" {
+		t.Errorf("expected identifiable object, got %v", object)
+	}
+
+	object = wrap[orderState](&order{id: "1"})
+	if _, ok := object.(core.Identifiable); ok {
+		t.Error("expected object without ID not to be identifiable")
+	}
+	if _, ok := object.(core.StatusSwapper); ok {
+		t.Error("expected object without CompareAndSetStatus not to be status swapper")
+	}
+}
+
+func TestMachine_statusSwapper(t *testing.T) {
+	o := &swappingOrder{identifiableOrder: identifiableOrder{order{id: "1", state: stateNew}}}
+	object := wrap[orderState](o)
+	if i, ok := object.(core.Identifiable); !ok || i.ID() != "1" {
+		t.Errorf("expected identifiable object, got %v", object)
+	}
+	swapper, ok := object.(core.StatusSwapper)
+	if !ok {
+		t.Fatal("expected status swapper")
+	}
+	if swapped, err := swapper.CompareAndSetStatus("paid", "shipped"); swapped || err != nil || o.state != stateNew {
+		t.Errorf("expected swap of unexpected status to fail, got %v, %v, %s", swapped, err, o.state)
+	}
+
+	// machine commits transitions of typed objects with compare-and-set
+	d, err := NewDefinition(
+		Schema[orderState, orderEvent]{
+			States:      []orderState{stateNew, statePaid},
+			Transitions: []Transition[orderState, orderEvent]{{From: stateNew, To: statePaid, Event: eventPay}},
+		},
+		[]Condition[*swappingOrder]{}, []Action[*swappingOrder]{},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := NewMachine(context.Background(), d)
+	o.swaps = 0
+	if _, err := m.SendEvent(o, eventPay); err != nil || o.state != statePaid || o.swaps != 1 {
+		t.Errorf("expected transition to be committed with compare-and-set, got %s after %d swaps, %v", o.state, o.swaps, err)
+	}
+}
+
+func TestMachine_Core_unwrappedObject(t *testing.T) {
+	m := NewMachine(context.Background(), newDefinition(t))
+
+	// typed guards and actions don't get objects which are not passed through typed machine
+	if m.Core().Can(&plainObject{status: "new"}, core.Event(eventPay)) {
+		t.Error("expected guard not to be satisfied")
+	}
+	if _, err := m.Core().SendEvent(&plainObject{status: "paid"}, core.Event(eventShip)); err == nil {
+		t.Error("expected action to fail")
+	}
+}
+
+func TestNewDefinition_invalid(t *testing.T) {
+	_, err := NewDefinition(
+		Schema[orderState, orderEvent]{
+			States:      []orderState{stateNew},
+			Transitions: []Transition[orderState, orderEvent]{{From: stateNew, To: statePaid, Event: eventPay}},
+		},
+		[]Condition[*order]{}, []Action[*order]{},
+	)
+	if err == nil {
+		t.Error("expected error for transition to unknown state")
+	}
+}
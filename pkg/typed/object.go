@@ -0,0 +1,103 @@
+package typed
+
+import (
+	"fmt"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// Object is a business object with typed status
+type Object[S ~string] interface {
+	Status() S
+	SetStatus(S)
+}
+
+// StatusSwapper is a typed counterpart of core.StatusSwapper
+type StatusSwapper[S ~string] interface {
+	CompareAndSetStatus(expected, status S) (bool, error)
+}
+
+// object adapts typed Object to core.Object
+type object[S ~string, O Object[S]] struct {
+	o O
+}
+
+func (a *object[S, O]) Status() string {
+	return string(a.o.Status())
+}
+
+func (a *object[S, O]) SetStatus(s string) {
+	a.o.SetStatus(S(s))
+}
+
+func (a *object[S, O]) unwrap() O {
+	return a.o
+}
+
+func (a *object[S, O]) id() string {
+	return any(a.o).(core.Identifiable).ID()
+}
+
+func (a *object[S, O]) compareAndSetStatus(expected, status string) (bool, error) {
+	return any(a.o).(StatusSwapper[S]).CompareAndSetStatus(S(expected), S(status))
+}
+
+// identifiableObject adapts typed Object which implements core.Identifiable
+type identifiableObject[S ~string, O Object[S]] struct {
+	object[S, O]
+}
+
+func (a *identifiableObject[S, O]) ID() string {
+	return a.id()
+}
+
+// swappingObject adapts typed Object which implements StatusSwapper
+type swappingObject[S ~string, O Object[S]] struct {
+	object[S, O]
+}
+
+func (a *swappingObject[S, O]) CompareAndSetStatus(expected, status string) (bool, error) {
+	return a.compareAndSetStatus(expected, status)
+}
+
+// identifiableSwappingObject adapts typed Object which implements both core.Identifiable and StatusSwapper
+type identifiableSwappingObject[S ~string, O Object[S]] struct {
+	object[S, O]
+}
+
+func (a *identifiableSwappingObject[S, O]) ID() string {
+	return a.id()
+}
+
+func (a *identifiableSwappingObject[S, O]) CompareAndSetStatus(expected, status string) (bool, error) {
+	return a.compareAndSetStatus(expected, status)
+}
+
+// wrap returns core.Object for typed object preserving core.Identifiable and StatusSwapper
+func wrap[S ~string, O Object[S]](o O) core.Object {
+	_, identifiable := any(o).(core.Identifiable)
+	_, swapper := any(o).(StatusSwapper[S])
+	switch {
+	case identifiable && swapper:
+		return &identifiableSwappingObject[S, O]{object[S, O]{o}}
+	case identifiable:
+		return &identifiableObject[S, O]{object[S, O]{o}}
+	case swapper:
+		return &swappingObject[S, O]{object[S, O]{o}}
+	default:
+		return &object[S, O]{o}
+	}
+}
+
+// unwrap returns typed object from core.Object created by wrap. Error is returned for objects which
+// reach core.Machine without wrap, e.g. loaded by core.Repository which isn't created by NewRepository.
+func unwrap[S ~string, O Object[S]](o core.Object) (O, error) {
+	if w, ok := o.(interface{ unwrap() O }); ok {
+		return w.unwrap(), nil
+	}
+	if typed, ok := any(o).(O); ok {
+		return typed, nil
+	}
+	var zero O
+	return zero, fmt.Errorf("object %T isn't passed through typed machine or repository", o)
+}
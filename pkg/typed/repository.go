@@ -0,0 +1,52 @@
+package typed
+
+import (
+	"context"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// Repository is a typed counterpart of core.Repository
+type Repository[O any] interface {
+	Load(ctx context.Context, id string) (O, error)
+	Save(ctx context.Context, o O) error
+}
+
+// repository adapts typed Repository to core.Repository
+type repository[S ~string, O Object[S]] struct {
+	r Repository[O]
+}
+
+// NewRepository adapts typed repository to core.Repository, which can be passed to NewMachine.
+// Objects loaded by it reach typed guards and actions when core components load objects by ID,
+// e.g. Machine.SendEventByID or core.DurableScheduler. If r implements core.PendingStore then returned
+// repository implements it too, so that machine keeps pending transitions there.
+func NewRepository[S ~string, O Object[S]](r Repository[O]) core.Repository {
+	a := &repository[S, O]{r}
+	if store, ok := r.(core.PendingStore); ok {
+		return &pendingRepository[S, O]{a, store}
+	}
+	return a
+}
+
+// pendingRepository is a repository which keeps pending transitions
+type pendingRepository[S ~string, O Object[S]] struct {
+	*repository[S, O]
+	core.PendingStore
+}
+
+func (a *repository[S, O]) Load(ctx context.Context, id string) (core.Object, error) {
+	o, err := a.r.Load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return wrap[S](o), nil
+}
+
+func (a *repository[S, O]) Save(ctx context.Context, o core.Object) error {
+	typed, err := unwrap[S, O](o)
+	if err != nil {
+		return err
+	}
+	return a.r.Save(ctx, typed)
+}
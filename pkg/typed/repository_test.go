@@ -0,0 +1,96 @@
+package typed
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+	"github.com/estambakio/go-fsm/pkg/schedule"
+)
+
+// memRepository stores copies of orders
+type memRepository struct {
+	mu     sync.Mutex
+	orders map[string]identifiableOrder
+}
+
+func (r *memRepository) Load(ctx context.Context, id string) (*identifiableOrder, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	o, ok := r.orders[id]
+	if !ok {
+		return nil, core.ErrObjectNotFound
+	}
+	return &o, nil
+}
+
+func (r *memRepository) Save(ctx context.Context, o *identifiableOrder) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders[o.id] = *o
+	return nil
+}
+
+func TestNewRepository(t *testing.T) {
+	d, err := NewDefinition(
+		Schema[orderState, orderEvent]{
+			States: []orderState{stateNew, statePaid, stateShipped},
+			Transitions: []Transition[orderState, orderEvent]{
+				{From: stateNew, To: statePaid, Event: eventPay, Guards: []core.Guard{{Name: "hasTotal"}}, Actions: []core.ActionDefinition{{Name: "charge"}}},
+				{From: statePaid, To: stateShipped, Event: eventShip},
+			},
+		},
+		[]Condition[*identifiableOrder]{
+			{Name: "hasTotal", F: func(ctx context.Context, o *identifiableOrder, params []core.Param) bool { return o.total > 0 }},
+		},
+		[]Action[*identifiableOrder]{
+			{Name: "charge", F: func(ctx context.Context, o *identifiableOrder, params []core.Param, prev []core.ActionResult) core.ActionResult {
+				return core.ActionResult{Name: "charge", Pending: true, Token: "payment-" + o.id}
+			}},
+		},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &memRepository{orders: map[string]identifiableOrder{"1": {order{id: "1", state: stateNew, total: 10}}}}
+	store, err := schedule.NewFileStore(filepath.Join(t.TempDir(), "pending.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// pending transitions are kept by repository
+	m := NewMachine(context.Background(), d, NewRepository[orderState](struct {
+		*memRepository
+		*schedule.FileStore
+	}{repo, store}))
+
+	// objects loaded by repository reach typed guards and actions
+	if _, _, err := m.SendEventByID("1", eventPay); !errors.Is(err, core.ErrPending) {
+		t.Fatalf("expected pending transition, got %v", err)
+	}
+	o, _, err := m.Complete("payment-1", nil)
+	if err != nil || o.id != "1" || o.state != statePaid {
+		t.Fatalf("expected completed transition, got %+v, %v", o, err)
+	}
+	if repo.orders["1"].state != statePaid {
+		t.Errorf("expected completed transition to be saved, got %s", repo.orders["1"].state)
+	}
+	if err := m.Fail("payment-1", nil); !errors.Is(err, core.ErrPendingNotFound) {
+		t.Errorf("expected completed transition not to be found, got %v", err)
+	}
+
+	o, _, err = m.SendEventByID("1", eventShip)
+	if err != nil || o.state != stateShipped || repo.orders["1"].state != stateShipped {
+		t.Errorf("expected shipped order to be saved, got %+v, %v", o, err)
+	}
+
+	if _, _, err := m.SendEventByID("2", eventPay); !errors.Is(err, core.ErrObjectNotFound) {
+		t.Errorf("expected ErrObjectNotFound, got %v", err)
+	}
+	if err := NewRepository[orderState](repo).Save(context.Background(), &plainObject{}); err == nil {
+		t.Error("expected error for object which isn't passed through typed machine")
+	}
+}
@@ -0,0 +1,130 @@
+// Package typed provides a type-safe API on top of package core: states and events are user-defined
+// string types and guards and actions receive concrete object type without type assertions.
+package typed
+
+import (
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+// Transition is a typed counterpart of core.Transition
+type Transition[S ~string, E ~string] struct {
+	From       S
+	FromStates []S
+	To         S
+	Event      E
+	Internal   bool
+	Guards     []core.Guard
+	Actions    []core.ActionDefinition
+	Priority   int
+}
+
+// StateActions is a typed counterpart of core.StateActions
+type StateActions[S ~string] struct {
+	State   S
+	OnEntry []core.ActionDefinition
+	OnExit  []core.ActionDefinition
+}
+
+// Branch is a typed counterpart of core.Branch
+type Branch[S ~string] struct {
+	To      S
+	Guards  []core.Guard
+	Actions []core.ActionDefinition
+}
+
+// Choice is a typed counterpart of core.Choice. Its name is used as Transition.To,
+// therefore it has the same type as states.
+type Choice[S ~string] struct {
+	Name     S
+	Branches []Branch[S]
+	Else     S
+	Junction bool
+}
+
+// Timer is a typed counterpart of core.Timer
+type Timer[S ~string, E ~string] struct {
+	State S
+	After time.Duration
+	Event E
+}
+
+// Schema is a typed counterpart of core.Schema
+type Schema[S ~string, E ~string] struct {
+	Name         string
+	InitialState S
+	FinalStates  []S
+	States       []S
+	Transitions  []Transition[S, E]
+	StateActions []StateActions[S]
+	Choices      []Choice[S]
+	Timers       []Timer[S, E]
+}
+
+// Core converts schema to core.Schema
+func (s Schema[S, E]) Core() core.Schema {
+	schema := core.Schema{
+		Name:         s.Name,
+		InitialState: core.State{Name: string(s.InitialState)},
+		FinalStates:  states(s.FinalStates),
+		States:       states(s.States),
+	}
+
+	for _, t := range s.Transitions {
+		schema.Transitions = append(schema.Transitions, core.Transition{
+			From:       string(t.From),
+			FromStates: names(t.FromStates),
+			To:         string(t.To),
+			Event:      core.Event(t.Event),
+			Internal:   t.Internal,
+			Guards:     t.Guards,
+			Actions:    t.Actions,
+			Priority:   t.Priority,
+		})
+	}
+
+	for _, sa := range s.StateActions {
+		schema.StateActions = append(schema.StateActions, core.StateActions{
+			State:   string(sa.State),
+			OnEntry: sa.OnEntry,
+			OnExit:  sa.OnExit,
+		})
+	}
+
+	for _, c := range s.Choices {
+		choice := core.Choice{Name: string(c.Name), Else: string(c.Else), Junction: c.Junction}
+		for _, b := range c.Branches {
+			choice.Branches = append(choice.Branches, core.Branch{To: string(b.To), Guards: b.Guards, Actions: b.Actions})
+		}
+		schema.Choices = append(schema.Choices, choice)
+	}
+
+	for _, tm := range s.Timers {
+		schema.Timers = append(schema.Timers, core.Timer{State: string(tm.State), After: tm.After, Event: core.Event(tm.Event)})
+	}
+
+	return schema
+}
+
+func states[S ~string](list []S) []core.State {
+	if list == nil {
+		return nil
+	}
+	result := make([]core.State, len(list))
+	for i, s := range list {
+		result[i] = core.State{Name: string(s)}
+	}
+	return result
+}
+
+func names[S ~string](list []S) []string {
+	if list == nil {
+		return nil
+	}
+	result := make([]string, len(list))
+	for i, s := range list {
+		result[i] = string(s)
+	}
+	return result
+}
@@ -0,0 +1,44 @@
+package typed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/estambakio/go-fsm/pkg/core"
+)
+
+func TestSchema_Core(t *testing.T) {
+	schema := Schema[orderState, orderEvent]{
+		Name:         "order",
+		InitialState: stateNew,
+		FinalStates:  []orderState{stateShipped},
+		States:       []orderState{stateNew, statePaid, stateShipped},
+		Transitions: []Transition[orderState, orderEvent]{
+			{FromStates: []orderState{stateNew, statePaid}, To: "route", Event: eventShip, Priority: 2},
+		},
+		StateActions: []StateActions[orderState]{{State: statePaid, OnEntry: []core.ActionDefinition{{Name: "notify"}}}},
+		Choices:      []Choice[orderState]{{Name: "route", Branches: []Branch[orderState]{{To: statePaid}}, Else: stateShipped}},
+		Timers:       []Timer[orderState, orderEvent]{{State: stateNew, After: time.Hour, Event: eventPay}},
+	}.Core()
+
+	if schema.Name != "order" || schema.InitialState.Name != "new" || len(schema.States) != 3 || schema.FinalStates[0].Name != "shipped" {
+		t.Errorf("states are not converted: %+v", schema)
+	}
+	tr := schema.Transitions[0]
+	if tr.From != "" || len(tr.FromStates) != 2 || tr.To != "route" || tr.Event != "ship" || tr.Priority != 2 {
+		t.Errorf("transition is not converted: %+v", tr)
+	}
+	if schema.StateActions[0].State != "paid" || schema.StateActions[0].OnEntry[0].Name != "notify" {
+		t.Errorf("state actions are not converted: %+v", schema.StateActions)
+	}
+	if c := schema.Choices[0]; c.Name != "route" || c.Else != "shipped" || c.Branches[0].To != "paid" {
+		t.Errorf("choice is not converted: %+v", c)
+	}
+	if tm := schema.Timers[0]; tm.State != "new" || tm.Event != "pay" || tm.After != time.Hour {
+		t.Errorf("timer is not converted: %+v", tm)
+	}
+
+	if _, err := core.NewMachineDefinition(schema); err != nil {
+		t.Errorf("converted schema is not valid: %v", err)
+	}
+}